@@ -0,0 +1,681 @@
+package skylight
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"slices"
+	"time"
+)
+
+// The binary format is a compact alternative to the JSON schema, for spooling and inter-process transport.
+//
+// A stream starts with the 4 byte magic "SKYB" and a version byte, followed by one frame per event. A frame is the
+// uvarint length of its payload, the payload, and the CRC-32 (Castagnoli) of the payload, little endian.
+//
+// Integers are varints, zigzag encoded when signed, and strings are a uvarint length followed by their bytes.
+// Keys, topics, error types and frame names are interned: a symbol is written as uvarint 0 followed by the string
+// the first time, which adds it to the dictionary of the stream, and as its 1-based index in the dictionary afterwards.
+// Resources are interned the same way, by identity. Both dictionaries are bounded, see maxSymbols: once full, new
+// entries are written inline every time.
+//
+// An event payload is:
+//
+//	flags       byte, see the binFlag constants
+//	id          string
+//	parent_id   string, if binFlagParent
+//	trace_id    string, if binFlagTrace
+//	created_at  time
+//	emitted_at  zigzag varint of nanoseconds since created_at, if binFlagEmitted
+//	level       byte
+//	topic       symbol
+//	message     string
+//	fields      uvarint count, then fields
+//	caller      frame, if binFlagCaller
+//	stack       uvarint count, then frames, if binFlagStack
+//	resource    resource reference, then uvarint count and fields if it is new, if binFlagResource
+//
+// A time is its zigzag Unix seconds, uvarint nanoseconds and zigzag UTC offset in seconds. A field is its key symbol,
+// a kind byte, the FieldKind, binKindFields for nested Fields or binKindTruncated for nested Fields too deep to be
+// encoded, and its value: a string, a zigzag varint for int64 and duration, 8 little endian bytes of IEEE 754 bits for
+// float64, a byte for bool, a time, an error, a uvarint count of fields for nested fields, a uvarint count of the fields
+// lost for truncated fields, like the truncated wire type of the JSON schema, or a string of its JSON encoding for any. An error is a presence byte, then its message
+// string, type symbol, stack, optional cause and joined errors, as rendered by RenderError. A frame is its function,
+// package and file symbols and a uvarint line.
+
+const (
+	binaryMagic   = "SKYB"
+	binaryVersion = 1
+
+	// maxSymbols bounds the dictionaries of a stream, so that high cardinality keys can't grow them forever.
+	maxSymbols = 4096
+
+	// maxFrameSize bounds the payload a decoder accepts, so that a corrupted length can't exhaust memory.
+	maxFrameSize = 64 << 20
+
+	// binKindFields is the kind byte of nested Fields values, which are stored as KindAny.
+	binKindFields = 64
+	// binKindTruncated is the kind byte of nested Fields values too deep to be encoded, which decode as truncatedFields.
+	binKindTruncated = 65
+
+	// maxFieldsDepth bounds the nesting of Fields values, in case a value contains itself. Deeper values are encoded
+	// as truncated fields.
+	maxFieldsDepth = 32
+)
+
+// Flags of an event payload, telling which optional members follow.
+const (
+	binFlagParent = 1 << iota
+	binFlagTrace
+	binFlagCaller
+	binFlagStack
+	binFlagResource
+	binFlagEmitted
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorrupt is returned when decoding a binary stream fails its checks. A stream can't be decoded past the first
+// corrupt frame, since its dictionary is lost.
+var ErrCorrupt = errors.New("skylight: corrupt binary stream")
+
+// BinaryEncoder writes event snapshots to a stream in the binary format, one frame per event.
+// It is not safe for concurrent use.
+type BinaryEncoder struct {
+	w         io.Writer
+	started   bool
+	symbols   map[string]uint64
+	resources map[*Resource]uint64
+	// added and addedResources are the dictionary entries of the frame being encoded, removed again when it isn't
+	// written, since the decoder never reads them.
+	added          []string
+	addedResources []*Resource
+	// err is the error of a frame written in part, after which the stream can't be decoded any further.
+	err     error
+	payload []byte
+	frame   []byte
+}
+
+// NewBinaryEncoder creates an encoder writing to w. Every Encode is a single call to w.Write.
+func NewBinaryEncoder(w io.Writer) *BinaryEncoder {
+	return &BinaryEncoder{
+		w:         w,
+		symbols:   make(map[string]uint64),
+		resources: make(map[*Resource]uint64),
+	}
+}
+
+// Encode writes the frame of s. When it fails, the stream goes on without the frame, unless the frame was written in
+// part: Encode then keeps returning the error.
+func (enc *BinaryEncoder) Encode(s *EventSnapshot) error {
+	if enc.err != nil {
+		return enc.err
+	}
+	clear(enc.addedResources)
+	enc.added, enc.addedResources = enc.added[:0], enc.addedResources[:0]
+	enc.payload = enc.appendEvent(enc.payload[:0], s)
+	if len(enc.payload) > maxFrameSize {
+		enc.rollback()
+		return fmt.Errorf("skylight: binary encode: event of %d bytes is too large", len(enc.payload))
+	}
+
+	enc.frame = enc.frame[:0]
+	if !enc.started {
+		enc.frame = append(enc.frame, binaryMagic...)
+		enc.frame = append(enc.frame, binaryVersion)
+	}
+	enc.frame = binary.AppendUvarint(enc.frame, uint64(len(enc.payload)))
+	enc.frame = append(enc.frame, enc.payload...)
+	enc.frame = binary.LittleEndian.AppendUint32(enc.frame, crc32.Checksum(enc.payload, crcTable))
+
+	if n, err := enc.w.Write(enc.frame); err != nil {
+		enc.rollback()
+		err = fmt.Errorf("skylight: binary encode: %w", err)
+		if n > 0 {
+			enc.err = err
+		}
+		return err
+	}
+	enc.started = true
+	return nil
+}
+
+// rollback removes the dictionary entries of a frame that wasn't written.
+func (enc *BinaryEncoder) rollback() {
+	for _, s := range enc.added {
+		delete(enc.symbols, s)
+	}
+	for _, r := range enc.addedResources {
+		delete(enc.resources, r)
+	}
+}
+
+func (enc *BinaryEncoder) appendEvent(b []byte, s *EventSnapshot) []byte {
+	var flags byte
+	if s.ParentID != "" {
+		flags |= binFlagParent
+	}
+	if s.TraceID != "" {
+		flags |= binFlagTrace
+	}
+	if s.Caller != nil {
+		flags |= binFlagCaller
+	}
+	if len(s.Stack) > 0 {
+		flags |= binFlagStack
+	}
+	if s.Resource != nil {
+		flags |= binFlagResource
+	}
+	if !s.EmittedAt.IsZero() {
+		flags |= binFlagEmitted
+	}
+
+	b = append(b, flags)
+	b = appendString(b, s.ID)
+	if flags&binFlagParent != 0 {
+		b = appendString(b, s.ParentID)
+	}
+	if flags&binFlagTrace != 0 {
+		b = appendString(b, s.TraceID)
+	}
+	b = appendTime(b, s.CreatedAt)
+	if flags&binFlagEmitted != 0 {
+		// Round(0) strips the monotonic clock readings, which would skew the wall clock difference.
+		b = binary.AppendVarint(b, int64(s.EmittedAt.Round(0).Sub(s.CreatedAt.Round(0))))
+	}
+	b = append(b, byte(s.Level))
+	b = enc.appendSymbol(b, s.Topic)
+	b = appendString(b, s.Message)
+	b = enc.appendFields(b, s.Fields)
+	if flags&binFlagCaller != 0 {
+		b = enc.appendFrame(b, *s.Caller)
+	}
+	if flags&binFlagStack != 0 {
+		b = enc.appendFrames(b, s.Stack)
+	}
+	if flags&binFlagResource != 0 {
+		if idx, ok := enc.resources[s.Resource]; ok {
+			b = binary.AppendUvarint(b, idx+1)
+		} else {
+			if len(enc.resources) < maxSymbols {
+				enc.resources[s.Resource] = uint64(len(enc.resources))
+				enc.addedResources = append(enc.addedResources, s.Resource)
+			}
+			b = binary.AppendUvarint(b, 0)
+			b = enc.appendFields(b, s.Resource.Fields())
+		}
+	}
+	return b
+}
+
+func (enc *BinaryEncoder) appendSymbol(b []byte, s string) []byte {
+	if idx, ok := enc.symbols[s]; ok {
+		return binary.AppendUvarint(b, idx+1)
+	}
+	if len(enc.symbols) < maxSymbols {
+		enc.symbols[s] = uint64(len(enc.symbols))
+		enc.added = append(enc.added, s)
+	}
+	b = binary.AppendUvarint(b, 0)
+	return appendString(b, s)
+}
+
+func (enc *BinaryEncoder) appendFields(b []byte, fields []Field) []byte {
+	b = binary.AppendUvarint(b, uint64(len(fields)))
+	for _, f := range fields {
+		b = enc.appendField(b, f, 0)
+	}
+	return b
+}
+
+func (enc *BinaryEncoder) appendField(b []byte, f Field, depth int) []byte {
+	if f.Kind == kindLazy {
+		f = f.resolve()
+	}
+	b = enc.appendSymbol(b, f.Key)
+	if n, ok := f.obj.(truncatedFields); ok && f.Kind == KindAny {
+		b = append(b, binKindTruncated)
+		return binary.AppendUvarint(b, uint64(n))
+	}
+	if nested, ok := f.obj.(Fields); ok && f.Kind == KindAny {
+		if depth >= maxFieldsDepth && len(nested) > 0 {
+			b = append(b, binKindTruncated)
+			return binary.AppendUvarint(b, uint64(len(nested)))
+		}
+		keys := make([]string, 0, len(nested))
+		for k := range nested {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		b = append(b, binKindFields)
+		b = binary.AppendUvarint(b, uint64(len(keys)))
+		for _, k := range keys {
+			b = enc.appendField(b, anyField(k, nested[k]), depth+1)
+		}
+		return b
+	}
+
+	b = append(b, byte(f.Kind))
+	switch f.Kind {
+	case KindString:
+		b = appendString(b, f.str)
+	case KindInt64, KindDuration:
+		b = binary.AppendVarint(b, f.num)
+	case KindFloat64:
+		b = binary.LittleEndian.AppendUint64(b, uint64(f.num))
+	case KindBool:
+		b = append(b, byte(f.num))
+	case KindTime:
+		b = appendTime(b, f.time())
+	case KindError:
+		e, _ := f.obj.(error)
+		b = enc.appendError(b, RenderError(e))
+	default:
+		data, err := json.Marshal(f.obj)
+		if err != nil {
+			data, _ = json.Marshal(fmt.Sprintf("%+v", f.obj))
+		}
+		b = appendString(b, string(data))
+	}
+	return b
+}
+
+func (enc *BinaryEncoder) appendError(b []byte, info *ErrorInfo) []byte {
+	if info == nil {
+		return append(b, 0)
+	}
+	b = append(b, 1)
+	b = appendString(b, info.Message)
+	b = enc.appendSymbol(b, info.Type)
+	b = enc.appendFrames(b, info.Stack)
+	b = enc.appendError(b, info.Cause)
+	b = binary.AppendUvarint(b, uint64(len(info.Errors)))
+	for i := range info.Errors {
+		b = enc.appendError(b, &info.Errors[i])
+	}
+	return b
+}
+
+func (enc *BinaryEncoder) appendFrames(b []byte, frames []Frame) []byte {
+	b = binary.AppendUvarint(b, uint64(len(frames)))
+	for _, f := range frames {
+		b = enc.appendFrame(b, f)
+	}
+	return b
+}
+
+func (enc *BinaryEncoder) appendFrame(b []byte, f Frame) []byte {
+	b = enc.appendSymbol(b, f.Function)
+	b = enc.appendSymbol(b, f.Package)
+	b = enc.appendSymbol(b, f.File)
+	return binary.AppendUvarint(b, uint64(f.Line))
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendTime(b []byte, t time.Time) []byte {
+	_, offset := t.Zone()
+	b = binary.AppendVarint(b, t.Unix())
+	b = binary.AppendUvarint(b, uint64(t.Nanosecond()))
+	return binary.AppendVarint(b, int64(offset))
+}
+
+// BinaryDecoder reads event snapshots from a stream in the binary format.
+type BinaryDecoder struct {
+	r         *bufio.Reader
+	started   bool
+	symbols   []string
+	resources []*Resource
+	payload   []byte
+}
+
+// NewBinaryDecoder creates a decoder reading from r.
+func NewBinaryDecoder(r io.Reader) *BinaryDecoder {
+	return &BinaryDecoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads the next event into s. It returns io.EOF at the end of the stream, io.ErrUnexpectedEOF when the
+// stream ends within a frame, and an error wrapping ErrCorrupt when a frame fails its checks.
+func (dec *BinaryDecoder) Decode(s *EventSnapshot) error {
+	if !dec.started {
+		var header [len(binaryMagic) + 1]byte
+		if _, err := io.ReadFull(dec.r, header[:]); err != nil {
+			return err
+		}
+		if string(header[:len(binaryMagic)]) != binaryMagic {
+			return fmt.Errorf("%w: bad magic", ErrCorrupt)
+		}
+		if v := header[len(binaryMagic)]; v > binaryVersion {
+			return fmt.Errorf("skylight: unsupported binary version %d", v)
+		}
+		dec.started = true
+	}
+
+	size, err := binary.ReadUvarint(dec.r)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+		return err
+	}
+	if size > maxFrameSize {
+		return fmt.Errorf("%w: frame of %d bytes", ErrCorrupt, size)
+	}
+	if cap(dec.payload) < int(size)+4 {
+		dec.payload = make([]byte, int(size)+4)
+	}
+	frame := dec.payload[:size+4]
+	if _, err := io.ReadFull(dec.r, frame); err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	payload := frame[:size]
+	if binary.LittleEndian.Uint32(frame[size:]) != crc32.Checksum(payload, crcTable) {
+		return fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+	}
+
+	r := binReader{b: payload}
+	decoded := dec.readEvent(&r)
+	if r.err == nil && len(r.b) > 0 {
+		r.err = fmt.Errorf("%w: %d trailing bytes", ErrCorrupt, len(r.b))
+	}
+	if r.err != nil {
+		return r.err
+	}
+	*s = decoded
+	return nil
+}
+
+func (dec *BinaryDecoder) readEvent(r *binReader) EventSnapshot {
+	var s EventSnapshot
+	flags := r.byte()
+	s.ID = r.string()
+	if flags&binFlagParent != 0 {
+		s.ParentID = r.string()
+	}
+	if flags&binFlagTrace != 0 {
+		s.TraceID = r.string()
+	}
+	s.CreatedAt = r.time()
+	if flags&binFlagEmitted != 0 {
+		s.EmittedAt = s.CreatedAt.Add(time.Duration(r.varint()))
+	}
+	s.Level = Level(r.byte())
+	s.Topic = dec.readSymbol(r)
+	s.Message = r.string()
+	s.Fields = dec.readFields(r)
+	if flags&binFlagCaller != 0 {
+		f := dec.readFrame(r)
+		s.Caller = &f
+	}
+	if flags&binFlagStack != 0 {
+		s.Stack = dec.readFrames(r)
+	}
+	if flags&binFlagResource != 0 {
+		if idx := r.uvarint(); idx > 0 {
+			if idx > uint64(len(dec.resources)) {
+				r.fail("unknown resource")
+			} else {
+				s.Resource = dec.resources[idx-1]
+			}
+		} else {
+			s.Resource = &Resource{fields: dec.readFields(r)}
+			if len(dec.resources) < maxSymbols {
+				dec.resources = append(dec.resources, s.Resource)
+			}
+		}
+	}
+	return s
+}
+
+func (dec *BinaryDecoder) readSymbol(r *binReader) string {
+	idx := r.uvarint()
+	if idx == 0 {
+		s := r.string()
+		if r.err == nil && len(dec.symbols) < maxSymbols {
+			dec.symbols = append(dec.symbols, s)
+		}
+		return s
+	}
+	if idx > uint64(len(dec.symbols)) {
+		r.fail("unknown symbol")
+		return ""
+	}
+	return dec.symbols[idx-1]
+}
+
+func (dec *BinaryDecoder) readFields(r *binReader) []Field {
+	n := r.count()
+	if n == 0 {
+		return nil
+	}
+	fields := make([]Field, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		fields = append(fields, dec.readField(r, 0))
+	}
+	return fields
+}
+
+func (dec *BinaryDecoder) readField(r *binReader, depth int) Field {
+	if depth > maxFieldsDepth {
+		r.fail("fields too deep")
+		return Field{}
+	}
+	key := dec.readSymbol(r)
+	kind := r.byte()
+	switch FieldKind(kind) {
+	case KindString:
+		return stringField(key, r.string())
+	case KindInt64:
+		return int64Field(key, r.varint())
+	case KindDuration:
+		return durationField(key, time.Duration(r.varint()))
+	case KindFloat64:
+		return Field{Key: key, Kind: KindFloat64, num: int64(r.uint64())}
+	case KindBool:
+		return boolField(key, r.byte() == 1)
+	case KindTime:
+		return timeField(key, r.time())
+	case KindError:
+		f := Field{Key: key, Kind: KindError}
+		if info := dec.readError(r, 0); info != nil {
+			f.obj = &decodedError{info: *info}
+		}
+		return f
+	case KindAny:
+		var v any
+		if data := r.string(); r.err == nil {
+			if err := json.Unmarshal([]byte(data), &v); err != nil {
+				r.fail("invalid value of field " + key)
+			}
+		}
+		return Field{Key: key, Kind: KindAny, obj: v}
+	case binKindFields:
+		n := r.count()
+		nested := make(Fields, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			f := dec.readField(r, depth+1)
+			nested[f.Key] = f.Value()
+		}
+		return Field{Key: key, Kind: KindAny, obj: nested}
+	case binKindTruncated:
+		return Field{Key: key, Kind: KindAny, obj: truncatedFields(r.uvarint())}
+	default:
+		r.fail(fmt.Sprintf("unknown kind %d", kind))
+		return Field{}
+	}
+}
+
+func (dec *BinaryDecoder) readError(r *binReader, depth int) *ErrorInfo {
+	if r.byte() == 0 || r.err != nil {
+		return nil
+	}
+	if depth > maxErrorDepth {
+		r.fail("error too deep")
+		return nil
+	}
+	info := &ErrorInfo{
+		Message: r.string(),
+		Type:    dec.readSymbol(r),
+		Stack:   dec.readFrames(r),
+		Cause:   dec.readError(r, depth+1),
+	}
+	if n := r.count(); n > 0 {
+		info.Errors = make([]ErrorInfo, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			if e := dec.readError(r, depth+1); e != nil {
+				info.Errors = append(info.Errors, *e)
+			}
+		}
+	}
+	return info
+}
+
+func (dec *BinaryDecoder) readFrames(r *binReader) []Frame {
+	n := r.count()
+	if n == 0 {
+		return nil
+	}
+	frames := make([]Frame, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		frames = append(frames, dec.readFrame(r))
+	}
+	return frames
+}
+
+func (dec *BinaryDecoder) readFrame(r *binReader) Frame {
+	return Frame{
+		Function: dec.readSymbol(r),
+		Package:  dec.readSymbol(r),
+		File:     dec.readSymbol(r),
+		Line:     int(r.uvarint()),
+	}
+}
+
+// binReader reads the values of a payload. The first error is sticky: reads after it return zero values.
+type binReader struct {
+	b   []byte
+	err error
+}
+
+func (r *binReader) fail(reason string) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: %s", ErrCorrupt, reason)
+	}
+	r.b = nil
+}
+
+func (r *binReader) byte() byte {
+	if len(r.b) < 1 {
+		r.fail("truncated payload")
+		return 0
+	}
+	c := r.b[0]
+	r.b = r.b[1:]
+	return c
+}
+
+func (r *binReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.fail("invalid varint")
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *binReader) varint() int64 {
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		r.fail("invalid varint")
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *binReader) uint64() uint64 {
+	if len(r.b) < 8 {
+		r.fail("truncated payload")
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(r.b)
+	r.b = r.b[8:]
+	return v
+}
+
+// count reads a length, which can't exceed the bytes left since every element takes at least one.
+func (r *binReader) count() int {
+	n := r.uvarint()
+	if n > uint64(len(r.b)) {
+		r.fail("invalid length")
+		return 0
+	}
+	return int(n)
+}
+
+func (r *binReader) string() string {
+	n := r.count()
+	s := string(r.b[:n])
+	r.b = r.b[n:]
+	return s
+}
+
+func (r *binReader) time() time.Time {
+	sec := r.varint()
+	nsec := r.uvarint()
+	offset := r.varint()
+	if nsec >= uint64(time.Second) || offset < -24*60*60 || offset > 24*60*60 {
+		r.fail("invalid time")
+		return time.Time{}
+	}
+	t := time.Unix(sec, int64(nsec))
+	if offset == 0 {
+		return t.UTC()
+	}
+	return t.In(time.FixedZone("", int(offset)))
+}
+
+// encodeBinaryBatch encodes events as a binary stream.
+func encodeBinaryBatch(events []EventSnapshot) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(binaryMagic)
+	buf.WriteByte(binaryVersion)
+	enc := NewBinaryEncoder(&buf)
+	enc.started = true
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeBinaryBatch decodes all the events of a binary stream.
+func decodeBinaryBatch(data []byte) ([]EventSnapshot, error) {
+	dec := NewBinaryDecoder(bytes.NewReader(data))
+	var events []EventSnapshot
+	for {
+		var s EventSnapshot
+		err := dec.Decode(&s)
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, s)
+	}
+}
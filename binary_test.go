@@ -0,0 +1,321 @@
+package skylight
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"testing"
+	"time"
+)
+
+// testSnapshots emits events with every kind of field, and returns their snapshots.
+func testSnapshots(n int) []EventSnapshot {
+	var snapshots []EventSnapshot
+	c := New(WithLevel(LevelDebug), WithStack(LevelWarn), WithResource(NewResource().With("service", "test")),
+		WithObserver(WildcardObserver(func(e *Event) { snapshots = append(snapshots, e.Snapshot()) })))
+	root := c.Info("request").Topic("http").Emit(true)
+	for i := 0; i < n; i++ {
+		e := root.Debugf("step %d", i).Topic("work")
+		if i%10 == 9 {
+			e = root.Warnf("step %d", i).Topic("work").Err("error", fmt.Errorf("step %d: %w", i, io.ErrUnexpectedEOF))
+		}
+		e.Str("name", "step").
+			Int("index", i).
+			Float("ratio", float64(i)/3).
+			Bool("even", i%2 == 0).
+			Dur("duration", time.Duration(i)*time.Millisecond).
+			Time("at", time.Date(2024, 5, 1, 12, 0, i, 0, time.UTC)).
+			Any("user", Fields{"id": i, "tags": Fields{"plan": "pro"}}).
+			Emit()
+	}
+	root.Evict()
+	return snapshots
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	events := testSnapshots(20)
+	data, err := encodeBinaryBatch(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeBinaryBatch(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := encodeBatch(events)
+	got, _ := encodeBatch(decoded)
+	if !bytes.Equal(got, want) {
+		t.Errorf("decoded events differ:\n got %s\nwant %s", got, want)
+	}
+	if decoded[1].Resource != decoded[2].Resource {
+		t.Error("the events of a stream don't share their resource")
+	}
+}
+
+// failingWriter fails the writes for which fail returns true, after writing n bytes of them.
+type failingWriter struct {
+	bytes.Buffer
+	fail func() bool
+	n    int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.fail() {
+		w.Buffer.Write(p[:w.n])
+		return w.n, errors.New("disk full")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestBinaryFailedWrite(t *testing.T) {
+	events := testSnapshots(10)
+	failing := false
+	w := &failingWriter{fail: func() bool { return failing }}
+	enc := NewBinaryEncoder(w)
+
+	var written []EventSnapshot
+	for i := range events {
+		// The first warning, with the first error and its symbols, isn't written.
+		failing = i == 10
+		if err := enc.Encode(&events[i]); err != nil {
+			if !failing {
+				t.Fatal(err)
+			}
+			continue
+		}
+		written = append(written, events[i])
+	}
+	failing = false
+	warning := events[10]
+	warning.ID = "again"
+	if err := enc.Encode(&warning); err != nil {
+		t.Fatal(err)
+	}
+	written = append(written, warning)
+
+	decoded, err := decodeBinaryBatch(w.Bytes())
+	if err != nil {
+		t.Fatalf("stream corrupted by a failed write: %v", err)
+	}
+	want, _ := encodeBatch(written)
+	got, _ := encodeBatch(decoded)
+	if !bytes.Equal(got, want) {
+		t.Errorf("decoded events differ:\n got %s\nwant %s", got, want)
+	}
+
+	// A frame written in part ends the stream.
+	w = &failingWriter{fail: func() bool { return true }, n: 3}
+	enc = NewBinaryEncoder(w)
+	if err := enc.Encode(&events[0]); err == nil {
+		t.Fatal("no error from a failed write")
+	}
+	w.fail = func() bool { return false }
+	if err := enc.Encode(&events[1]); err == nil {
+		t.Error("encoding went on after a partial write")
+	}
+}
+
+func TestBinaryNestingDepth(t *testing.T) {
+	cyclic := Fields{"name": "loop"}
+	cyclic["self"] = cyclic
+	s := EventSnapshot{ID: "cyclic", Fields: []Field{anyField("loop", cyclic)}}
+	data, err := encodeBinaryBatch([]EventSnapshot{s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeBinaryBatch(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	depth := 0
+	for v := decoded[0].Fields[0].Value(); ; depth++ {
+		f, ok := v.(Fields)
+		if !ok || f["self"] == nil {
+			break
+		}
+		v = f["self"]
+	}
+	if depth != maxFieldsDepth {
+		t.Errorf("cyclic fields decoded %d levels deep, want %d", depth, maxFieldsDepth)
+	}
+
+	// Fields one level too deep decode as the marker of the JSON schema, and re-encode the same in both formats.
+	deep := Fields{"leaf": true}
+	for i := 0; i <= maxFieldsDepth; i++ {
+		deep = Fields{"next": deep}
+	}
+	s = EventSnapshot{ID: "deep", Fields: []Field{anyField("deep", deep)}}
+	if data, err = encodeBinaryBatch([]EventSnapshot{s}); err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err = decodeBinaryBatch(data); err != nil {
+		t.Fatal(err)
+	}
+	innermost := decoded[0].Fields[0].Value()
+	for i := 0; i < maxFieldsDepth; i++ {
+		innermost = innermost.(Fields)["next"]
+	}
+	if innermost != truncatedFields(1) {
+		t.Errorf("innermost value %v, want 1 truncated field", innermost)
+	}
+	want, _ := encodeBatch([]EventSnapshot{s})
+	got, _ := encodeBatch(decoded)
+	if !bytes.Equal(got, want) {
+		t.Errorf("decoded truncated fields differ from JSON:\n got %s\nwant %s", got, want)
+	}
+	again, err := encodeBinaryBatch(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, data) {
+		t.Error("re-encoded truncated fields differ")
+	}
+
+	// A stream nesting deeper than any encoder does is corrupt.
+	payload := []byte{0}
+	payload = appendString(payload, "deep")
+	payload = appendTime(payload, time.Unix(0, 0))
+	payload = append(payload, byte(LevelInfo), 0)
+	payload = appendString(payload, "topic")
+	payload = appendString(payload, "message")
+	payload = binary.AppendUvarint(payload, 1)
+	payload = appendString(append(payload, 0), "k")
+	for i := 0; i <= maxFieldsDepth; i++ {
+		payload = append(payload, binKindFields, 1, 1)
+	}
+	payload = append(payload, byte(KindBool), 1)
+	if _, err := decodeBinaryBatch(binaryFrame(payload)); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("decoding nested fields too deep: %v, want ErrCorrupt", err)
+	}
+}
+
+// binaryFrame frames payload as a stream of one event.
+func binaryFrame(payload []byte) []byte {
+	stream := append([]byte(binaryMagic), binaryVersion)
+	stream = binary.AppendUvarint(stream, uint64(len(payload)))
+	stream = append(stream, payload...)
+	return binary.LittleEndian.AppendUint32(stream, crc32.Checksum(payload, crcTable))
+}
+
+func TestBinaryStream(t *testing.T) {
+	events := testSnapshots(3)
+	var buf bytes.Buffer
+	enc := NewBinaryEncoder(&buf)
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, append([]byte(binaryMagic), binaryVersion)) {
+		t.Fatalf("stream starts with %q, want the magic and version", data[:5])
+	}
+
+	// The first frame of the stream, after the header and its length.
+	size, n := binary.Uvarint(data[5:])
+	first := 5 + n + int(size) + 4
+
+	dec := NewBinaryDecoder(bytes.NewReader(data))
+	for i := range events {
+		var s EventSnapshot
+		if err := dec.Decode(&s); err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		if s.ID != events[i].ID {
+			t.Errorf("event %d has ID %q, want %q", i, s.ID, events[i].ID)
+		}
+	}
+	var s EventSnapshot
+	if err := dec.Decode(&s); err != io.EOF {
+		t.Errorf("decoding past the last event: %v, want io.EOF", err)
+	}
+
+	tests := []struct {
+		name   string
+		stream func() []byte
+		want   error
+	}{
+		{"empty", func() []byte { return nil }, nil},
+		{"bad magic", func() []byte { return append([]byte("SKYJ"), data[4:]...) }, ErrCorrupt},
+		{"flipped bit", func() []byte {
+			b := bytes.Clone(data)
+			b[first-5] ^= 1
+			return b
+		}, ErrCorrupt},
+		{"flipped checksum", func() []byte {
+			b := bytes.Clone(data)
+			b[first-1] ^= 1
+			return b
+		}, ErrCorrupt},
+		{"truncated frame", func() []byte { return data[:len(data)-1] }, io.ErrUnexpectedEOF},
+		{"truncated length", func() []byte {
+			return append(bytes.Clone(data[:first]), 0x80)
+		}, io.ErrUnexpectedEOF},
+		{"huge frame", func() []byte {
+			return binary.AppendUvarint(bytes.Clone(data[:first]), maxFrameSize+1)
+		}, ErrCorrupt},
+		{"trailing bytes", func() []byte {
+			payload := bytes.Clone(data[5+n : 5+n+int(size)])
+			return binaryFrame(append(payload, 0))
+		}, ErrCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeBinaryBatch(tt.stream()); !errors.Is(err, tt.want) {
+				t.Errorf("decoding: %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	future := append([]byte(binaryMagic), binaryVersion+1)
+	if _, err := decodeBinaryBatch(future); err == nil || errors.Is(err, ErrCorrupt) {
+		t.Errorf("decoding a newer version: %v, want an unsupported version error", err)
+	}
+
+	// The frames before a corrupt one are decoded.
+	b := bytes.Clone(data)
+	b[len(b)-1] ^= 1
+	dec = NewBinaryDecoder(bytes.NewReader(b))
+	for i := 0; i < len(events)-1; i++ {
+		if err := dec.Decode(&s); err != nil {
+			t.Fatalf("event %d before the corrupt frame: %v", i, err)
+		}
+	}
+	if err := dec.Decode(&s); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("decoding the corrupt frame: %v, want ErrCorrupt", err)
+	}
+}
+
+func BenchmarkBatch(b *testing.B) {
+	events := testSnapshots(100)
+	formats := []struct {
+		name   string
+		encode func([]EventSnapshot) ([]byte, error)
+		decode func([]byte) ([]EventSnapshot, error)
+	}{
+		{"binary", encodeBinaryBatch, decodeBinaryBatch},
+		{"json", encodeBatch, decodeBatch},
+	}
+	for _, f := range formats {
+		data, err := f.encode(events)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(f.name+"/encode", func(b *testing.B) {
+			b.ReportAllocs()
+			b.ReportMetric(float64(len(data))/float64(len(events)), "bytes/event")
+			for i := 0; i < b.N; i++ {
+				f.encode(events)
+			}
+		})
+		b.Run(f.name+"/decode", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				f.decode(data)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package skylight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a BreakerSink circuit.
+type BreakerState int
+
+const (
+	// BreakerClosed writes batches to the sink.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen sends batches to the fallbacks without trying the sink.
+	BreakerOpen
+
+	// BreakerHalfOpen probes the sink with a single batch after the cool-down.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return ""
+	}
+}
+
+// BreakerStats is a point in time view of a BreakerSink.
+type BreakerStats struct {
+	State          BreakerState
+	Failures       int
+	Opened         uint64
+	Rejected       uint64
+	FallbackWrites uint64
+	FallbackErrors uint64
+}
+
+// BreakerSink wraps a sink with a circuit breaker. After a number of consecutive failures the circuit opens and batches
+// go to the fallback sinks, tried in order, until the cool-down has passed and a probe batch succeeds. Permanent
+// errors, such as a batch rejected by the collector, show that the sink is up: they don't count as failures.
+type BreakerSink struct {
+	name      string
+	sink      Sink
+	fallbacks []Sink
+	threshold int
+	cooldown  time.Duration
+	diag      *Client
+
+	mu       sync.Mutex
+	state    BreakerState
+	openedAt time.Time
+	stats    BreakerStats
+}
+
+// NewBreakerSink wraps sink. By default the circuit opens after 5 consecutive failures and probes the sink again after 30s.
+func NewBreakerSink(sink Sink) *BreakerSink {
+	return &BreakerSink{
+		name:      fmt.Sprintf("%T", sink),
+		sink:      sink,
+		threshold: 5,
+		cooldown:  30 * time.Second,
+	}
+}
+
+// WithName sets the name of the sink in diagnostic events.
+func (b *BreakerSink) WithName(name string) *BreakerSink {
+	if b == nil {
+		return nil
+	}
+	b.name = name
+	return b
+}
+
+// WithThreshold sets the number of consecutive failures that opens the circuit.
+func (b *BreakerSink) WithThreshold(n int) *BreakerSink {
+	if b == nil {
+		return nil
+	}
+	b.threshold = max(n, 1)
+	return b
+}
+
+// WithCooldown sets how long the circuit stays open before probing the sink.
+func (b *BreakerSink) WithCooldown(d time.Duration) *BreakerSink {
+	if b == nil {
+		return nil
+	}
+	b.cooldown = d
+	return b
+}
+
+// WithFallback sets the sinks batches go to while the circuit is open, or when the sink fails. They are tried in order.
+func (b *BreakerSink) WithFallback(sinks ...Sink) *BreakerSink {
+	if b == nil {
+		return nil
+	}
+	b.fallbacks = sinks
+	return b
+}
+
+// WithDiagnostics emits state changes as events on c, with the "skylight.breaker" topic.
+func (b *BreakerSink) WithDiagnostics(c *Client) *BreakerSink {
+	if b == nil {
+		return nil
+	}
+	b.diag = c
+	return b
+}
+
+// Stats returns the current state and counters of the breaker.
+func (b *BreakerSink) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := b.stats
+	stats.State = b.state
+	return stats
+}
+
+func (b *BreakerSink) Write(ctx context.Context, events []EventSnapshot) error {
+	if !b.allow() {
+		b.mu.Lock()
+		b.stats.Rejected++
+		b.mu.Unlock()
+		return b.fallback(ctx, events, errors.New("skylight: circuit open"))
+	}
+
+	err := b.sink.Write(ctx, events)
+	b.result(err)
+	if err != nil {
+		return b.fallback(ctx, events, err)
+	}
+	return nil
+}
+
+func (b *BreakerSink) Flush(ctx context.Context) error {
+	errs := []error{b.sink.Flush(ctx)}
+	for _, s := range b.fallbacks {
+		errs = append(errs, s.Flush(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+func (b *BreakerSink) Close(ctx context.Context) error {
+	errs := []error{b.sink.Close(ctx)}
+	for _, s := range b.fallbacks {
+		errs = append(errs, s.Close(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// idle lets the wrapped sink do its pending work while the circuit is closed.
+func (b *BreakerSink) idle(ctx context.Context) {
+	is, ok := b.sink.(idleSink)
+	if !ok {
+		return
+	}
+	b.mu.Lock()
+	closed := b.state == BreakerClosed
+	b.mu.Unlock()
+	if closed {
+		is.idle(ctx)
+	}
+}
+
+// allow reports whether a batch may be written to the sink, moving an open circuit to half-open once the cool-down has passed.
+func (b *BreakerSink) allow() bool {
+	b.mu.Lock()
+	switch b.state {
+	case BreakerClosed:
+		b.mu.Unlock()
+		return true
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			b.mu.Unlock()
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.mu.Unlock()
+		b.emit(BreakerOpen, BreakerHalfOpen, nil)
+		return true
+	default:
+		// A probe is already in flight.
+		b.mu.Unlock()
+		return false
+	}
+}
+
+func (b *BreakerSink) result(err error) {
+	b.mu.Lock()
+	from := b.state
+	if err == nil || IsPermanent(err) {
+		b.stats.Failures = 0
+		b.state = BreakerClosed
+	} else {
+		b.stats.Failures++
+		if from == BreakerHalfOpen || b.stats.Failures >= b.threshold {
+			b.state = BreakerOpen
+			b.openedAt = time.Now()
+		}
+	}
+	to := b.state
+	if from != to && to == BreakerOpen {
+		b.stats.Opened++
+	}
+	b.mu.Unlock()
+
+	if from != to {
+		b.emit(from, to, err)
+	}
+}
+
+func (b *BreakerSink) fallback(ctx context.Context, events []EventSnapshot, cause error) error {
+	if len(b.fallbacks) == 0 {
+		return cause
+	}
+	errs := []error{cause}
+	for _, s := range b.fallbacks {
+		err := s.Write(ctx, events)
+		b.mu.Lock()
+		if err == nil {
+			b.stats.FallbackWrites++
+		} else {
+			b.stats.FallbackErrors++
+		}
+		b.mu.Unlock()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (b *BreakerSink) emit(from, to BreakerState, err error) {
+	level := LevelInfo
+	if to == BreakerOpen {
+		level = LevelWarn
+	}
+	newEvent(level, b.diag).
+		Messagef("circuit %s for sink %s", to, b.name).
+		Topic("skylight.breaker").
+		Str("sink", b.name).
+		Str("from", from.String()).
+		Str("to", to.String()).
+		Err("error", err).
+		Emit()
+}
@@ -0,0 +1,203 @@
+package skylight
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// switchSink fails its writes while err is set, counting every attempt.
+type switchSink struct {
+	mu     sync.Mutex
+	err    error
+	writes int
+}
+
+func (s *switchSink) Write(ctx context.Context, events []EventSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes++
+	return s.err
+}
+
+func (s *switchSink) Flush(ctx context.Context) error { return nil }
+
+func (s *switchSink) Close(ctx context.Context) error { return nil }
+
+func (s *switchSink) set(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+func (s *switchSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writes
+}
+
+func TestBreakerSinkTransitions(t *testing.T) {
+	var diag []EventSnapshot
+	c := New(WithObserver(TopicObserver("skylight.breaker", func(e *Event) { diag = append(diag, e.Snapshot()) })))
+	primary, fallback := &switchSink{err: errors.New("down")}, &memorySink{}
+	b := NewBreakerSink(primary).WithName("primary").WithThreshold(2).WithCooldown(time.Hour).WithFallback(fallback).WithDiagnostics(c)
+	ctx := context.Background()
+	batch := testSnapshots(1)
+
+	// Consecutive failures open the circuit.
+	for i := 0; i < 2; i++ {
+		if err := b.Write(ctx, batch); err != nil {
+			t.Fatalf("write %d: %v, want the fallback to take the batch", i, err)
+		}
+	}
+	if s := b.Stats(); s.State != BreakerOpen || s.Failures != 2 || s.Opened != 1 {
+		t.Fatalf("stats = %+v, want an open circuit after 2 failures", s)
+	}
+
+	// The open circuit doesn't try the sink until the cool-down has passed.
+	b.Write(ctx, batch)
+	if primary.count() != 2 || b.Stats().Rejected != 1 {
+		t.Errorf("sink written %d times with %d rejected, want 2 and 1", primary.count(), b.Stats().Rejected)
+	}
+
+	// A failed probe opens the circuit again.
+	b.mu.Lock()
+	b.openedAt = time.Now().Add(-2 * time.Hour)
+	b.mu.Unlock()
+	b.Write(ctx, batch)
+	if s := b.Stats(); s.State != BreakerOpen || s.Opened != 2 || primary.count() != 3 {
+		t.Fatalf("stats = %+v after a failed probe", s)
+	}
+
+	// A successful probe closes it.
+	primary.set(nil)
+	b.mu.Lock()
+	b.openedAt = time.Now().Add(-2 * time.Hour)
+	b.mu.Unlock()
+	if err := b.Write(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.Stats(); s.State != BreakerClosed || s.Failures != 0 || s.FallbackWrites != 4 {
+		t.Errorf("stats = %+v after a successful probe", s)
+	}
+	if fallback.len() != 4*len(batch) {
+		t.Errorf("fallback got %d events, want %d", fallback.len(), 4*len(batch))
+	}
+
+	want := []struct {
+		from, to BreakerState
+		level    Level
+	}{
+		{BreakerClosed, BreakerOpen, LevelWarn},
+		{BreakerOpen, BreakerHalfOpen, LevelInfo},
+		{BreakerHalfOpen, BreakerOpen, LevelWarn},
+		{BreakerOpen, BreakerHalfOpen, LevelInfo},
+		{BreakerHalfOpen, BreakerClosed, LevelInfo},
+	}
+	if len(diag) != len(want) {
+		t.Fatalf("diagnostic events = %v, want %d", diag, len(want))
+	}
+	for i, w := range want {
+		got := fieldValues(diag[i])
+		if diag[i].Level != w.level || got["sink"] != "primary" || got["from"] != w.from.String() || got["to"] != w.to.String() {
+			t.Errorf("event %d = %v %q %v, want %s to %s at %v", i, diag[i].Level, diag[i].Message, got, w.from, w.to, w.level)
+		}
+	}
+	if got := fieldValues(diag[0])["error"]; got != "down" {
+		t.Errorf("error of the opening event = %q, want down", got)
+	}
+}
+
+func TestBreakerSinkIgnoresPermanentErrors(t *testing.T) {
+	primary, fallback := &switchSink{err: errors.New("down")}, &memorySink{}
+	b := NewBreakerSink(primary).WithThreshold(2).WithCooldown(time.Hour).WithFallback(fallback)
+	ctx := context.Background()
+	batch := testSnapshots(1)
+
+	// A rejected batch resets the failures: the sink is up.
+	b.Write(ctx, batch)
+	primary.set(Permanent(errors.New("bad batch")))
+	for i := 0; i < 3; i++ {
+		b.Write(ctx, batch)
+	}
+	if s := b.Stats(); s.State != BreakerClosed || s.Failures != 0 || s.Opened != 0 {
+		t.Fatalf("stats = %+v after rejected batches, want a closed circuit", s)
+	}
+	if primary.count() != 4 {
+		t.Errorf("sink written %d times, want 4", primary.count())
+	}
+
+	// A rejected probe closes the circuit, like a successful one.
+	primary.set(errors.New("down"))
+	b.Write(ctx, batch)
+	b.Write(ctx, batch)
+	primary.set(Permanent(errors.New("bad batch")))
+	b.mu.Lock()
+	b.openedAt = time.Now().Add(-2 * time.Hour)
+	b.mu.Unlock()
+	b.Write(ctx, batch)
+	if s := b.Stats(); s.State != BreakerClosed || s.Opened != 1 {
+		t.Errorf("stats = %+v after a rejected probe, want a closed circuit", s)
+	}
+}
+
+func TestBreakerSinkFallbackChain(t *testing.T) {
+	primary := &switchSink{err: errors.New("primary down")}
+	first, second := &switchSink{err: errors.New("first down")}, &memorySink{}
+	b := NewBreakerSink(primary).WithThreshold(1).WithCooldown(time.Hour).WithFallback(first, second)
+	ctx := context.Background()
+	batch := testSnapshots(1)
+
+	if err := b.Write(ctx, batch); err != nil {
+		t.Fatalf("write: %v, want the second fallback to take the batch", err)
+	}
+	if first.count() != 1 || second.len() != len(batch) {
+		t.Errorf("fallbacks written %d and %d times", first.count(), second.len())
+	}
+	if s := b.Stats(); s.FallbackErrors != 1 || s.FallbackWrites != 1 {
+		t.Errorf("stats = %+v, want one fallback error and one write", s)
+	}
+
+	// Once every fallback fails, the errors are all reported.
+	b.WithFallback(first)
+	err := b.Write(ctx, batch)
+	if err == nil || !strings.Contains(err.Error(), "circuit open") || !strings.Contains(err.Error(), "first down") {
+		t.Errorf("write = %v, want the circuit and fallback errors", err)
+	}
+
+	// Without fallbacks, the error of the sink is returned as is.
+	bare := NewBreakerSink(primary)
+	if err := bare.Write(ctx, batch); err == nil || err.Error() != "primary down" {
+		t.Errorf("write = %v, want the sink error", err)
+	}
+}
+
+func TestBreakerStatsThroughWrappers(t *testing.T) {
+	primary := &switchSink{err: errors.New("down")}
+	breaker := NewBreakerSink(primary).WithThreshold(1).WithCooldown(time.Hour)
+
+	for name, sink := range map[string]Sink{
+		"direct":  breaker,
+		"wrapped": NewRetrySink(breaker).WithAttempts(1),
+	} {
+		t.Run(name, func(t *testing.T) {
+			b := NewBatcher(sink).WithErrorHandler(func(error) {})
+			c := New(WithObserver(b.Observer()))
+			c.Info("event").Emit()
+			c.Flush()
+			defer c.Close()
+
+			stats := c.Stats().Observers[0].Breaker
+			if stats == nil || stats.State != BreakerOpen {
+				t.Fatalf("breaker stats = %+v, want an open circuit", stats)
+			}
+		})
+	}
+
+	if _, ok := breakerStats(NewRetrySink(&memorySink{})); ok {
+		t.Error("stats found without a breaker")
+	}
+}
@@ -0,0 +1,111 @@
+package skylight
+
+import (
+	"runtime"
+	"strings"
+)
+
+// maxStackDepth is the number of program counters captured per event.
+const maxStackDepth = 32
+
+// Frame describes a single frame of the call stack an event was emitted from.
+type Frame struct {
+	Function string `json:"function"`
+	Package  string `json:"package"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+func (c *Client) capturesCaller(level Level) bool {
+	return c.callerLevel != LevelNone && level >= c.callerLevel
+}
+
+func (c *Client) capturesStack(level Level) bool {
+	return c.stackLevel != LevelNone && level >= c.stackLevel
+}
+
+// capture records the program counters of the current goroutine, when the client captures the caller or the stack of
+// events of this level. It is called when the event is emitted and an observer takes it, or turned into an error, so
+// that the level it ends up with applies. The frames are only resolved when read.
+//
+// skip is the number of frames above the caller of capture that belong to skylight, e.g. 1 for Emit calling emit, so
+// that the first frame kept is the one that called into skylight. Frames are skipped by count rather than by package,
+// so that code in package skylight, such as its tests, is reported like any other.
+func (e *Event) capture(skip int) {
+	e.hasCaller = e.c.capturesCaller(e.level)
+	e.hasStack = e.c.capturesStack(e.level)
+	if e.hasCaller || e.hasStack {
+		// Skip runtime.Callers, capture and its caller.
+		e.npcs = runtime.Callers(skip+3, e.pcs[:])
+	}
+}
+
+// resolveFrames symbolizes the captured program counters, skipping the client's caller skip. Leading runtime frames
+// are skipped too, so that the stack of an event emitted while recovering a panic starts where the panic happened.
+func (e *Event) resolveFrames() []Frame {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.frames) > 0 || e.npcs == 0 {
+		return e.frames
+	}
+
+	skip := e.c.callerSkip
+	leading := true
+	frames := runtime.CallersFrames(e.pcs[:e.npcs])
+	for {
+		f, more := frames.Next()
+		if leading && strings.HasPrefix(f.Function, "runtime.") {
+			if !more {
+				break
+			}
+			continue
+		}
+		leading = false
+		if skip > 0 {
+			skip--
+		} else {
+			e.frames = append(e.frames, Frame{
+				Function: f.Function,
+				Package:  funcPackage(f.Function),
+				File:     f.File,
+				Line:     f.Line,
+			})
+		}
+		if !more {
+			break
+		}
+	}
+	return e.frames
+}
+
+// funcPackage returns the package path of a fully qualified function name.
+func funcPackage(fn string) string {
+	slash := strings.LastIndex(fn, "/")
+	if dot := strings.Index(fn[slash+1:], "."); dot >= 0 {
+		return fn[:slash+1+dot]
+	}
+	return fn
+}
+
+// Caller returns the frame the event was emitted from, i.e. the caller of Emit or AsError, rather than the frame that
+// created the event. It reports false when caller capture is disabled for the event level, or the event was not
+// emitted yet.
+func (e *Event) Caller() (Frame, bool) {
+	if !e.live() || !e.hasCaller {
+		return Frame{}, false
+	}
+	frames := e.resolveFrames()
+	if len(frames) == 0 {
+		return Frame{}, false
+	}
+	return frames[0], true
+}
+
+// Stack returns the call stack the event was emitted from, starting with the frame of Caller, or nil when stack
+// capture is disabled for the event level or the event was not emitted yet.
+func (e *Event) Stack() []Frame {
+	if !e.live() || !e.hasStack {
+		return nil
+	}
+	return e.resolveFrames()
+}
@@ -0,0 +1,42 @@
+package skylight_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/benchatech/skylight"
+)
+
+func TestStackUsesEmitLevel(t *testing.T) {
+	var stack []skylight.Frame
+	c := skylight.New(skylight.WithObserver(skylight.WildcardObserver(func(e *skylight.Event) { stack = e.Stack() })))
+
+	c.Info("created at info").Level(skylight.LevelError).Emit()
+	if len(stack) == 0 || !strings.HasSuffix(stack[0].Function, "TestStackUsesEmitLevel") {
+		t.Errorf("stack = %v, want one starting in the test", stack)
+	}
+
+	stack = nil
+	c.Error("created at error").Level(skylight.LevelInfo).Emit()
+	if stack != nil {
+		t.Errorf("stack = %v, want none below the stack level", stack)
+	}
+}
+
+func TestCallerConcurrentReads(t *testing.T) {
+	c := skylight.New(skylight.WithCaller(skylight.LevelInfo), skylight.WithObserver(skylight.WildcardObserver(func(e *skylight.Event) {})))
+	e := c.Info("held").Emit(true)
+	done := make(chan skylight.Frame)
+	for i := 0; i < 4; i++ {
+		go func() {
+			f, _ := e.Caller()
+			done <- f
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		if f := <-done; !strings.HasSuffix(f.Function, "TestCallerConcurrentReads") {
+			t.Errorf("caller = %v, want the test", f)
+		}
+	}
+	e.Evict()
+}
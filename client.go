@@ -2,7 +2,9 @@ package skylight
 
 import (
 	"fmt"
+	"os"
 	"slices"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 )
@@ -26,7 +28,7 @@ func (l Level) String() string {
 	case LevelFatal:
 		return "fatal"
 	case LevelPanic:
-		return "fatal"
+		return "panic"
 	case LevelNone:
 		return ""
 	default:
@@ -34,6 +36,49 @@ func (l Level) String() string {
 	}
 }
 
+// MarshalText implements encoding.TextMarshaler, so that levels are encoded by name, e.g. in JSON.
+func (l Level) MarshalText() ([]byte, error) {
+	if l < LevelNone || l > LevelPanic {
+		return nil, fmt.Errorf("skylight: invalid level %d", int(l))
+	}
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, see ParseLevel.
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// ParseLevel returns the level with the given name, as returned by Level.String. It is case insensitive, and accepts
+// "warning" for LevelWarn and "none" or "" for LevelNone.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "trace":
+		return LevelTrace, nil
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	case "fatal":
+		return LevelFatal, nil
+	case "panic":
+		return LevelPanic, nil
+	case "", "none":
+		return LevelNone, nil
+	default:
+		return LevelNone, fmt.Errorf("skylight: unknown level %q", s)
+	}
+}
+
 const (
 	// LevelNone represents no logging (no-op).
 	LevelNone Level = iota
@@ -61,13 +106,45 @@ const (
 )
 
 type Client struct {
-	level     Level
-	observers []*Observer
+	level       Level
+	observers   []*Observer
+	recorder    *FlightRecorder
+	idGen       IDGenerator
+	callerLevel Level
+	stackLevel  Level
+	callerSkip  int
+	debugEvents bool
+	exitFunc    func(code int)
+	panicFunc   func(err error)
+	resource    *Resource
+	enrichers   []Enricher
+	stats       clientStats
+}
+
+// PanicError is the value the client panics with after a panic event has been emitted.
+// The event is not recycled, so it can still be inspected by whoever recovers the panic.
+type PanicError struct {
+	Event *Event
+}
+
+func (e *PanicError) Error() string {
+	if e == nil || e.Event == nil {
+		return "skylight: panic"
+	}
+	if e.Event.topic != "" {
+		return fmt.Sprintf("skylight: panic: [%s] %s", e.Event.topic, e.Event.msg())
+	}
+	return "skylight: panic: " + e.Event.msg()
 }
 
 func New(opts ...Option) *Client {
 	c := &Client{
-		level: LevelInfo,
+		level:       LevelInfo,
+		idGen:       defaultIDGenerator,
+		stackLevel:  LevelError,
+		debugEvents: debugEvents,
+		exitFunc:    os.Exit,
+		panicFunc:   func(err error) { panic(err) },
 	}
 
 	for _, opt := range opts {
@@ -93,6 +170,162 @@ func (c *Client) WithLevel(level Level) *Client {
 	return c
 }
 
+// minLevel returns the level events must reach to be sent to observers, lowered to verbosity unless it is LevelNone.
+func (c *Client) minLevel(verbosity Level) Level {
+	if verbosity != LevelNone && verbosity < c.level {
+		return verbosity
+	}
+	return c.level
+}
+
+// WithFlightRecorder attaches a flight recorder to the client.
+// Events below the client level are still captured by the recorder, but are not sent to observers.
+func (c *Client) WithFlightRecorder(r *FlightRecorder) *Client {
+	if c == nil {
+		return nil
+	}
+	c.recorder = r
+	return c
+}
+
+// flightRecorder returns the flight recorder of c, or nil when it has none.
+func (c *Client) flightRecorder() *FlightRecorder {
+	if c == nil {
+		return nil
+	}
+	return c.recorder
+}
+
+// WithIDGenerator sets the generator used for event IDs.
+func (c *Client) WithIDGenerator(gen IDGenerator) *Client {
+	if c == nil {
+		return nil
+	}
+	c.idGen = gen
+	return c
+}
+
+func (c *Client) newID() string {
+	if c == nil || c.idGen == nil {
+		return defaultIDGenerator()
+	}
+	return c.idGen()
+}
+
+// WithCaller captures the caller of events at level or above. LevelNone disables caller capture, which is the default.
+func (c *Client) WithCaller(level Level) *Client {
+	if c == nil {
+		return nil
+	}
+	c.callerLevel = level
+	return c
+}
+
+// WithStack captures the call stack of events at level or above. It defaults to LevelError; LevelNone disables stack capture.
+func (c *Client) WithStack(level Level) *Client {
+	if c == nil {
+		return nil
+	}
+	c.stackLevel = level
+	return c
+}
+
+// WithCallerSkip skips n additional frames when resolving the caller and stack, so that wrappers report their own caller.
+func (c *Client) WithCallerSkip(n int) *Client {
+	if c == nil {
+		return nil
+	}
+	c.callerSkip = n
+	return c
+}
+
+// WithDebugEvents enables or disables use-after-emit detection.
+// When enabled, emitted events are not recycled and using one panics with the stack of the call that emitted it.
+// It is enabled by default when building with the skylightdebug tag.
+func (c *Client) WithDebugEvents(enabled bool) *Client {
+	if c == nil {
+		return nil
+	}
+	c.debugEvents = enabled
+	return c
+}
+
+// WithExitFunc sets the function called with exit code 1 after a fatal event has been emitted and the observers flushed.
+// It defaults to os.Exit.
+func (c *Client) WithExitFunc(fn func(code int)) *Client {
+	if c == nil {
+		return nil
+	}
+	c.exitFunc = fn
+	return c
+}
+
+// WithPanicFunc sets the function called with a *PanicError after a panic event has been emitted and the observers flushed.
+// It defaults to calling panic with the error. When fn returns, the event is recycled like any other emitted event.
+func (c *Client) WithPanicFunc(fn func(err error)) *Client {
+	if c == nil {
+		return nil
+	}
+	c.panicFunc = fn
+	return c
+}
+
+// WithResource sets the resource describing the process, e.g. DetectResource(). It is kept apart from the event fields:
+// observers read it with Event.Resource, and snapshots and sinks carry it once per batch.
+func (c *Client) WithResource(r *Resource) *Client {
+	if c == nil {
+		return nil
+	}
+	c.resource = r
+	return c
+}
+
+// WithEnricher adds functions run on every event when it is emitted, before any observer sees it.
+func (c *Client) WithEnricher(fn ...Enricher) *Client {
+	if c == nil {
+		return nil
+	}
+	c.enrichers = append(c.enrichers, fn...)
+	return c
+}
+
+// Flush flushes every observer that buffers events.
+func (c *Client) Flush() {
+	if c == nil {
+		return
+	}
+	for _, o := range c.observers {
+		if o.flush != nil {
+			o.flush()
+		}
+	}
+}
+
+// Close flushes and then closes every observer, e.g. the sinks run by a Batcher. The client must not be used afterwards.
+func (c *Client) Close() {
+	if c == nil {
+		return
+	}
+	c.Flush()
+	for _, o := range c.observers {
+		if o.close != nil {
+			o.close()
+		}
+	}
+}
+
+func (c *Client) exit(code int) {
+	if c.exitFunc != nil {
+		c.exitFunc(code)
+	}
+}
+
+func (c *Client) panic(err error) {
+	if c.panicFunc != nil {
+		c.panicFunc(err)
+	}
+}
+
 func (c *Client) WithStandardLogger() *Client {
 	if c == nil {
 		return nil
@@ -110,14 +343,14 @@ func (c *Client) WithStandardLogger() *Client {
 			id:   "logger",
 			cond: func(e *Event) bool { return true },
 			handler: func(e *Event) {
-				fields := map[string]any{}
-				if len(e.fields) > 0 {
-					fields = e.fields
-				}
+				fields := logrus.Fields(e.fieldMap())
 				if e.parentID != "" {
 					fields["parentID"] = e.parentID
 				}
-				message := e.message
+				if f, ok := e.Caller(); ok {
+					fields["caller"] = fmt.Sprintf("%s:%d", f.File, f.Line)
+				}
+				message := e.msg()
 				if e.topic != "" {
 					message = fmt.Sprintf("[%s] %s", e.topic, message)
 				}
@@ -134,9 +367,14 @@ func (c *Client) WithStandardLogger() *Client {
 				case LevelError:
 					logger.WithFields(fields).Error(message)
 				case LevelFatal:
-					logger.WithFields(fields).Fatal(message)
+					// Exiting is left to the client, so the entry is logged without calling logger.Exit.
+					logger.WithFields(fields).Log(logrus.FatalLevel, message)
 				case LevelPanic:
-					logger.WithFields(fields).Panic(message)
+					// logrus panics after writing panic entries; the client panics itself once every observer has run.
+					func() {
+						defer func() { recover() }()
+						logger.WithFields(fields).Panic(message)
+					}()
 				}
 			},
 		})
@@ -148,169 +386,169 @@ func (c *Client) WithStandardLogger() *Client {
 // Trace creates a new event with the trace level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
 func (c *Client) Trace(args ...any) *Event {
-	return newEvent(LevelTrace, fmt.Sprint(args...), c)
+	return newEvent(LevelTrace, c).print(args)
 }
 
 // Tracef creates a new event with the trace level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
 func (c *Client) Tracef(v string, args ...any) *Event {
-	return newEvent(LevelTrace, fmt.Sprintf(v, args...), c)
+	return newEvent(LevelTrace, c).printf(v, args)
 }
 
 // Debug creates a new event with the debug level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
 func (c *Client) Debug(args ...any) *Event {
-	return newEvent(LevelDebug, fmt.Sprint(args...), c)
+	return newEvent(LevelDebug, c).print(args)
 }
 
 // Debugf creates a new event with the debug level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
 func (c *Client) Debugf(v string, args ...any) *Event {
-	return newEvent(LevelDebug, fmt.Sprintf(v, args...), c)
+	return newEvent(LevelDebug, c).printf(v, args)
 }
 
 // Info creates a new event with the info level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
 func (c *Client) Info(args ...any) *Event {
-	return newEvent(LevelInfo, fmt.Sprint(args...), c)
+	return newEvent(LevelInfo, c).print(args)
 }
 
 // Infof creates a new event with the info level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
 func (c *Client) Infof(v string, args ...any) *Event {
-	return newEvent(LevelInfo, fmt.Sprintf(v, args...), c)
+	return newEvent(LevelInfo, c).printf(v, args)
 }
 
 // Warn creates a new event with the warn level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
 func (c *Client) Warn(args ...any) *Event {
-	return newEvent(LevelWarn, fmt.Sprint(args...), c)
+	return newEvent(LevelWarn, c).print(args)
 }
 
 // Warnf creates a new event with the warn level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
 func (c *Client) Warnf(v string, args ...any) *Event {
-	return newEvent(LevelWarn, fmt.Sprintf(v, args...), c)
+	return newEvent(LevelWarn, c).printf(v, args)
 }
 
 // Error creates a new event with the error level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
 func (c *Client) Error(args ...any) *Event {
-	return newEvent(LevelError, fmt.Sprint(args...), c)
+	return newEvent(LevelError, c).print(args)
 }
 
 // Errorf creates a new event with the error level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
 func (c *Client) Errorf(v string, args ...any) *Event {
-	return newEvent(LevelError, fmt.Sprintf(v, args...), c)
+	return newEvent(LevelError, c).printf(v, args)
 }
 
 // Fatal creates a new event with the fatal level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
 func (c *Client) Fatal(args ...any) *Event {
-	return newEvent(LevelFatal, fmt.Sprint(args...), c)
+	return newEvent(LevelFatal, c).print(args)
 }
 
 // Fatalf creates a new event with the fatal level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
 func (c *Client) Fatalf(v string, args ...any) *Event {
-	return newEvent(LevelFatal, fmt.Sprintf(v, args...), c)
+	return newEvent(LevelFatal, c).printf(v, args)
 }
 
 // Panic creates a new event with the panic level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
 func (c *Client) Panic(args ...any) *Event {
-	return newEvent(LevelPanic, fmt.Sprint(args...), c)
+	return newEvent(LevelPanic, c).print(args)
 }
 
 // Panicf creates a new event with the panic level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
 func (c *Client) Panicf(v string, args ...any) *Event {
-	return newEvent(LevelPanic, fmt.Sprintf(v, args...), c)
+	return newEvent(LevelPanic, c).printf(v, args)
 }
 
 // Trace creates a new event with the trace level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
 func Trace(args ...any) *Event {
-	return newEvent(LevelTrace, fmt.Sprint(args...), defaultClient)
+	return newEvent(LevelTrace, defaultClient).print(args)
 }
 
 // Tracef creates a new event with the trace level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
 func Tracef(v string, args ...any) *Event {
-	return newEvent(LevelTrace, fmt.Sprintf(v, args...), defaultClient)
+	return newEvent(LevelTrace, defaultClient).printf(v, args)
 }
 
 // Debug creates a new event with the debug level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
 func Debug(args ...any) *Event {
-	return newEvent(LevelDebug, fmt.Sprint(args...), defaultClient)
+	return newEvent(LevelDebug, defaultClient).print(args)
 }
 
 // Debugf creates a new event with the debug level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
 func Debugf(v string, args ...any) *Event {
-	return newEvent(LevelDebug, fmt.Sprintf(v, args...), defaultClient)
+	return newEvent(LevelDebug, defaultClient).printf(v, args)
 }
 
 // Info creates a new event with the info level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
 func Info(args ...any) *Event {
-	return newEvent(LevelInfo, fmt.Sprint(args...), defaultClient)
+	return newEvent(LevelInfo, defaultClient).print(args)
 }
 
 // Infof creates a new event with the info level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
 func Infof(v string, args ...any) *Event {
-	return newEvent(LevelInfo, fmt.Sprintf(v, args...), defaultClient)
+	return newEvent(LevelInfo, defaultClient).printf(v, args)
 }
 
 // Warn creates a new event with the warn level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
 func Warn(args ...any) *Event {
-	return newEvent(LevelWarn, fmt.Sprint(args...), defaultClient)
+	return newEvent(LevelWarn, defaultClient).print(args)
 }
 
 // Warnf creates a new event with the warn level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
 func Warnf(v string, args ...any) *Event {
-	return newEvent(LevelWarn, fmt.Sprintf(v, args...), defaultClient)
+	return newEvent(LevelWarn, defaultClient).printf(v, args)
 }
 
 // Error creates a new event with the error level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
 func Error(args ...any) *Event {
-	return newEvent(LevelError, fmt.Sprint(args...), defaultClient)
+	return newEvent(LevelError, defaultClient).print(args)
 }
 
 // Errorf creates a new event with the error level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
 func Errorf(v string, args ...any) *Event {
-	return newEvent(LevelError, fmt.Sprintf(v, args...), defaultClient)
+	return newEvent(LevelError, defaultClient).printf(v, args)
 }
 
 // Fatal creates a new event with the fatal level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
 func Fatal(args ...any) *Event {
-	return newEvent(LevelFatal, fmt.Sprint(args...), defaultClient)
+	return newEvent(LevelFatal, defaultClient).print(args)
 }
 
 // Fatalf creates a new event with the fatal level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
 func Fatalf(v string, args ...any) *Event {
-	return newEvent(LevelFatal, fmt.Sprintf(v, args...), defaultClient)
+	return newEvent(LevelFatal, defaultClient).printf(v, args)
 }
 
 // Panic creates a new event with the panic level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
 func Panic(args ...any) *Event {
-	return newEvent(LevelPanic, fmt.Sprint(args...), defaultClient)
+	return newEvent(LevelPanic, defaultClient).print(args)
 }
 
 // Panicf creates a new event with the panic level and associates it with the client.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
 func Panicf(v string, args ...any) *Event {
-	return newEvent(LevelPanic, fmt.Sprintf(v, args...), defaultClient)
+	return newEvent(LevelPanic, defaultClient).printf(v, args)
 }
 
 func Default() *Client {
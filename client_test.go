@@ -0,0 +1,53 @@
+package skylight
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFatalCallsExitFunc(t *testing.T) {
+	code := -1
+	c := New(WithExitFunc(func(n int) { code = n })).WithStandardLogger()
+
+	if e := c.Fatal("fatal").Emit(); e != nil {
+		t.Error("Emit returned the event after the exit function returned")
+	}
+	if code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+}
+
+func TestPanicCallsPanicFunc(t *testing.T) {
+	var pe *PanicError
+	c := New(WithPanicFunc(func(err error) {
+		if !errors.As(err, &pe) {
+			t.Fatalf("panic func called with %T, want *PanicError", err)
+		}
+		if got, want := pe.Error(), "skylight: panic: [test] boom"; got != want {
+			t.Errorf("Error() = %q, want %q", got, want)
+		}
+	})).WithStandardLogger()
+
+	// The standard logger recovers the panic of logrus, so that the panic func is the only one deciding to panic.
+	e := c.Panic("boom").Topic("test").Emit()
+	if pe == nil {
+		t.Fatal("panic func not called")
+	}
+	if e != nil {
+		t.Error("event not recycled after the panic func returned")
+	}
+}
+
+func TestPanicKeepsEventForRecover(t *testing.T) {
+	c := New()
+	defer func() {
+		pe, ok := recover().(*PanicError)
+		if !ok {
+			t.Fatal("client did not panic with a *PanicError")
+		}
+		if got := pe.Event.ID(); got == "" {
+			t.Error("event recycled before the panic was recovered")
+		}
+	}()
+	c.Panic("boom").Emit()
+}
@@ -0,0 +1,23 @@
+package skylight
+
+import "context"
+
+type eventKey struct{}
+
+// ContextWithEvent returns a copy of ctx carrying e, e.g. the event of a request, so that code down the call chain can
+// create children of it with EventFromContext. Since the context may outlive the event, e.g. in goroutines started by
+// a request handler, e is not recycled: children can still be created from it once it was emitted or evicted.
+func ContextWithEvent(ctx context.Context, e *Event) context.Context {
+	if e.live() {
+		e.escaped = true
+		// The context gets a handle of its own, so that it doesn't keep a block of handles, see handleBlock.
+		e = &Event{event: e.event, gen: e.gen}
+	}
+	return context.WithValue(ctx, eventKey{}, e)
+}
+
+// EventFromContext returns the event carried by ctx, or nil. Creating children of a nil event is a no-op.
+func EventFromContext(ctx context.Context) *Event {
+	e, _ := ctx.Value(eventKey{}).(*Event)
+	return e
+}
@@ -0,0 +1,6 @@
+//go:build skylightdebug
+
+package skylight
+
+// debugEvents enables use-after-emit detection on new clients.
+const debugEvents = true
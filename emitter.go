@@ -0,0 +1,180 @@
+package skylight
+
+// Emitter creates events on behalf of a client, stamping each of them with bound fields, a topic and a parent.
+// It shares the observers and level of its client, and is cheap enough to create per request.
+type Emitter struct {
+	c          *Client
+	fields     []Field
+	topic      string
+	parentID   string
+	traceID    string
+	traceState string
+}
+
+// With returns an emitter that stamps fields on every event it creates.
+func (c *Client) With(fields Fields) *Emitter {
+	return c.emitter().With(fields)
+}
+
+// WithTopic returns an emitter that sets topic on every event it creates.
+func (c *Client) WithTopic(topic string) *Emitter {
+	return c.emitter().WithTopic(topic)
+}
+
+// WithParent returns an emitter that sets the parent ID, and the trace, of every event it creates, see Event.ParentID.
+func (c *Client) WithParent(id string, traceID ...string) *Emitter {
+	return c.emitter().WithParent(id, traceID...)
+}
+
+func (c *Client) emitter() *Emitter {
+	if c == nil {
+		return nil
+	}
+	return &Emitter{c: c}
+}
+
+// With returns a copy of the emitter with fields added to its bound fields. Fields with the same key are replaced.
+func (em *Emitter) With(fields Fields) *Emitter {
+	if em == nil {
+		return nil
+	}
+	d := *em
+	d.fields = make([]Field, len(em.fields), len(em.fields)+len(fields))
+	copy(d.fields, em.fields)
+	for k, v := range fields {
+		d.fields = setField(d.fields, anyField(k, v))
+	}
+	return &d
+}
+
+// WithTopic returns a copy of the emitter bound to topic.
+func (em *Emitter) WithTopic(topic string) *Emitter {
+	if em == nil {
+		return nil
+	}
+	d := *em
+	d.topic = topic
+	return &d
+}
+
+// WithParent returns a copy of the emitter bound to the parent ID id and the trace traceID, see Event.ParentID.
+func (em *Emitter) WithParent(id string, traceID ...string) *Emitter {
+	if em == nil {
+		return nil
+	}
+	d := *em
+	d.parentID = id
+	d.traceID, d.traceState = "", ""
+	if len(traceID) > 0 {
+		d.traceID = traceID[0]
+	}
+	return &d
+}
+
+// Client returns the client the emitter creates events for.
+func (em *Emitter) Client() *Client {
+	if em == nil {
+		return nil
+	}
+	return em.c
+}
+
+func (em *Emitter) newEvent(level Level) *Event {
+	if em == nil {
+		return nil
+	}
+	e := newEvent(level, em.c)
+	if e == nil {
+		return nil
+	}
+	e.fields = append(e.fields, em.fields...)
+	e.topic = em.topic
+	e.parentID = em.parentID
+	e.traceID = em.traceID
+	e.traceState = em.traceState
+	return e
+}
+
+// Trace creates a new event with the trace level, stamped with the emitter's bound fields, topic and parent.
+// It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
+func (em *Emitter) Trace(args ...any) *Event {
+	return em.newEvent(LevelTrace).print(args)
+}
+
+// Tracef creates a new event with the trace level, stamped with the emitter's bound fields, topic and parent.
+// It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
+func (em *Emitter) Tracef(v string, args ...any) *Event {
+	return em.newEvent(LevelTrace).printf(v, args)
+}
+
+// Debug creates a new event with the debug level, stamped with the emitter's bound fields, topic and parent.
+// It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
+func (em *Emitter) Debug(args ...any) *Event {
+	return em.newEvent(LevelDebug).print(args)
+}
+
+// Debugf creates a new event with the debug level, stamped with the emitter's bound fields, topic and parent.
+// It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
+func (em *Emitter) Debugf(v string, args ...any) *Event {
+	return em.newEvent(LevelDebug).printf(v, args)
+}
+
+// Info creates a new event with the info level, stamped with the emitter's bound fields, topic and parent.
+// It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
+func (em *Emitter) Info(args ...any) *Event {
+	return em.newEvent(LevelInfo).print(args)
+}
+
+// Infof creates a new event with the info level, stamped with the emitter's bound fields, topic and parent.
+// It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
+func (em *Emitter) Infof(v string, args ...any) *Event {
+	return em.newEvent(LevelInfo).printf(v, args)
+}
+
+// Warn creates a new event with the warn level, stamped with the emitter's bound fields, topic and parent.
+// It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
+func (em *Emitter) Warn(args ...any) *Event {
+	return em.newEvent(LevelWarn).print(args)
+}
+
+// Warnf creates a new event with the warn level, stamped with the emitter's bound fields, topic and parent.
+// It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
+func (em *Emitter) Warnf(v string, args ...any) *Event {
+	return em.newEvent(LevelWarn).printf(v, args)
+}
+
+// Error creates a new event with the error level, stamped with the emitter's bound fields, topic and parent.
+// It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
+func (em *Emitter) Error(args ...any) *Event {
+	return em.newEvent(LevelError).print(args)
+}
+
+// Errorf creates a new event with the error level, stamped with the emitter's bound fields, topic and parent.
+// It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
+func (em *Emitter) Errorf(v string, args ...any) *Event {
+	return em.newEvent(LevelError).printf(v, args)
+}
+
+// Fatal creates a new event with the fatal level, stamped with the emitter's bound fields, topic and parent.
+// It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
+func (em *Emitter) Fatal(args ...any) *Event {
+	return em.newEvent(LevelFatal).print(args)
+}
+
+// Fatalf creates a new event with the fatal level, stamped with the emitter's bound fields, topic and parent.
+// It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
+func (em *Emitter) Fatalf(v string, args ...any) *Event {
+	return em.newEvent(LevelFatal).printf(v, args)
+}
+
+// Panic creates a new event with the panic level, stamped with the emitter's bound fields, topic and parent.
+// It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new event.
+func (em *Emitter) Panic(args ...any) *Event {
+	return em.newEvent(LevelPanic).print(args)
+}
+
+// Panicf creates a new event with the panic level, stamped with the emitter's bound fields, topic and parent.
+// It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new event.
+func (em *Emitter) Panicf(v string, args ...any) *Event {
+	return em.newEvent(LevelPanic).printf(v, args)
+}
@@ -0,0 +1,85 @@
+package skylight
+
+import (
+	"fmt"
+	"testing"
+)
+
+// fieldValues returns the fields of s keyed by name, formatted with fmt.Sprint.
+func fieldValues(s EventSnapshot) map[string]string {
+	m := make(map[string]string, len(s.Fields))
+	for _, f := range s.Fields {
+		m[f.Key] = fmt.Sprint(f.Value())
+	}
+	return m
+}
+
+func TestEmitterStampsEvents(t *testing.T) {
+	var events []EventSnapshot
+	c := New(WithObserver(WildcardObserver(func(e *Event) { events = append(events, e.Snapshot()) })))
+
+	base := c.With(Fields{"service": "api", "region": "eu"})
+	db := base.With(Fields{"region": "us", "table": "users"}).WithTopic("db")
+	cache := base.WithTopic("cache")
+
+	db.Info("query").Emit()
+	cache.Warn("miss").Emit()
+	base.Error("failed").Emit()
+
+	tests := []struct {
+		topic  string
+		level  Level
+		fields map[string]string
+	}{
+		{"db", LevelInfo, map[string]string{"service": "api", "region": "us", "table": "users"}},
+		{"cache", LevelWarn, map[string]string{"service": "api", "region": "eu"}},
+		{"", LevelError, map[string]string{"service": "api", "region": "eu"}},
+	}
+	if len(events) != len(tests) {
+		t.Fatalf("emitted %d events, want %d", len(events), len(tests))
+	}
+	for i, tt := range tests {
+		e := events[i]
+		if e.Topic != tt.topic || e.Level != tt.level {
+			t.Errorf("event %q: topic %q at %v, want %q at %v", e.Message, e.Topic, e.Level, tt.topic, tt.level)
+		}
+		if got := fieldValues(e); fmt.Sprint(got) != fmt.Sprint(tt.fields) {
+			t.Errorf("event %q: fields %v, want %v", e.Message, got, tt.fields)
+		}
+	}
+}
+
+func TestEmitterDerivingKeepsParent(t *testing.T) {
+	c := New()
+	parent := c.With(Fields{"a": 1}).WithTopic("parent")
+	parent = parent.With(Fields{"b": 2})
+
+	// Two children derived from the same parent must not share the parent's fields slice.
+	one := parent.With(Fields{"c": 3}).WithTopic("one")
+	two := parent.With(Fields{"c": 4, "a": 5})
+
+	if parent.topic != "parent" || len(parent.fields) != 2 {
+		t.Errorf("parent changed to topic %q and fields %v", parent.topic, parent.fields)
+	}
+	for _, f := range parent.fields {
+		if f.Key == "a" && fmt.Sprint(f.Value()) != "1" {
+			t.Errorf("parent field a = %v, want 1", f.Value())
+		}
+	}
+	if one.topic != "one" || two.topic != "parent" {
+		t.Errorf("topics %q and %q, want one and parent", one.topic, two.topic)
+	}
+	for _, f := range one.fields {
+		if f.Key == "c" && fmt.Sprint(f.Value()) != "3" {
+			t.Errorf("field c of the first child = %v, want 3", f.Value())
+		}
+	}
+
+	if c.With(nil).Client() != c {
+		t.Error("emitter not bound to its client")
+	}
+	var nilClient *Client
+	if nilClient.With(Fields{"a": 1}).WithTopic("t").Info("x") != nil {
+		t.Error("nil client emitter created an event")
+	}
+}
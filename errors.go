@@ -0,0 +1,262 @@
+package skylight
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// maxErrorDepth bounds how deep error trees are walked, in case an error wraps itself.
+const maxErrorDepth = 32
+
+// ErrorFielder is implemented by errors that contribute their own fields to the events they are logged with.
+type ErrorFielder interface {
+	ErrorFields() Fields
+}
+
+// StackTracer is implemented by errors that carry the call stack they were created from.
+// Errors with a StackTrace method returning program counters, such as those of github.com/pkg/errors, are supported as well.
+type StackTracer interface {
+	StackTrace() []Frame
+}
+
+// ErrorInfo is the structured rendering of an error.
+type ErrorInfo struct {
+	// Message is the text returned by Error.
+	Message string `json:"message"`
+	// Type is the Go type of the error.
+	Type string `json:"type"`
+	// Stack is the call stack carried by the error, if any.
+	Stack []Frame `json:"stack,omitempty"`
+	// Cause is the error returned by Unwrap() error, if any.
+	Cause *ErrorInfo `json:"cause,omitempty"`
+	// Errors are the errors returned by Unwrap() []error, e.g. by errors created with errors.Join.
+	Errors []ErrorInfo `json:"errors,omitempty"`
+}
+
+// RenderError returns the structured rendering of err, walking its unwrap chain and joined errors.
+// It returns nil for a nil error.
+func RenderError(err error) *ErrorInfo {
+	if err == nil {
+		return nil
+	}
+	info := renderError(err, 0)
+	return &info
+}
+
+func renderError(err error, depth int) ErrorInfo {
+	if de, ok := err.(*decodedError); ok {
+		return de.info
+	}
+	info := ErrorInfo{
+		Message: err.Error(),
+		Type:    fmt.Sprintf("%T", err),
+		Stack:   errorStack(err),
+	}
+	if depth >= maxErrorDepth {
+		return info
+	}
+
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		if cause := u.Unwrap(); cause != nil {
+			c := renderError(cause, depth+1)
+			info.Cause = &c
+		}
+	case interface{ Unwrap() []error }:
+		for _, e := range u.Unwrap() {
+			if e != nil {
+				info.Errors = append(info.Errors, renderError(e, depth+1))
+			}
+		}
+	}
+	return info
+}
+
+// Chain returns the errors of the unwrap chain, starting with the error itself.
+func (i *ErrorInfo) Chain() []ErrorInfo {
+	var chain []ErrorInfo
+	for ; i != nil; i = i.Cause {
+		chain = append(chain, *i)
+	}
+	return chain
+}
+
+// errorStack returns the stack carried by err, if any.
+func errorStack(err error) []Frame {
+	if st, ok := err.(StackTracer); ok {
+		return st.StackTrace()
+	}
+
+	// Look for a StackTrace method returning a slice of program counters, without depending on the packages defining them.
+	m := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return nil
+	}
+	out := m.Type().Out(0)
+	if out.Kind() != reflect.Slice || out.Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+	v := m.Call(nil)[0]
+	pcs := make([]uintptr, v.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(v.Index(i).Uint())
+	}
+	return framesForPCs(pcs)
+}
+
+func framesForPCs(pcs []uintptr) []Frame {
+	if len(pcs) == 0 {
+		return nil
+	}
+	var out []Frame
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		out = append(out, Frame{
+			Function: f.Function,
+			Package:  funcPackage(f.Function),
+			File:     f.File,
+			Line:     f.Line,
+		})
+		if !more {
+			return out
+		}
+	}
+}
+
+// errorFields collects the fields contributed by err and the errors it wraps.
+// Fields of outer errors take precedence over those of the errors they wrap.
+func errorFields(err error, depth int, fields []Field) []Field {
+	if err == nil || depth > maxErrorDepth {
+		return fields
+	}
+
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		fields = errorFields(u.Unwrap(), depth+1, fields)
+	case interface{ Unwrap() []error }:
+		for _, e := range u.Unwrap() {
+			fields = errorFields(e, depth+1, fields)
+		}
+	}
+
+	if ef, ok := err.(ErrorFielder); ok {
+		for k, v := range ef.ErrorFields() {
+			fields = setField(fields, anyField(k, v))
+		}
+	}
+	return fields
+}
+
+// contextError is an error carrying skylight context, created by Wrap or Event.AsError.
+type contextError struct {
+	err     error
+	msg     string
+	fields  []Field
+	topic   string
+	eventID string
+	pcs     []uintptr
+	once    sync.Once
+	stack   []Frame
+}
+
+func (e *contextError) Error() string {
+	switch {
+	case e.err == nil:
+		return e.msg
+	case e.msg == "":
+		return e.err.Error()
+	default:
+		return e.msg + ": " + e.err.Error()
+	}
+}
+
+func (e *contextError) Unwrap() error { return e.err }
+
+func (e *contextError) ErrorFields() Fields {
+	fields := make(Fields, len(e.fields))
+	for _, f := range e.fields {
+		fields[f.Key] = f.Value()
+	}
+	return fields
+}
+
+func (e *contextError) StackTrace() []Frame {
+	e.once.Do(func() {
+		if e.stack == nil {
+			e.stack = framesForPCs(e.pcs)
+		}
+	})
+	return e.stack
+}
+
+// Wrap returns an error wrapping err with fields, which are merged into the event err is eventually logged with by Event.WithError.
+// The error message is unchanged. Wrap returns nil when err is nil.
+func Wrap(err error, fields Fields) error {
+	if err == nil {
+		return nil
+	}
+	ce := &contextError{err: err}
+	for k, v := range fields {
+		ce.fields = setField(ce.fields, anyField(k, v))
+	}
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(2, pcs[:])
+	ce.pcs = pcs[:n:n]
+	return ce
+}
+
+// AsError turns the event into an error instead of emitting it, so that it can be returned up the stack and logged once by
+// the top-level handler with WithError, which merges the event fields, topic and ID into the logged event.
+// The error message is the event message, followed by the message of the event "error" field, which the returned error wraps.
+// The event is recycled, or evicted when it was held, and must not be used afterwards.
+//
+// When the event is nil, e.g. because its level is filtered out, AsError returns the error given to WithError as is,
+// and nil when there is none.
+func (e *Event) AsError() error {
+	if !e.live() {
+		if e == nil {
+			return nil
+		}
+		return e.err
+	}
+
+	e.capture(0)
+	ce := &contextError{
+		msg:     e.msg(),
+		topic:   e.topic,
+		eventID: e.ID(),
+		stack:   slices.Clone(e.Stack()),
+	}
+	for _, f := range e.fields {
+		if f.Key == "error" && f.Kind == KindError {
+			ce.err, _ = f.obj.(error)
+			continue
+		}
+		ce.fields = append(ce.fields, f)
+	}
+	e.Evict()
+	return ce
+}
+
+// errorContext returns the topic and event ID of the innermost error carrying them.
+func errorContext(err error, depth int) (topic, eventID string) {
+	if err == nil || depth > maxErrorDepth {
+		return "", ""
+	}
+	if u, ok := err.(interface{ Unwrap() error }); ok {
+		topic, eventID = errorContext(u.Unwrap(), depth+1)
+	}
+	if ce, ok := err.(*contextError); ok {
+		if topic == "" {
+			topic = ce.topic
+		}
+		if eventID == "" {
+			eventID = ce.eventID
+		}
+	}
+	return topic, eventID
+}
@@ -0,0 +1,171 @@
+package skylight
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestAsErrorFilteredEvent(t *testing.T) {
+	c := New(WithLevel(LevelInfo))
+	err := errors.New("connection reset")
+
+	got := c.Debug("query failed").WithError(err).Str("table", "users").AsError()
+	if got != err {
+		t.Errorf("AsError() = %v, want the error given to WithError", got)
+	}
+	if got := c.Debug("query failed").AsError(); got != nil {
+		t.Errorf("AsError() = %v, want nil without an error", got)
+	}
+}
+
+func TestAsErrorHeldEvent(t *testing.T) {
+	var evicted int
+	c := New(WithObserver(WildcardObserver(func(e *Event) {}).WithEvict(func(e *Event) { evicted++ })))
+	err := errors.New("connection reset")
+
+	e := c.Error("query failed").WithError(err).Emit(true)
+	got := e.AsError()
+	if !errors.Is(got, err) || got.Error() != "query failed: connection reset" {
+		t.Errorf("AsError() = %v, want the event message wrapping err", got)
+	}
+	if held := c.Stats().Held; held != 0 {
+		t.Errorf("held = %d after AsError, want 0", held)
+	}
+	if evicted != 1 {
+		t.Errorf("evicted %d times, want 1", evicted)
+	}
+}
+
+// fielderError is an error contributing fields, optionally wrapping another one.
+type fielderError struct {
+	fields Fields
+	err    error
+}
+
+func (e fielderError) Error() string       { return "fielder" }
+func (e fielderError) Unwrap() error       { return e.err }
+func (e fielderError) ErrorFields() Fields { return e.fields }
+
+// pcs is a slice of program counters, as returned by the StackTrace method of github.com/pkg/errors.
+type pcs []uintptr
+
+type pcsError struct{ pcs pcs }
+
+func (e pcsError) Error() string   { return "pcs" }
+func (e pcsError) StackTrace() pcs { return e.pcs }
+
+// loopError wraps itself.
+type loopError struct{}
+
+func (e *loopError) Error() string       { return "loop" }
+func (e *loopError) Unwrap() error       { return e }
+func (e *loopError) ErrorFields() Fields { return Fields{"loop": true} }
+
+func TestRenderErrorChain(t *testing.T) {
+	base := errors.New("base")
+	err := fmt.Errorf("outer: %w", fmt.Errorf("mid: %w", base))
+
+	chain := RenderError(err).Chain()
+	if len(chain) != 3 {
+		t.Fatalf("chain = %+v, want 3 errors", chain)
+	}
+	for i, want := range []string{"outer: mid: base", "mid: base", "base"} {
+		if chain[i].Message != want {
+			t.Errorf("error %d = %q, want %q", i, chain[i].Message, want)
+		}
+	}
+	if chain[0].Type != "*fmt.wrapError" || chain[2].Type != "*errors.errorString" {
+		t.Errorf("types %q and %q", chain[0].Type, chain[2].Type)
+	}
+	if RenderError(nil) != nil {
+		t.Error("nil error rendered")
+	}
+}
+
+func TestRenderErrorJoined(t *testing.T) {
+	err := fmt.Errorf("batch: %w", errors.Join(errors.New("first"), nil, errors.New("second")))
+
+	info := RenderError(err)
+	if info.Cause == nil || len(info.Cause.Errors) != 2 {
+		t.Fatalf("rendered %+v, want the joined errors under the cause", info)
+	}
+	if info.Cause.Errors[0].Message != "first" || info.Cause.Errors[1].Message != "second" {
+		t.Errorf("joined errors = %+v", info.Cause.Errors)
+	}
+}
+
+func TestErrorFieldsPrecedence(t *testing.T) {
+	inner := fielderError{fields: Fields{"key": "inner", "inner": 1}}
+	outer := fielderError{fields: Fields{"key": "outer"}, err: fmt.Errorf("wrapped: %w", inner)}
+	joined := errors.Join(fielderError{fields: Fields{"joined": true}}, outer)
+
+	got := map[string]any{}
+	for _, f := range errorFields(joined, 0, nil) {
+		got[f.Key] = f.Value()
+	}
+	want := map[string]any{"key": "outer", "inner": 1, "joined": true}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("fields = %v, want %v", got, want)
+	}
+}
+
+func TestRenderErrorProgramCounters(t *testing.T) {
+	var buf [8]uintptr
+	n := runtime.Callers(1, buf[:])
+
+	info := RenderError(fmt.Errorf("wrapped: %w", pcsError{pcs: buf[:n]}))
+	if info.Stack != nil {
+		t.Errorf("stack of the wrapping error = %v, want none", info.Stack)
+	}
+	stack := info.Cause.Stack
+	if len(stack) == 0 || !strings.HasSuffix(stack[0].Function, ".TestRenderErrorProgramCounters") || stack[0].Package != "github.com/benchatech/skylight" {
+		t.Errorf("stack = %+v, want one starting in this test", stack)
+	}
+}
+
+func TestRenderErrorSelfWrapping(t *testing.T) {
+	err := &loopError{}
+
+	if chain := RenderError(err).Chain(); len(chain) != maxErrorDepth+1 {
+		t.Errorf("chain of %d errors, want %d", len(chain), maxErrorDepth+1)
+	}
+	if fields := errorFields(err, 0, nil); len(fields) != 1 || fields[0].Key != "loop" {
+		t.Errorf("fields = %v", fields)
+	}
+}
+
+// timeoutError is a typed error to look up with errors.As.
+type timeoutError struct{ op string }
+
+func (e *timeoutError) Error() string { return e.op + ": timeout" }
+
+func TestWrap(t *testing.T) {
+	if Wrap(nil, Fields{"user": 42}) != nil {
+		t.Error("Wrap(nil) != nil")
+	}
+
+	base := &timeoutError{op: "read"}
+	err := Wrap(fmt.Errorf("query: %w", Wrap(base, Fields{"table": "users", "user": 1})), Fields{"user": 42})
+	if err.Error() != "query: read: timeout" {
+		t.Errorf("message = %q, want the wrapped message unchanged", err.Error())
+	}
+	var te *timeoutError
+	if !errors.Is(err, base) || !errors.As(err, &te) || te != base {
+		t.Error("wrapped error not found through Wrap")
+	}
+
+	var events []EventSnapshot
+	c := New(WithObserver(WildcardObserver(func(e *Event) { events = append(events, e.Snapshot()) })))
+	c.Error("failed").Str("table", "orders").WithError(err).Emit()
+	if len(events) != 1 {
+		t.Fatalf("emitted %d events", len(events))
+	}
+	got := fieldValues(events[0])
+	want := map[string]string{"table": "users", "user": "42", "error": "query: read: timeout"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("fields = %v, want %v", got, want)
+	}
+}
@@ -1,176 +1,337 @@
 package skylight
 
 import (
+	"context"
 	"fmt"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	gonanoid "github.com/matoous/go-nanoid/v2"
+	"github.com/benchatech/skylight/internal"
 )
 
 var (
 	eventPool = &sync.Pool{
 		New: func() interface{} {
-			return &Event{}
+			return &event{}
+		},
+	}
+	handlePool = &sync.Pool{
+		New: func() interface{} {
+			return &handleBlock{}
 		},
 	}
 )
 
 type Fields map[string]any
 
+// Event is a handle to a pooled event. It carries the generation of the event it was created for, so that a handle used
+// after the event was emitted or evicted stays stale even once the pool has handed the event out again.
 type Event struct {
-	c         *Client
-	closed    bool
-	id        string
-	createdAt time.Time
-	emittedAt time.Time
-	level     Level
-	message   string
-	topic     string
-	parentID  string
-	fields    Fields
-}
-
-func newEvent(level Level, msg string, c *Client) *Event {
-	if c == nil || level < c.level {
+	*event
+	gen uint32
+	// err is the error kept by a handle that doesn't refer to an event, see WithError.
+	err error
+}
+
+type event struct {
+	c          *Client
+	closed     bool
+	held       bool
+	recordOnly bool
+	// escaped is set once the event is carried by a context. It is then left to the garbage collector instead of going
+	// back to the pool, since code holding the context may create children of it at any time.
+	escaped bool
+	// verbosity lowers the client level for the event and its children, see acquireEvent.
+	verbosity Level
+	// gen is incremented every time the event is released. Handles created for an earlier generation are stale.
+	gen        atomic.Uint32
+	releasedAt []byte
+	// mu guards the lazy id, traceID and frames, which may be resolved from several goroutines.
+	mu         sync.Mutex
+	id         string
+	createdAt  time.Time
+	emittedAt  time.Time
+	level      Level
+	message    lazyMessage
+	lazyFields bool
+	topic      string
+	parentID   string
+	traceID    string
+	traceState string
+	fields     []Field
+	hasCaller  bool
+	hasStack   bool
+	npcs       int
+	pcs        [maxStackDepth]uintptr
+	frames     []Frame
+}
+
+func newEvent(level Level, c *Client) *Event {
+	if c == nil {
+		return nil
+	}
+	return acquireEvent(level, c, LevelNone, false)
+}
+
+// acquireEvent takes an event from the pool. verbosity lowers the client level for the event and its children, and
+// LevelNone keeps the client level. Events below that level are only kept when a flight recorder wants them, or when
+// keep is set, e.g. for request events whose level is only known once they complete.
+func acquireEvent(level Level, c *Client, verbosity Level, keep bool) *Event {
+	recordOnly := level < c.minLevel(verbosity)
+	if keep {
+		recordOnly = false
+	} else if recordOnly && !c.recorder.accepts(level) {
 		return nil
 	}
 
-	e := eventPool.Get().(*Event)
+	e := eventPool.Get().(*event)
+	e.releasedAt = nil
+	e.escaped = false
 	e.closed = false
-	e.id = gonanoid.Must(16)
+	e.held = false
+	e.recordOnly = recordOnly
+	e.verbosity = verbosity
+	e.id = ""
 	e.createdAt = time.Now()
 	e.emittedAt = time.Time{}
 	e.level = level
-	e.message = msg
+	e.message = lazyMessage{}
+	e.lazyFields = false
 	e.topic = ""
 	e.parentID = ""
-	e.fields = make(Fields)
+	e.traceID = ""
+	e.traceState = ""
+	e.fields = e.fields[:0]
 	e.c = c
+	e.hasCaller = false
+	e.hasStack = false
+	e.npcs = 0
+	e.frames = e.frames[:0]
+	return newHandle(e)
+}
+
+// handleBlock hands out event handles in blocks, so that acquiring an event doesn't allocate its handle every time.
+// Handles are never reused, unlike events: a stale handle must keep the generation it was created for. A handle lets go
+// of its event when it's released, so that a block kept by one long-lived handle doesn't keep the events of the others.
+// The handle carried by a context, which may be kept the longest, is allocated on its own, see ContextWithEvent.
+type handleBlock struct {
+	handles [64]Event
+	next    int
+}
+
+// newHandle returns a handle to the current generation of e.
+func newHandle(e *event) *Event {
+	b := handlePool.Get().(*handleBlock)
+	h := &b.handles[b.next]
+	b.next++
+	if b.next < len(b.handles) {
+		handlePool.Put(b)
+	}
+	h.event, h.gen = e, e.gen.Load()
+	return h
+}
+
+// begin creates an event describing an operation whose level is only known once it completes, such as a call to
+// another service. It is a child of the event carried by ctx, if any, and otherwise a root event of c, which may be nil
+// to only create children. Unlike other events, it is created whatever the client level: end applies the filtering.
+func begin(ctx context.Context, c *Client) *Event {
+	var e *Event
+	if parent := EventFromContext(ctx); parent.canParent() {
+		e = acquireEvent(LevelInfo, parent.c, parent.verbosity, true)
+		parent.link(e)
+	} else if c != nil {
+		e = acquireEvent(LevelInfo, c, LevelNone, true)
+	} else {
+		return nil
+	}
 	return e
 }
 
-func newChildEvent(level Level, msg string, e *Event) *Event {
-	if e == nil || e.c == nil || level < e.c.level {
+// end emits an event created by begin at level, unless the client filters that level out. The event is emitted held
+// and evicted right away, so that observers see it as an operation that spanned from its creation until now.
+// The event must not be used afterwards.
+func (e *Event) end(level Level) {
+	if !e.live() {
+		return
+	}
+	e.level = level
+	if level < e.c.minLevel(e.verbosity) {
+		if !e.c.recorder.accepts(level) {
+			e.release()
+			return
+		}
+		e.recordOnly = true
+	}
+	e.emit(1, true).Evict()
+}
+
+func init() {
+	internal.SetHooks(internal.Hooks[*Client, *Event, Level]{
+		BeginEvent: begin,
+		EndEvent:   (*Event).end,
+	})
+}
+
+func newChildEvent(level Level, e *Event) *Event {
+	if !e.canParent() {
 		return nil
 	}
-	ce := newEvent(level, msg, e.c)
-	return ce.ParentID(e.id)
+	ce := acquireEvent(level, e.c, e.verbosity, false)
+	if ce == nil {
+		return nil
+	}
+	e.link(ce)
+	return ce
+}
+
+// canParent reports whether children can be created from e: it is live, or it was carried by a context and so is not
+// recycled, see ContextWithEvent.
+func (e *Event) canParent() bool {
+	if e != nil && e.event != nil && e.event.gen.Load() != e.gen && e.escaped {
+		return true
+	}
+	return e.live()
+}
+
+// link makes ce a child of e.
+func (e *Event) link(ce *Event) {
+	e.mu.Lock()
+	ce.parentID = e.idLocked()
+	ce.traceID = e.traceIDLocked()
+	e.mu.Unlock()
+	ce.traceState = e.traceState
 }
 
 // Trace creates a child event with the trace level and sets the parentID to the current event's ID.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new child event.
 func (e *Event) Trace(args ...any) *Event {
-	return newChildEvent(LevelTrace, fmt.Sprint(args...), e)
+	return newChildEvent(LevelTrace, e).print(args)
 }
 
 // Tracef creates a child event with the trace level and sets the parentID to the current event's ID.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new child event.
 func (e *Event) Tracef(v string, args ...any) *Event {
-	return newChildEvent(LevelTrace, fmt.Sprintf(v, args...), e)
+	return newChildEvent(LevelTrace, e).printf(v, args)
 }
 
 // Debug creates a child event with the debug level and sets the parentID to the current event's ID.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new child event.
 func (e *Event) Debug(args ...any) *Event {
-	return newChildEvent(LevelDebug, fmt.Sprint(args...), e)
+	return newChildEvent(LevelDebug, e).print(args)
 }
 
 // Debugf creates a child event with the debug level and sets the parentID to the current event's ID.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new child event.
 func (e *Event) Debugf(v string, args ...any) *Event {
-	return newChildEvent(LevelDebug, fmt.Sprintf(v, args...), e)
+	return newChildEvent(LevelDebug, e).printf(v, args)
 }
 
 // Info creates a child event with the info level and sets the parentID to the current event's ID.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new child event.
 func (e *Event) Info(args ...any) *Event {
-	return newChildEvent(LevelInfo, fmt.Sprint(args...), e)
+	return newChildEvent(LevelInfo, e).print(args)
 }
 
 // Infof creates a child event with the info level and sets the parentID to the current event's ID.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new child event.
 func (e *Event) Infof(v string, args ...any) *Event {
-	return newChildEvent(LevelInfo, fmt.Sprintf(v, args...), e)
+	return newChildEvent(LevelInfo, e).printf(v, args)
 }
 
 // Warn creates a child event with the warn level and sets the parentID to the current event's ID.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new child event.
 func (e *Event) Warn(args ...any) *Event {
-	return newChildEvent(LevelWarn, fmt.Sprint(args...), e)
+	return newChildEvent(LevelWarn, e).print(args)
 }
 
 // Warnf creates a child event with the warn level and sets the parentID to the current event's ID.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new child event.
 func (e *Event) Warnf(v string, args ...any) *Event {
-	return newChildEvent(LevelWarn, fmt.Sprintf(v, args...), e)
+	return newChildEvent(LevelWarn, e).printf(v, args)
 }
 
 // Error creates a child event with the error level and sets the parentID to the current event's ID.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new child event.
 func (e *Event) Error(args ...any) *Event {
-	return newChildEvent(LevelError, fmt.Sprint(args...), e)
+	return newChildEvent(LevelError, e).print(args)
 }
 
 // Errorf creates a child event with the error level and sets the parentID to the current event's ID.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new child event.
 func (e *Event) Errorf(v string, args ...any) *Event {
-	return newChildEvent(LevelError, fmt.Sprintf(v, args...), e)
+	return newChildEvent(LevelError, e).printf(v, args)
 }
 
 // Fatal creates a child event with the fatal level and sets the parentID to the current event's ID.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new child event.
 func (e *Event) Fatal(args ...any) *Event {
-	return newChildEvent(LevelFatal, fmt.Sprint(args...), e)
+	return newChildEvent(LevelFatal, e).print(args)
 }
 
 // Fatalf creates a child event with the fatal level and sets the parentID to the current event's ID.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new child event.
 func (e *Event) Fatalf(v string, args ...any) *Event {
-	return newChildEvent(LevelFatal, fmt.Sprintf(v, args...), e)
+	return newChildEvent(LevelFatal, e).printf(v, args)
 }
 
 // Panic creates a child event with the panic level and sets the parentID to the current event's ID.
 // It formats the provided arguments into a message using fmt.Sprint and assigns this message to the new child event.
 func (e *Event) Panic(args ...any) *Event {
-	return newChildEvent(LevelPanic, fmt.Sprint(args...), e)
+	return newChildEvent(LevelPanic, e).print(args)
 }
 
 // Panicf creates a child event with the panic level and sets the parentID to the current event's ID.
 // It formats the provided arguments into a message using fmt.Sprintf according to the format string 'v' and assigns this message to the new child event.
 func (e *Event) Panicf(v string, args ...any) *Event {
-	return newChildEvent(LevelPanic, fmt.Sprintf(v, args...), e)
+	return newChildEvent(LevelPanic, e).printf(v, args)
 }
 
 func (e *Event) String() string {
 	return fmt.Sprintf(
 		"&{ID:%s CreatedAt:%v Level:%s Message:%s Topic:%s ParentID:%s Fields:%v}",
-		e.id,
+		e.ID(),
 		e.createdAt,
 		e.level,
-		e.message,
+		e.msg(),
 		e.topic,
 		e.parentID,
-		e.fields,
+		e.fieldMap(),
 	)
 }
 
+// ID returns the event ID, generating it on first use.
 func (e *Event) ID() string {
-	if e == nil {
+	if !e.live() {
 		return ""
 	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.idLocked()
+}
+
+func (e *Event) idLocked() string {
+	if e.id == "" {
+		e.id = e.c.newID()
+	}
 	return e.id
 }
 
 // E is an alias for the Emit method.
 // Emit triggers the event, notifying all observers that match the condition.
 // If hold is true, the event is not recycled and must be manually closed with `Evict`. Otherwise, the event is returned to the pool after emission.
-func (e *Event) E(hold ...bool) *Event { return e.Emit(hold...) }
+func (e *Event) E(hold ...bool) *Event { return e.emit(1, len(hold) > 0 && hold[0]) }
 
 // Emit triggers the event, notifying all observers that match the condition.
-// If hold is true, the event is not recycled and must be manually closed with `Evict`. Otherwise, the event is returned to the pool after emission.
-func (e *Event) Emit(hold ...bool) *Event {
-	if e == nil {
+// If hold is true, the event is not recycled and must be manually closed with `Evict`. Otherwise, the event is returned to the pool after emission
+// and Emit returns nil, so that anything chained after it is a no-op. Using a recycled event is a no-op too, unless debug events are enabled
+// on the client, in which case it panics with the stack of the original Emit.
+func (e *Event) Emit(hold ...bool) *Event { return e.emit(1, len(hold) > 0 && hold[0]) }
+
+// emit implements Emit, capturing the caller and stack skip frames above itself, see capture.
+func (e *Event) emit(skip int, hold bool) *Event {
+	if !e.live() {
 		return nil
 	}
 	if e.closed {
@@ -179,65 +340,172 @@ func (e *Event) Emit(hold ...bool) *Event {
 
 	e.emittedAt = time.Now()
 	e.closed = true
+	if hold {
+		e.held = true
+		e.c.stats.held.Add(1)
+	}
+	if !e.recordOnly {
+		e.enrich()
+		e.c.stats.count(e)
+		captured := false
+		for _, o := range e.c.observers {
+			if !o.cond(e) {
+				continue
+			}
+			// The frames are only captured for events an observer takes.
+			if !captured {
+				e.capture(skip)
+				captured = true
+			}
+			o.dispatch(e)
+		}
+	}
+
+	// The recorder sees the event after the observers, so that lazy values they needed are only evaluated once.
+	if r := e.c.recorder; r != nil {
+		r.record(e)
+		if e.level >= LevelFatal && !e.recordOnly {
+			r.dumpOrReport(fmt.Sprintf("%s event: %s", e.level, e.msg()))
+		}
+	}
 
-	for _, o := range e.c.observers {
-		if o.cond(e) {
-			o.handler(e)
+	if !e.recordOnly {
+		switch e.level {
+		case LevelFatal:
+			e.c.Flush()
+			e.c.exit(1)
+		case LevelPanic:
+			// The event is carried by the panic error, so it only goes back to the pool if the panic function returns.
+			e.c.Flush()
+			e.c.panic(&PanicError{Event: e})
 		}
 	}
 
-	if len(hold) > 0 && hold[0] {
+	if e.held {
 		return e
 	}
 
-	eventPool.Put(e)
-	return e
+	e.release()
+	return nil
 }
 
+// Evict returns a held event to the pool. The event must not be used afterwards.
 func (e *Event) Evict() {
-	if e == nil {
+	if !e.live() {
 		return
 	}
-	eventPool.Put(e)
+	if e.held {
+		e.c.stats.held.Add(-1)
+		if !e.recordOnly {
+			for _, o := range e.c.observers {
+				o.dispatchEvict(e)
+			}
+		}
+	}
+	e.release()
 }
 
+// Held reports whether the event was emitted with hold, and so stays open until Evict is called.
+// Observers use it to tell long-lived events, such as requests, from one-off ones.
+func (e *Event) Held() bool {
+	if !e.live() {
+		return false
+	}
+	return e.held
+}
+
+// live reports whether e can still be used. Stale handles are reported as not live, or panic when debug events are enabled.
+func (e *Event) live() bool {
+	if e == nil || e.event == nil {
+		return false
+	}
+	if e.event.gen.Load() != e.gen {
+		if e.releasedAt != nil {
+			panic(fmt.Sprintf("skylight: event used after it was emitted or evicted at:\n%s", e.releasedAt))
+		}
+		return false
+	}
+	return true
+}
+
+func (e *Event) release() {
+	ev := e.event
+	if !ev.escaped && ev.c != nil && ev.c.debugEvents {
+		// Debug events never go back to the pool, and their handles keep them, so that stale handles can report where
+		// the event was released.
+		ev.releasedAt = debug.Stack()
+		ev.gen.Add(1)
+		return
+	}
+	ev.gen.Add(1)
+	if ev.escaped {
+		// Children can still be created from any handle of the event, from any goroutine, see ContextWithEvent.
+		return
+	}
+	e.event = nil
+	// Drop references held by the field values and lazy message, but keep the slice for the next event.
+	clear(ev.fields)
+	ev.fields = ev.fields[:0]
+	ev.message = lazyMessage{}
+	eventPool.Put(ev)
+}
+
+// WithError adds err to the event under the "error" key, together with the fields contributed by err and the errors it wraps.
+// When err was created by Wrap or Event.AsError, the event also takes its topic, unless it already has one, and records the ID
+// of the original event under the "error_event_id" key. See ErrorFielder, and RenderError for the structured rendering of the error.
+// A nil err is recorded as a nil "error" field, unlike with Err.
+//
+// When the event is nil, e.g. because its level is filtered out, WithError returns a handle keeping err, so that AsError
+// still returns it. That handle is allocated, unlike filtered events otherwise; Err doesn't keep the error, and doesn't
+// allocate.
 func (e *Event) WithError(err error) *Event {
-	if e == nil {
-		return e
+	if !e.live() {
+		if err == nil {
+			return e
+		}
+		return &Event{err: err}
+	}
+	if err == nil {
+		return e.setField(anyField("error", nil))
+	}
+	for _, f := range errorFields(err, 0, nil) {
+		e.setField(f)
 	}
-	return e.Fields(Fields{"error": err})
+	topic, eventID := errorContext(err, 0)
+	if e.topic == "" {
+		e.topic = topic
+	}
+	if eventID != "" {
+		e.setField(stringField("error_event_id", eventID))
+	}
+	return e.Err("error", err)
 }
 
 // F is an alias for the Field method.
 func (e *Event) F(k string, v any) *Event { return e.Field(k, v) }
 
 func (e *Event) Field(k string, v any) *Event {
-	if e == nil {
+	if !e.live() {
 		return e
 	}
-	return e.Fields(Fields{k: v})
+	return e.setField(anyField(k, v))
 }
 
 // Fs is an alias for the Fields method.
 func (e *Event) Fs(fields Fields) *Event { return e.Fields(fields) }
 
 func (e *Event) Fields(fields Fields) *Event {
-	if e == nil {
+	if !e.live() {
 		return e
 	}
-	data := make(Fields)
-	for k, v := range e.fields {
-		data[k] = v
-	}
 	for k, v := range fields {
-		data[k] = v
+		e.setField(anyField(k, v))
 	}
-	e.fields = data
 	return e
 }
 
 func (e *Event) Level(level Level) *Event {
-	if e == nil {
+	if !e.live() {
 		return e
 	}
 	e.level = level
@@ -248,10 +516,10 @@ func (e *Event) Level(level Level) *Event {
 func (e *Event) M(args ...any) *Event { return e.Message(args...) }
 
 func (e *Event) Message(args ...any) *Event {
-	if e == nil {
+	if !e.live() {
 		return e
 	}
-	e.message = fmt.Sprint(args...)
+	e.print(args)
 	return e
 }
 
@@ -259,21 +527,28 @@ func (e *Event) Message(args ...any) *Event {
 func (e *Event) Mf(f string, args ...any) *Event { return e.Messagef(f, args...) }
 
 func (e *Event) Messagef(f string, args ...any) *Event {
-	if e == nil {
+	if !e.live() {
 		return e
 	}
-	e.message = fmt.Sprintf(f, args...)
+	e.printf(f, args)
 	return e
 }
 
 // P is an alias for the ParentID method.
-func (e *Event) P(id string) *Event { return e.ParentID(id) }
+func (e *Event) P(id string, traceID ...string) *Event { return e.ParentID(id, traceID...) }
 
-func (e *Event) ParentID(id string) *Event {
-	if e == nil {
+// ParentID sets the parent of the event, and its trace to traceID, the trace of the parent as returned by its TraceID
+// method. Without traceID, the trace is derived from the parent ID, see Event.TraceID: it is only the trace of the
+// parent when the parent is a root event, so events deeper in a tree must pass the trace to stay in it.
+func (e *Event) ParentID(id string, traceID ...string) *Event {
+	if !e.live() {
 		return e
 	}
 	e.parentID = id
+	e.traceID, e.traceState = "", ""
+	if len(traceID) > 0 {
+		e.traceID = traceID[0]
+	}
 	return e
 }
 
@@ -281,7 +556,7 @@ func (e *Event) ParentID(id string) *Event {
 func (e *Event) T(topic string) *Event { return e.Topic(topic) }
 
 func (e *Event) Topic(topic string) *Event {
-	if e == nil {
+	if !e.live() {
 		return e
 	}
 	e.topic = topic
@@ -0,0 +1,149 @@
+package skylight
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEventIDConcurrentChildren(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		parents = map[string]bool{}
+	)
+	c := New(WithObserver(WildcardObserver(func(e *Event) {
+		if e.msg() != "child" {
+			return
+		}
+		mu.Lock()
+		parents[e.parentID] = true
+		mu.Unlock()
+	})))
+
+	e := c.Info("parent").Emit(true)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.Info("child").Emit()
+		}()
+	}
+	wg.Wait()
+
+	if len(parents) != 1 || !parents[e.ID()] {
+		t.Errorf("children parent IDs = %v, want only %q", parents, e.ID())
+	}
+	e.Evict()
+}
+
+func TestStaleEventAfterPoolReuse(t *testing.T) {
+	var messages []string
+	c := New(WithDebugEvents(false), WithObserver(WildcardObserver(func(e *Event) {
+		messages = append(messages, e.msg())
+	})))
+
+	for i := 0; i < 100; i++ {
+		messages = messages[:0]
+		a := c.Info("a")
+		a.Emit()
+		b := c.Info("b")
+		if a.Message("corrupted").Str("key", "value").Emit() != nil {
+			t.Fatal("emitting a stale handle returned an event")
+		}
+		b.Emit()
+		if len(messages) != 2 || messages[1] != "b" {
+			t.Fatalf("messages = %q, want [a b]", messages)
+		}
+	}
+}
+
+func TestReleasedHandleLetsGoOfEvent(t *testing.T) {
+	c := New(WithDebugEvents(false))
+	e := c.Info("emitted")
+	e.Emit()
+	if e.event != nil {
+		t.Error("an emitted handle keeps its event")
+	}
+
+	// The handles of an event carried by a context keep it, so that children can still be created from them.
+	held := c.Info("held").Emit(true)
+	ctx := ContextWithEvent(context.Background(), held)
+	held.Evict()
+	carried := EventFromContext(ctx)
+	if carried == held {
+		t.Error("the context shares the handle of the pool")
+	}
+	for _, parent := range []*Event{held, carried} {
+		if child := parent.Info("child"); child == nil {
+			t.Error("no child of an evicted event carried by a context")
+		} else {
+			child.Emit()
+		}
+	}
+}
+
+func TestStaleEventPanicsInDebugMode(t *testing.T) {
+	c := New(WithDebugEvents(true))
+	e := c.Info("a")
+	e.Emit()
+	defer func() {
+		if recover() == nil {
+			t.Error("using an emitted event did not panic")
+		}
+	}()
+	e.Message("b")
+}
+
+// wrappedInfo stands for a logging wrapper, which the caller skip of its client hides.
+func wrappedInfo(c *Client, msg string) {
+	c.Info(msg).Emit()
+}
+
+func TestCallerInPackage(t *testing.T) {
+	var callers []string
+	c := New(WithCaller(LevelInfo), WithObserver(WildcardObserver(func(e *Event) {
+		f, _ := e.Caller()
+		callers = append(callers, f.Function)
+	})))
+
+	// Frames are skipped by count, so the callers in package skylight are reported.
+	c.Info("emit").Emit()
+	c.Info("alias").E()
+	begin(context.Background(), c).end(LevelInfo)
+	wrappedInfo(c, "wrapped")
+	c.WithCallerSkip(1)
+	wrappedInfo(c, "skipped")
+	want := []string{"TestCallerInPackage", "TestCallerInPackage", "TestCallerInPackage", "wrappedInfo", "TestCallerInPackage"}
+	if len(callers) != len(want) {
+		t.Fatalf("callers = %q, want %q", callers, want)
+	}
+	for i, fn := range callers {
+		if !strings.HasSuffix(fn, "skylight."+want[i]) {
+			t.Errorf("caller %d = %q, want %s", i, fn, want[i])
+		}
+	}
+
+	c.WithCallerSkip(0)
+	err := c.Error("failed").AsError()
+	if stack := err.(*contextError).StackTrace(); len(stack) == 0 || !strings.HasSuffix(stack[0].Function, "skylight.TestCallerInPackage") {
+		t.Errorf("error stack = %v, want one starting in the test", stack)
+	}
+}
+
+func TestCallerOnlyCapturedForObservedEvents(t *testing.T) {
+	c := New(WithCaller(LevelInfo), WithObserver(TopicObserver("db", func(e *Event) {})))
+
+	ignored := c.Info("ignored").Topic("http").Emit(true)
+	if ignored.npcs != 0 {
+		t.Errorf("captured %d frames of an event no observer takes", ignored.npcs)
+	}
+	ignored.Evict()
+
+	taken := c.Info("taken").Topic("db").Emit(true)
+	if f, ok := taken.Caller(); !ok || !strings.HasSuffix(f.Function, "TestCallerOnlyCapturedForObservedEvents") {
+		t.Errorf("caller = %v, want the test", f)
+	}
+	taken.Evict()
+}
@@ -0,0 +1,283 @@
+package skylight
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// FieldKind identifies how the value of a Field is stored.
+type FieldKind uint8
+
+const (
+	KindAny FieldKind = iota
+	KindString
+	KindInt64
+	KindFloat64
+	KindBool
+	KindDuration
+	KindTime
+	KindError
+)
+
+// Field is a typed key/value pair attached to an event.
+// Scalar values are stored without boxing them in an interface.
+type Field struct {
+	Key  string
+	Kind FieldKind
+	num  int64
+	str  string
+	obj  any
+}
+
+// FieldVisitor reads field values without boxing them. See Event.VisitFields.
+type FieldVisitor interface {
+	VisitString(key, value string)
+	VisitInt64(key string, value int64)
+	VisitFloat64(key string, value float64)
+	VisitBool(key string, value bool)
+	VisitDuration(key string, value time.Duration)
+	VisitTime(key string, value time.Time)
+	VisitError(key string, err error)
+	VisitAny(key string, value any)
+}
+
+// Times outside this range can't be represented as Unix nanoseconds and are stored boxed.
+var (
+	minTimeNano = time.Unix(0, math.MinInt64)
+	maxTimeNano = time.Unix(0, math.MaxInt64)
+)
+
+func stringField(key, v string) Field {
+	return Field{Key: key, Kind: KindString, str: v}
+}
+
+func int64Field(key string, v int64) Field {
+	return Field{Key: key, Kind: KindInt64, num: v}
+}
+
+func float64Field(key string, v float64) Field {
+	return Field{Key: key, Kind: KindFloat64, num: int64(math.Float64bits(v))}
+}
+
+func boolField(key string, v bool) Field {
+	f := Field{Key: key, Kind: KindBool}
+	if v {
+		f.num = 1
+	}
+	return f
+}
+
+func durationField(key string, v time.Duration) Field {
+	return Field{Key: key, Kind: KindDuration, num: int64(v)}
+}
+
+func timeField(key string, v time.Time) Field {
+	if v.Before(minTimeNano) || v.After(maxTimeNano) {
+		return Field{Key: key, Kind: KindTime, obj: v}
+	}
+	return Field{Key: key, Kind: KindTime, num: v.UnixNano(), obj: v.Location()}
+}
+
+func errorField(key string, err error) Field {
+	return Field{Key: key, Kind: KindError, obj: err}
+}
+
+// anyField stores v in the most specific kind available.
+func anyField(key string, v any) Field {
+	switch v := v.(type) {
+	case string:
+		return stringField(key, v)
+	case int:
+		return int64Field(key, int64(v))
+	case int64:
+		return int64Field(key, v)
+	case int32:
+		return int64Field(key, int64(v))
+	case float64:
+		return float64Field(key, v)
+	case bool:
+		return boolField(key, v)
+	case time.Duration:
+		return durationField(key, v)
+	case time.Time:
+		return timeField(key, v)
+	case error:
+		return errorField(key, v)
+	default:
+		return Field{Key: key, Kind: KindAny, obj: v}
+	}
+}
+
+func (f Field) time() time.Time {
+	switch v := f.obj.(type) {
+	case time.Time:
+		return v
+	case *time.Location:
+		return time.Unix(0, f.num).In(v)
+	default:
+		return time.Unix(0, f.num)
+	}
+}
+
+// Visit passes the field value to the matching method of v.
+func (f Field) Visit(v FieldVisitor) {
+	switch f.Kind {
+	case kindLazy:
+		f.resolve().Visit(v)
+	case KindString:
+		v.VisitString(f.Key, f.str)
+	case KindInt64:
+		v.VisitInt64(f.Key, f.num)
+	case KindFloat64:
+		v.VisitFloat64(f.Key, math.Float64frombits(uint64(f.num)))
+	case KindBool:
+		v.VisitBool(f.Key, f.num == 1)
+	case KindDuration:
+		v.VisitDuration(f.Key, time.Duration(f.num))
+	case KindTime:
+		v.VisitTime(f.Key, f.time())
+	case KindError:
+		err, _ := f.obj.(error)
+		v.VisitError(f.Key, err)
+	default:
+		v.VisitAny(f.Key, f.obj)
+	}
+}
+
+// Value returns the field value boxed in an interface.
+func (f Field) Value() any {
+	switch f.Kind {
+	case kindLazy:
+		return f.resolve().Value()
+	case KindString:
+		return f.str
+	case KindInt64:
+		return f.num
+	case KindFloat64:
+		return math.Float64frombits(uint64(f.num))
+	case KindBool:
+		return f.num == 1
+	case KindDuration:
+		return time.Duration(f.num)
+	case KindTime:
+		return f.time()
+	default:
+		return f.obj
+	}
+}
+
+func (f Field) String() string {
+	return fmt.Sprintf("%s=%v", f.Key, f.Value())
+}
+
+// setField adds f to fields, replacing any field with the same key.
+func setField(fields []Field, f Field) []Field {
+	for i := range fields {
+		if fields[i].Key == f.Key {
+			fields[i] = f
+			return fields
+		}
+	}
+	return append(fields, f)
+}
+
+// setField adds f to the event, replacing any field with the same key.
+func (e *Event) setField(f Field) *Event {
+	e.fields = setField(e.fields, f)
+	return e
+}
+
+// fieldMap returns the event fields as a map, for observers that need one.
+func (e *Event) fieldMap() Fields {
+	fields := make(Fields, len(e.fields))
+	for _, f := range e.fields {
+		fields[f.Key] = f.Value()
+	}
+	return fields
+}
+
+// VisitFields passes every field of the event to v, in the order they were added.
+func (e *Event) VisitFields(v FieldVisitor) {
+	if !e.live() {
+		return
+	}
+	for _, f := range e.fields {
+		f.Visit(v)
+	}
+}
+
+// Str adds a string field to the event.
+func (e *Event) Str(key, v string) *Event {
+	if !e.live() {
+		return e
+	}
+	return e.setField(stringField(key, v))
+}
+
+// Int adds an int field to the event.
+func (e *Event) Int(key string, v int) *Event {
+	if !e.live() {
+		return e
+	}
+	return e.setField(int64Field(key, int64(v)))
+}
+
+// Int64 adds an int64 field to the event.
+func (e *Event) Int64(key string, v int64) *Event {
+	if !e.live() {
+		return e
+	}
+	return e.setField(int64Field(key, v))
+}
+
+// Float adds a float64 field to the event.
+func (e *Event) Float(key string, v float64) *Event {
+	if !e.live() {
+		return e
+	}
+	return e.setField(float64Field(key, v))
+}
+
+// Bool adds a bool field to the event.
+func (e *Event) Bool(key string, v bool) *Event {
+	if !e.live() {
+		return e
+	}
+	return e.setField(boolField(key, v))
+}
+
+// Dur adds a time.Duration field to the event.
+func (e *Event) Dur(key string, v time.Duration) *Event {
+	if !e.live() {
+		return e
+	}
+	return e.setField(durationField(key, v))
+}
+
+// Time adds a time.Time field to the event.
+func (e *Event) Time(key string, v time.Time) *Event {
+	if !e.live() {
+		return e
+	}
+	return e.setField(timeField(key, v))
+}
+
+// Err adds an error field to the event. A nil error is ignored.
+func (e *Event) Err(key string, err error) *Event {
+	if !e.live() {
+		return e
+	}
+	if err == nil {
+		return e
+	}
+	return e.setField(errorField(key, err))
+}
+
+// Any adds a field of any type to the event. Values of a supported scalar type are stored typed.
+func (e *Event) Any(key string, v any) *Event {
+	if !e.live() {
+		return e
+	}
+	return e.setField(anyField(key, v))
+}
@@ -0,0 +1,82 @@
+package skylight
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithErrorNil(t *testing.T) {
+	var fields Fields
+	c := New(WithObserver(WildcardObserver(func(e *Event) { fields = e.fieldMap() })))
+	c.Info("no error").WithError(nil).Emit()
+
+	if v, ok := fields["error"]; !ok || v != nil {
+		t.Errorf("fields = %v, want a nil error field", fields)
+	}
+}
+
+func TestFieldAllocs(t *testing.T) {
+	if raceEnabled || debugEvents {
+		t.Skip("events are not reliably pooled under the race detector or with debug events")
+	}
+	c := New(WithLevel(LevelInfo), WithObserver(WildcardObserver(func(e *Event) {})))
+	err := errors.New("failed")
+
+	if n := testing.AllocsPerRun(100, func() { emitFiveFields(c.Debug, err) }); n != 0 {
+		t.Errorf("filtered event: %v allocs, want 0", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { emitFiveFields(c.Info, err) }); n != 0 {
+		t.Errorf("emitted event: %v allocs, want 0", n)
+	}
+	// A filtered event allocates the handle keeping the error of WithError, see Event.WithError.
+	if n := testing.AllocsPerRun(100, func() { emitWithError(c.Debug, err) }); n != 1 {
+		t.Errorf("filtered event with an error: %v allocs, want 1", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { emitWithError(c.Info, err) }); n != 0 {
+		t.Errorf("emitted event with an error: %v allocs, want 0", n)
+	}
+}
+
+func BenchmarkFilteredEvent(b *testing.B) {
+	c := New(WithLevel(LevelInfo), WithObserver(WildcardObserver(func(e *Event) {})))
+	err := errors.New("failed")
+	b.Run("Err", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			emitFiveFields(c.Debug, err)
+		}
+	})
+	b.Run("WithError", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			emitWithError(c.Debug, err)
+		}
+	})
+}
+
+func BenchmarkEmittedEvent(b *testing.B) {
+	c := New(WithLevel(LevelInfo), WithObserver(WildcardObserver(func(e *Event) {})))
+	err := errors.New("failed")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		emitFiveFields(c.Info, err)
+	}
+}
+
+func emitFiveFields(level func(args ...any) *Event, err error) {
+	level().
+		Str("user", "alice").
+		Int("attempt", 3).
+		Bool("cached", true).
+		Dur("elapsed", 15*time.Millisecond).
+		Err("error", err).
+		Emit()
+}
+
+func emitWithError(level func(args ...any) *Event, err error) {
+	level().
+		Str("user", "alice").
+		WithError(err).
+		Emit()
+}
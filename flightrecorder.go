@@ -0,0 +1,303 @@
+package skylight
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+)
+
+// recordedEvent is the compact copy of an event kept in the flight recorder's ring buffer.
+// Recording must stay cheap, since most recorded events are never dumped: the ID of an event that has none yet is only
+// generated, and its lazy message and fields only evaluated, when a bundle is written. So is a message formatted from
+// scalar arguments, see Event.print. Non-scalar fields are formatted when the event is recorded, since the values they
+// refer to belong to the caller.
+type recordedEvent struct {
+	id        string
+	c         *Client
+	parentID  string
+	createdAt time.Time
+	level     Level
+	message   lazyMessage
+	topic     string
+	fields    []Field
+	dropped   bool
+}
+
+// FlightRecorder keeps a rolling buffer of the most recent events, including events below the
+// client level, and writes them to a crash bundle when a fatal or panic event is emitted.
+type FlightRecorder struct {
+	mu     sync.Mutex
+	level  Level
+	dir    string
+	writer io.Writer
+	ring   []recordedEvent
+	next   int
+	count  int
+	// resumed is the value of the last panic resumed after its bundle was written, so that recovering it again
+	// doesn't write another one.
+	resumed any
+}
+
+// NewFlightRecorder creates a flight recorder that keeps the last size events.
+// By default it records every level and writes crash bundles to os.TempDir().
+func NewFlightRecorder(size int) *FlightRecorder {
+	if size <= 0 {
+		size = 1
+	}
+	return &FlightRecorder{
+		level: LevelTrace,
+		dir:   os.TempDir(),
+		ring:  make([]recordedEvent, size),
+	}
+}
+
+// WithLevel sets the minimum level recorded, independently of the client level.
+func (r *FlightRecorder) WithLevel(level Level) *FlightRecorder {
+	if r == nil {
+		return nil
+	}
+	r.level = level
+	return r
+}
+
+// WithDir sets the directory crash bundles are written to.
+func (r *FlightRecorder) WithDir(dir string) *FlightRecorder {
+	if r == nil {
+		return nil
+	}
+	r.dir = dir
+	return r
+}
+
+// WithWriter writes crash bundles to w instead of creating a file per bundle.
+func (r *FlightRecorder) WithWriter(w io.Writer) *FlightRecorder {
+	if r == nil {
+		return nil
+	}
+	r.writer = w
+	return r
+}
+
+func (r *FlightRecorder) accepts(level Level) bool {
+	return r != nil && level >= r.level
+}
+
+func (r *FlightRecorder) record(e *Event) {
+	if !r.accepts(e.level) {
+		return
+	}
+
+	e.mu.Lock()
+	id := e.id
+	e.mu.Unlock()
+
+	r.mu.Lock()
+	// The slot's field slice is reused, since the event's own slice goes back to the pool with it.
+	slot := &r.ring[r.next]
+	fields := slot.fields[:0]
+	for _, f := range e.fields {
+		fields = append(fields, recordedField(f))
+	}
+	*slot = recordedEvent{
+		id:        id,
+		c:         e.c,
+		parentID:  e.parentID,
+		createdAt: e.createdAt,
+		level:     e.level,
+		message:   e.message,
+		topic:     e.topic,
+		fields:    fields,
+		dropped:   e.recordOnly,
+	}
+	r.next = (r.next + 1) % len(r.ring)
+	if r.count < len(r.ring) {
+		r.count++
+	}
+	r.mu.Unlock()
+}
+
+// events returns a copy of the recorded events, oldest first.
+func (r *FlightRecorder) events() []recordedEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := make([]recordedEvent, 0, r.count)
+	start := (r.next - r.count + len(r.ring)) % len(r.ring)
+	for i := 0; i < r.count; i++ {
+		e := r.ring[(start+i)%len(r.ring)]
+		e.fields = slices.Clone(e.fields)
+		events = append(events, e)
+	}
+	return events
+}
+
+// Dump writes a crash bundle containing the recorded events, a dump of all goroutines and the build info.
+// It returns the path of the bundle, or an empty string when the recorder writes to a custom writer.
+func (r *FlightRecorder) Dump(reason string) (string, error) {
+	if r == nil {
+		return "", nil
+	}
+
+	if r.writer != nil {
+		return "", r.writeBundle(r.writer, reason)
+	}
+
+	name := fmt.Sprintf("skylight-crash-%s-%d.txt", time.Now().UTC().Format("20060102T150405.000000000"), os.Getpid())
+	path := filepath.Join(r.dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("skylight: create crash bundle: %w", err)
+	}
+	defer f.Close()
+
+	if err := r.writeBundle(f, reason); err != nil {
+		return path, err
+	}
+	return path, f.Sync()
+}
+
+// Recover is meant to be deferred. It writes a crash bundle when the surrounding function panics and then re-panics with the same value.
+// A panic event of a client using r has written its bundle when it was emitted, and a panic recovered by the Recover
+// functions or Go of such a client has written it when it was recovered, so neither writes another one.
+func (r *FlightRecorder) Recover() {
+	v := recover()
+	if v == nil {
+		return
+	}
+	r.dumpPanic(v)
+	r.resume(v)
+	panic(v)
+}
+
+// dumpPanic writes a crash bundle for the recovered panic v, unless one was written for it already.
+func (r *FlightRecorder) dumpPanic(v any) {
+	if r != nil && !r.dumped(v) {
+		r.dumpOrReport(fmt.Sprintf("panic: %v", v))
+	}
+}
+
+// resume records that the panic v, whose bundle was written, is resumed.
+func (r *FlightRecorder) resume(v any) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.resumed = v
+	r.mu.Unlock()
+}
+
+// dumped reports whether r wrote the bundle of the panic value v: either v is the *PanicError of a panic event whose
+// bundle r wrote when it was emitted, or v was resumed after r wrote its bundle. It doesn't use live, which panics on
+// stale events in debug builds.
+func (r *FlightRecorder) dumped(v any) bool {
+	r.mu.Lock()
+	resumed := r.resumed != nil && samePanic(r.resumed, v)
+	if resumed {
+		r.resumed = nil
+	}
+	r.mu.Unlock()
+	if resumed {
+		return true
+	}
+
+	pe, ok := v.(*PanicError)
+	if !ok || pe.Event == nil || pe.Event.event == nil || pe.Event.event.gen.Load() != pe.Event.gen {
+		return false
+	}
+	return pe.Event.c.recorder == r && !pe.Event.recordOnly
+}
+
+// samePanic reports whether the panic values a and b are equal, and false when they can't be compared.
+func samePanic(a, b any) (same bool) {
+	defer func() { recover() }()
+	return a == b
+}
+
+func (r *FlightRecorder) dumpOrReport(reason string) {
+	if _, err := r.Dump(reason); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func (r *FlightRecorder) writeBundle(w io.Writer, reason string) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "skylight crash bundle")
+	fmt.Fprintf(bw, "reason: %s\n", reason)
+	fmt.Fprintf(bw, "time: %s\n", time.Now().Format(time.RFC3339Nano))
+	fmt.Fprintf(bw, "pid: %d\n", os.Getpid())
+	fmt.Fprintf(bw, "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	fmt.Fprintln(bw, "\n== build info ==")
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprint(bw, info.String())
+	} else {
+		fmt.Fprintln(bw, "unavailable")
+	}
+
+	events := r.events()
+	fmt.Fprintf(bw, "\n== recent events (%d) ==\n", len(events))
+	for _, e := range events {
+		fmt.Fprintf(bw, "%s %-5s", e.createdAt.Format(time.RFC3339Nano), e.level)
+		if e.dropped {
+			fmt.Fprint(bw, " (below level)")
+		}
+		if e.topic != "" {
+			fmt.Fprintf(bw, " [%s]", e.topic)
+		}
+		if e.id == "" {
+			e.id = e.c.newID()
+		}
+		fmt.Fprintf(bw, " %s id=%s", safeResolve(e.message.resolve), e.id)
+		if e.parentID != "" {
+			fmt.Fprintf(bw, " parentID=%s", e.parentID)
+		}
+		for _, f := range e.fields {
+			fmt.Fprintf(bw, " %s", safeResolve(f.String))
+		}
+		fmt.Fprintln(bw)
+	}
+
+	fmt.Fprintln(bw, "\n== goroutines ==")
+	bw.Write(goroutineDump())
+
+	return bw.Flush()
+}
+
+// recordedField returns f as kept by the recorder: scalar and lazy values are kept as is, and other values are formatted.
+func recordedField(f Field) Field {
+	switch f.Kind {
+	case KindString, KindInt64, KindFloat64, KindBool, KindDuration, KindTime, kindLazy:
+		return f
+	default:
+		return stringField(f.Key, safeResolve(func() string { return fmt.Sprint(f.Value()) }))
+	}
+}
+
+// safeResolve evaluates lazy values of recorded events, which may panic.
+func safeResolve(fn func() string) (s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			s = fmt.Sprintf("<panic: %v>", r)
+		}
+	}()
+	return fn()
+}
+
+func goroutineDump() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+}
@@ -0,0 +1,242 @@
+package skylight
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// dumpedEvents dumps r and returns the lines of its recent events.
+func dumpedEvents(t *testing.T, r *FlightRecorder, buf *bytes.Buffer) []string {
+	t.Helper()
+	buf.Reset()
+	if _, err := r.Dump("test"); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	out = out[strings.Index(out, "== recent events"):]
+	out = out[strings.IndexByte(out, '\n')+1 : strings.Index(out, "\n\n== goroutines")]
+	if out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+func TestFlightRecorderSnapshotsValues(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewFlightRecorder(8).WithWriter(&buf)
+	c := New(WithLevel(LevelInfo), WithFlightRecorder(r), WithEnricher(func(e *Event) { e.Str("enriched", "yes") }))
+
+	items := []string{"before"}
+	c.Debugf("items %d %v", len(items), items).Any("items", items).Emit()
+	items[0] = "after"
+
+	lines := dumpedEvents(t, r, &buf)
+	if len(lines) != 1 {
+		t.Fatalf("recorded %q, want one event", lines)
+	}
+	line := lines[0]
+	if !strings.Contains(line, "(below level) items 1 [before]") || !strings.Contains(line, "items=[before]") {
+		t.Errorf("recorded event changed after it was emitted: %q", line)
+	}
+	if !strings.Contains(line, " id=") {
+		t.Errorf("recorded event has no ID: %q", line)
+	}
+	if strings.Contains(line, "enriched") {
+		t.Errorf("event below the client level was enriched: %q", line)
+	}
+}
+
+func TestFlightRecorderMessageRace(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewFlightRecorder(8).WithWriter(&buf)
+	c := New(WithFlightRecorder(r))
+
+	state := map[string]int{"n": 0}
+	c.Info("state ", state).Emit()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Dump("test")
+	}()
+	// The dump formats the message while the caller goes on with its map.
+	state["n"] = 1
+	<-done
+	if !strings.Contains(buf.String(), "state map[n:0]") {
+		t.Errorf("recorded message changed after it was emitted:\n%s", buf.String())
+	}
+}
+
+func TestFlightRecorderDefersWork(t *testing.T) {
+	var (
+		buf              bytes.Buffer
+		ids, evaluations atomic.Int32
+	)
+	r := NewFlightRecorder(8).WithWriter(&buf)
+	c := New(WithLevel(LevelInfo), WithFlightRecorder(r), WithIDGenerator(func() string {
+		ids.Add(1)
+		return "id"
+	}))
+
+	for i := 0; i < 4; i++ {
+		c.DebugFn(func() string {
+			evaluations.Add(1)
+			return "expensive"
+		}).Lazy("lazy", func() any {
+			evaluations.Add(1)
+			return 42
+		}).Emit()
+	}
+	if ids.Load() != 0 || evaluations.Load() != 0 {
+		t.Fatalf("recording generated %d IDs and evaluated %d values, want none", ids.Load(), evaluations.Load())
+	}
+
+	lines := dumpedEvents(t, r, &buf)
+	if len(lines) != 4 || !strings.Contains(lines[0], "expensive id=id lazy=42") {
+		t.Errorf("dumped %q", lines)
+	}
+	if ids.Load() != 4 || evaluations.Load() != 8 {
+		t.Errorf("dumping generated %d IDs and evaluated %d values, want 4 and 8", ids.Load(), evaluations.Load())
+	}
+}
+
+func TestFlightRecorderWrapsAround(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewFlightRecorder(3).WithWriter(&buf)
+	c := New(WithFlightRecorder(r))
+
+	for _, msg := range []string{"one", "two", "three", "four", "five"} {
+		c.Info(msg).Emit()
+	}
+	lines := dumpedEvents(t, r, &buf)
+	if len(lines) != 3 {
+		t.Fatalf("recorded %q, want the last 3 events", lines)
+	}
+	for i, want := range []string{" three ", " four ", " five "} {
+		if !strings.Contains(lines[i], want) {
+			t.Errorf("event %d = %q, want %q", i, lines[i], want)
+		}
+	}
+}
+
+func TestFlightRecorderLevel(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewFlightRecorder(8).WithWriter(&buf).WithLevel(LevelDebug)
+	c := New(WithLevel(LevelWarn), WithFlightRecorder(r))
+
+	c.Trace("trace").Emit()
+	c.Debug("debug").Emit()
+	c.Info("info").Emit()
+	c.Warn("warn").Emit()
+
+	lines := dumpedEvents(t, r, &buf)
+	if len(lines) != 3 || strings.Contains(lines[0], "trace") {
+		t.Fatalf("recorded %q, want debug and above", lines)
+	}
+	if !strings.Contains(lines[1], "(below level) info") || strings.Contains(lines[2], "below level") {
+		t.Errorf("recorded %q, want the events below the client level marked", lines)
+	}
+}
+
+func TestFlightRecorderDumpsOnFatal(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewFlightRecorder(8).WithWriter(&buf)
+	exited := 0
+	c := New(WithFlightRecorder(r), WithExitFunc(func(code int) { exited = code }))
+
+	c.Info("before").Emit()
+	if buf.Len() != 0 {
+		t.Fatal("bundle written before any fatal event")
+	}
+	c.Fatal("disk gone").Emit()
+	out := buf.String()
+	if !strings.Contains(out, "reason: fatal event: disk gone") || !strings.Contains(out, " before ") || exited != 1 {
+		t.Errorf("exit code %d, bundle:\n%s", exited, out)
+	}
+}
+
+func TestFlightRecorderDumpsOncePerPanic(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewFlightRecorder(8).WithWriter(&buf)
+	c := New(WithFlightRecorder(r))
+
+	recovered := func(fn func()) (v any) {
+		defer func() { v = recover() }()
+		defer r.Recover()
+		fn()
+		return nil
+	}
+	v := recovered(func() { c.Panic("boom").Emit() })
+	var pe *PanicError
+	if err, _ := v.(error); !errors.As(err, &pe) {
+		t.Fatalf("recovered %v, want the *PanicError", v)
+	}
+	if n := strings.Count(buf.String(), "skylight crash bundle"); n != 1 {
+		t.Errorf("a panic event wrote %d bundles, want 1", n)
+	}
+
+	buf.Reset()
+	if v := recovered(func() { panic("plain") }); v != "plain" {
+		t.Fatalf("recovered %v, want the original value", v)
+	}
+	if n := strings.Count(buf.String(), "skylight crash bundle"); n != 1 || !strings.Contains(buf.String(), "reason: panic: plain") {
+		t.Errorf("a plain panic wrote %d bundles:\n%s", n, buf.String())
+	}
+
+	// The panic event of a client without r gets its bundle from Recover.
+	buf.Reset()
+	other := New()
+	recovered(func() { other.Panic("elsewhere").Emit() })
+	if !strings.Contains(buf.String(), "reason: panic: skylight: panic: elsewhere") {
+		t.Errorf("the panic of another client wasn't dumped:\n%s", buf.String())
+	}
+}
+
+func TestFlightRecorderDumpsRecoveredPanics(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewFlightRecorder(8).WithWriter(&buf)
+	done := make(chan struct{})
+	c := New(WithFlightRecorder(r), WithObserver(TopicObserver("goroutine", func(e *Event) { done <- struct{}{} })))
+	bundles := func() int { return strings.Count(buf.String(), "skylight crash bundle") }
+
+	c.Go(context.Background(), "crash", func(ctx context.Context) error { panic("boom") })
+	<-done
+	if bundles() != 1 || !strings.Contains(buf.String(), "reason: panic: boom") || !strings.Contains(buf.String(), "panic=boom") {
+		t.Errorf("a panic recovered by Go wrote %d bundles:\n%s", bundles(), buf.String())
+	}
+
+	// A resumed panic has its bundle already, when it's recovered again by Go or FlightRecorder.Recover.
+	buf.Reset()
+	c.Go(context.Background(), "resumed", func(ctx context.Context) error {
+		defer c.Recover(true)
+		panic("again")
+	})
+	<-done
+	if bundles() != 1 {
+		t.Errorf("a resumed panic recovered by Go wrote %d bundles", bundles())
+	}
+
+	buf.Reset()
+	func() {
+		defer func() { recover() }()
+		defer r.Recover()
+		defer c.Recover(true)
+		panic("twice")
+	}()
+	if bundles() != 1 {
+		t.Errorf("a resumed panic recovered by the recorder wrote %d bundles", bundles())
+	}
+
+	// A swallowed panic gets a bundle too.
+	buf.Reset()
+	func() {
+		defer c.Recover()
+		panic("swallowed")
+	}()
+	if bundles() != 1 || !strings.Contains(buf.String(), "reason: panic: swallowed") {
+		t.Errorf("a recovered panic wrote %d bundles", bundles())
+	}
+}
@@ -0,0 +1,80 @@
+package skylight
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HTTPSink posts batches of events to a URL as a JSON object holding the schema version, the shared resource and the events, see SchemaVersion.
+// Client errors other than 408 and 429 are reported as permanent, since retrying the same batch won't succeed.
+type HTTPSink struct {
+	url    string
+	client *http.Client
+	header http.Header
+}
+
+// NewHTTPSink creates a sink posting to url with http.DefaultClient.
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{
+		url:    url,
+		client: http.DefaultClient,
+		header: make(http.Header),
+	}
+}
+
+// WithClient sets the HTTP client used to post batches.
+func (s *HTTPSink) WithClient(c *http.Client) *HTTPSink {
+	if s == nil {
+		return nil
+	}
+	s.client = c
+	return s
+}
+
+// WithHeader adds a header to every request, e.g. for authentication.
+func (s *HTTPSink) WithHeader(key, value string) *HTTPSink {
+	if s == nil {
+		return nil
+	}
+	s.header.Add(key, value)
+	return s
+}
+
+func (s *HTTPSink) Write(ctx context.Context, events []EventSnapshot) error {
+	body, err := encodeBatch(events)
+	if err != nil {
+		return Permanent(fmt.Errorf("skylight: http sink: %w", err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(fmt.Errorf("skylight: http sink: %w", err))
+	}
+	for k, v := range s.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("skylight: http sink: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("skylight: http sink: %s", resp.Status)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
+
+func (s *HTTPSink) Flush(ctx context.Context) error { return nil }
+
+func (s *HTTPSink) Close(ctx context.Context) error { return nil }
@@ -0,0 +1,142 @@
+package skylight
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+// IDGenerator returns a new, unique event ID.
+// The client calls it lazily, the first time an event ID is read or the event is handed to an observer.
+type IDGenerator func() string
+
+var defaultIDGenerator = NanoIDGenerator()
+
+// NanoIDGenerator generates 16 character nanoid IDs. It is the default generator.
+func NanoIDGenerator() IDGenerator {
+	return func() string {
+		return gonanoid.Must(16)
+	}
+}
+
+// RandomIDGenerator generates fast random 64-bit IDs, encoded as 16 hex characters.
+func RandomIDGenerator() IDGenerator {
+	return func() string {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], rand.Uint64())
+		return hex.EncodeToString(b[:])
+	}
+}
+
+// W3CTraceIDGenerator generates IDs compatible with W3C trace context trace IDs: 16 random bytes encoded as 32 lowercase hex characters, never all zero.
+func W3CTraceIDGenerator() IDGenerator {
+	return func() string {
+		var b [16]byte
+		for hi, lo := uint64(0), uint64(0); hi == 0 && lo == 0; {
+			hi, lo = rand.Uint64(), rand.Uint64()
+			binary.BigEndian.PutUint64(b[:8], hi)
+			binary.BigEndian.PutUint64(b[8:], lo)
+		}
+		return hex.EncodeToString(b[:])
+	}
+}
+
+// W3CSpanIDGenerator generates IDs compatible with W3C trace context parent IDs: 8 random bytes encoded as 16 lowercase hex characters, never all zero.
+func W3CSpanIDGenerator() IDGenerator {
+	return func() string {
+		var b [8]byte
+		v := rand.Uint64()
+		for v == 0 {
+			v = rand.Uint64()
+		}
+		binary.BigEndian.PutUint64(b[:], v)
+		return hex.EncodeToString(b[:])
+	}
+}
+
+// SequentialIDGenerator generates deterministic IDs made of prefix and an increasing counter starting at 1.
+// It is meant for tests.
+func SequentialIDGenerator(prefix string) IDGenerator {
+	var n atomic.Uint64
+	return func() string {
+		return prefix + strconv.FormatUint(n.Add(1), 10)
+	}
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator generates lexicographically sortable ULIDs.
+// IDs generated within the same millisecond are kept in order by incrementing the random part.
+func ULIDGenerator() IDGenerator {
+	var (
+		mu     sync.Mutex
+		lastMs uint64
+		hi     uint16
+		lo     uint64
+	)
+	return func() string {
+		mu.Lock()
+		ms := uint64(time.Now().UnixMilli())
+		if ms > lastMs {
+			lastMs = ms
+			hi, lo = uint16(rand.Uint32()), rand.Uint64()
+		} else {
+			// Same (or an earlier) millisecond: keep the previous timestamp and increment the entropy.
+			ms = lastMs
+			lo++
+			if lo == 0 {
+				hi++
+			}
+		}
+		h, l := hi, lo
+		mu.Unlock()
+
+		var b [16]byte
+		b[0] = byte(ms >> 40)
+		b[1] = byte(ms >> 32)
+		b[2] = byte(ms >> 24)
+		b[3] = byte(ms >> 16)
+		b[4] = byte(ms >> 8)
+		b[5] = byte(ms)
+		binary.BigEndian.PutUint16(b[6:8], h)
+		binary.BigEndian.PutUint64(b[8:], l)
+		return encodeULID(b)
+	}
+}
+
+func encodeULID(b [16]byte) string {
+	var dst [26]byte
+	dst[0] = crockford[(b[0]&224)>>5]
+	dst[1] = crockford[b[0]&31]
+	dst[2] = crockford[(b[1]&248)>>3]
+	dst[3] = crockford[((b[1]&7)<<2)|((b[2]&192)>>6)]
+	dst[4] = crockford[(b[2]&62)>>1]
+	dst[5] = crockford[((b[2]&1)<<4)|((b[3]&240)>>4)]
+	dst[6] = crockford[((b[3]&15)<<1)|((b[4]&128)>>7)]
+	dst[7] = crockford[(b[4]&124)>>2]
+	dst[8] = crockford[((b[4]&3)<<3)|((b[5]&224)>>5)]
+	dst[9] = crockford[b[5]&31]
+	dst[10] = crockford[(b[6]&248)>>3]
+	dst[11] = crockford[((b[6]&7)<<2)|((b[7]&192)>>6)]
+	dst[12] = crockford[(b[7]&62)>>1]
+	dst[13] = crockford[((b[7]&1)<<4)|((b[8]&240)>>4)]
+	dst[14] = crockford[((b[8]&15)<<1)|((b[9]&128)>>7)]
+	dst[15] = crockford[(b[9]&124)>>2]
+	dst[16] = crockford[((b[9]&3)<<3)|((b[10]&224)>>5)]
+	dst[17] = crockford[b[10]&31]
+	dst[18] = crockford[(b[11]&248)>>3]
+	dst[19] = crockford[((b[11]&7)<<2)|((b[12]&192)>>6)]
+	dst[20] = crockford[(b[12]&62)>>1]
+	dst[21] = crockford[((b[12]&1)<<4)|((b[13]&240)>>4)]
+	dst[22] = crockford[((b[13]&15)<<1)|((b[14]&128)>>7)]
+	dst[23] = crockford[(b[14]&124)>>2]
+	dst[24] = crockford[((b[14]&3)<<3)|((b[15]&224)>>5)]
+	dst[25] = crockford[b[15]&31]
+	return string(dst[:])
+}
@@ -0,0 +1,89 @@
+package skylight
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIDGeneratorFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		gen    IDGenerator
+		format string
+	}{
+		{"nanoid", NanoIDGenerator(), `^[A-Za-z0-9_-]{16}$`},
+		{"random", RandomIDGenerator(), `^[0-9a-f]{16}$`},
+		{"w3c trace", W3CTraceIDGenerator(), `^[0-9a-f]{32}$`},
+		{"w3c span", W3CSpanIDGenerator(), `^[0-9a-f]{16}$`},
+		{"ulid", ULIDGenerator(), `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`},
+		{"sequential", SequentialIDGenerator("req-"), `^req-[1-9][0-9]*$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format := regexp.MustCompile(tt.format)
+			const goroutines, perGoroutine = 8, 1000
+			ids := make(chan string, goroutines*perGoroutine)
+			var wg sync.WaitGroup
+			for i := 0; i < goroutines; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < perGoroutine; j++ {
+						ids <- tt.gen()
+					}
+				}()
+			}
+			wg.Wait()
+			close(ids)
+
+			seen := make(map[string]bool, goroutines*perGoroutine)
+			for id := range ids {
+				if !format.MatchString(id) {
+					t.Fatalf("ID %q doesn't match %s", id, tt.format)
+				}
+				if strings.Trim(id, "0") == "" {
+					t.Fatalf("ID %q is all zero", id)
+				}
+				if seen[id] {
+					t.Fatalf("ID %q generated twice", id)
+				}
+				seen[id] = true
+			}
+		})
+	}
+}
+
+func TestSequentialIDGenerator(t *testing.T) {
+	gen := SequentialIDGenerator("e")
+	for _, want := range []string{"e1", "e2", "e3"} {
+		if got := gen(); got != want {
+			t.Errorf("ID = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestULIDOrder(t *testing.T) {
+	gen := ULIDGenerator()
+	before := time.Now().UnixMilli()
+	prev := gen()
+	// Many IDs share a millisecond, and are then ordered by their incremented entropy.
+	for i := 0; i < 10000; i++ {
+		id := gen()
+		if id <= prev {
+			t.Fatalf("ULID %q generated after %q", id, prev)
+		}
+		prev = id
+	}
+	after := time.Now().UnixMilli()
+
+	var ms int64
+	for _, c := range prev[:10] {
+		ms = ms<<5 | int64(strings.IndexRune(crockford, c))
+	}
+	if ms < before || ms > after {
+		t.Errorf("ULID timestamp %d outside [%d, %d]", ms, before, after)
+	}
+}
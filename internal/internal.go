@@ -0,0 +1,34 @@
+// Package internal gives the skylight subpackages access to the unexported parts of skylight they share.
+// Its hooks are set by skylight when it is initialized.
+package internal
+
+import (
+	"context"
+	"fmt"
+)
+
+// Hooks are the unexported operations of skylight used by its subpackages. This package can't import skylight,
+// so C, E and L stand for *skylight.Client, *skylight.Event and skylight.Level.
+type Hooks[C, E, L any] struct {
+	// BeginEvent creates an event whose level is only known once the operation it describes completes.
+	BeginEvent func(ctx context.Context, c C) E
+	// EndEvent emits an event created by BeginEvent at the given level, or drops it when the level is filtered out.
+	EndEvent func(e E, level L)
+}
+
+var hooks any
+
+// SetHooks is called by skylight when it is initialized.
+func SetHooks[C, E, L any](h Hooks[C, E, L]) {
+	hooks = h
+}
+
+// GetHooks returns the hooks set by skylight, to be called from the initialization of a subpackage.
+// It panics when C, E and L aren't the types skylight set them with.
+func GetHooks[C, E, L any]() Hooks[C, E, L] {
+	h, ok := hooks.(Hooks[C, E, L])
+	if !ok {
+		panic(fmt.Sprintf("skylight: internal hooks are %T, not %T", hooks, h))
+	}
+	return h
+}
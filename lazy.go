@@ -0,0 +1,317 @@
+package skylight
+
+import (
+	"fmt"
+	"time"
+)
+
+// kindLazy marks a field whose value is computed by a func() any when the event is consumed.
+const kindLazy FieldKind = 255
+
+type msgState uint8
+
+const (
+	msgResolved msgState = iota
+	msgPrint
+	msgPrintf
+	msgFunc
+)
+
+// lazyMessage is an event message that is only formatted once something reads it.
+type lazyMessage struct {
+	state  msgState
+	text   string
+	format string
+	args   []any
+	fn     func() string
+}
+
+func (m *lazyMessage) resolve() string {
+	switch m.state {
+	case msgPrint:
+		m.text = fmt.Sprint(m.args...)
+	case msgPrintf:
+		m.text = fmt.Sprintf(m.format, m.args...)
+	case msgFunc:
+		m.text = m.fn()
+	}
+	*m = lazyMessage{text: m.text}
+	return m.text
+}
+
+// print sets the message formatted from args by fmt.Sprint. Formatting is deferred until the message is read when args
+// are scalars, which can't change. Other arguments, such as pointers, maps or Stringers, belong to the caller, which may
+// modify them once the call returns, so they are formatted right away: only the Fn forms defer that.
+func (e *Event) print(args []any) *Event {
+	if e == nil {
+		return nil
+	}
+	e.message = lazyMessage{state: msgPrint, args: args}
+	if !scalarArgs(args) {
+		e.message.resolve()
+	}
+	return e
+}
+
+// printf sets the message formatted from format and args by fmt.Sprintf, deferred like print.
+func (e *Event) printf(format string, args []any) *Event {
+	if e == nil {
+		return nil
+	}
+	e.message = lazyMessage{state: msgPrintf, format: format, args: args}
+	if !scalarArgs(args) {
+		e.message.resolve()
+	}
+	return e
+}
+
+// scalarArgs reports whether the message arguments args are all of basic types, which can be formatted later.
+func scalarArgs(args []any) bool {
+	for _, a := range args {
+		switch a.(type) {
+		case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr,
+			float32, float64, complex64, complex128, time.Duration:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Event) printFn(fn func() string) *Event {
+	if e == nil {
+		return nil
+	}
+	if fn == nil {
+		e.message = lazyMessage{}
+		return e
+	}
+	e.message = lazyMessage{state: msgFunc, fn: fn}
+	return e
+}
+
+// msg returns the event message, formatting it on first use.
+func (e *Event) msg() string {
+	return e.message.resolve()
+}
+
+// resolve evaluates the lazy message and fields of the event.
+func (e *Event) resolve() {
+	e.message.resolve()
+	if !e.lazyFields {
+		return
+	}
+	for i, f := range e.fields {
+		if f.Kind == kindLazy {
+			e.fields[i] = f.resolve()
+		}
+	}
+	e.lazyFields = false
+}
+
+func (f Field) resolve() Field {
+	fn, _ := f.obj.(func() any)
+	if fn == nil {
+		return Field{Key: f.Key, Kind: KindAny}
+	}
+	return anyField(f.Key, fn())
+}
+
+// Lazy adds a field whose value is computed by fn only if an observer consumes the event.
+func (e *Event) Lazy(key string, fn func() any) *Event {
+	if !e.live() {
+		return e
+	}
+	e.lazyFields = true
+	return e.setField(Field{Key: key, Kind: kindLazy, obj: fn})
+}
+
+// Enabled reports whether an event with the given level and topic would reach an observer.
+// It is meant to guard expensive work; events below the client level are then also skipped by the flight recorder.
+func (c *Client) Enabled(level Level, topic string) bool {
+	if c == nil || level < c.level {
+		return false
+	}
+	for _, o := range c.observers {
+		if o.enabled == nil || o.enabled(level, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// Enabled reports whether an event with the given level and the emitter's topic would reach an observer.
+func (em *Emitter) Enabled(level Level) bool {
+	if em == nil {
+		return false
+	}
+	return em.c.Enabled(level, em.topic)
+}
+
+// TraceFn creates a new event with the trace level and associates it with the client.
+// The message is computed by fn only if an observer consumes the event.
+func (c *Client) TraceFn(fn func() string) *Event {
+	return newEvent(LevelTrace, c).printFn(fn)
+}
+
+// DebugFn creates a new event with the debug level and associates it with the client.
+// The message is computed by fn only if an observer consumes the event.
+func (c *Client) DebugFn(fn func() string) *Event {
+	return newEvent(LevelDebug, c).printFn(fn)
+}
+
+// InfoFn creates a new event with the info level and associates it with the client.
+// The message is computed by fn only if an observer consumes the event.
+func (c *Client) InfoFn(fn func() string) *Event {
+	return newEvent(LevelInfo, c).printFn(fn)
+}
+
+// WarnFn creates a new event with the warn level and associates it with the client.
+// The message is computed by fn only if an observer consumes the event.
+func (c *Client) WarnFn(fn func() string) *Event {
+	return newEvent(LevelWarn, c).printFn(fn)
+}
+
+// ErrorFn creates a new event with the error level and associates it with the client.
+// The message is computed by fn only if an observer consumes the event.
+func (c *Client) ErrorFn(fn func() string) *Event {
+	return newEvent(LevelError, c).printFn(fn)
+}
+
+// FatalFn creates a new event with the fatal level and associates it with the client.
+// The message is computed by fn only if an observer consumes the event.
+func (c *Client) FatalFn(fn func() string) *Event {
+	return newEvent(LevelFatal, c).printFn(fn)
+}
+
+// PanicFn creates a new event with the panic level and associates it with the client.
+// The message is computed by fn only if an observer consumes the event.
+func (c *Client) PanicFn(fn func() string) *Event {
+	return newEvent(LevelPanic, c).printFn(fn)
+}
+
+// TraceFn creates a new event with the trace level and associates it with the default client.
+// The message is computed by fn only if an observer consumes the event.
+func TraceFn(fn func() string) *Event {
+	return newEvent(LevelTrace, defaultClient).printFn(fn)
+}
+
+// DebugFn creates a new event with the debug level and associates it with the default client.
+// The message is computed by fn only if an observer consumes the event.
+func DebugFn(fn func() string) *Event {
+	return newEvent(LevelDebug, defaultClient).printFn(fn)
+}
+
+// InfoFn creates a new event with the info level and associates it with the default client.
+// The message is computed by fn only if an observer consumes the event.
+func InfoFn(fn func() string) *Event {
+	return newEvent(LevelInfo, defaultClient).printFn(fn)
+}
+
+// WarnFn creates a new event with the warn level and associates it with the default client.
+// The message is computed by fn only if an observer consumes the event.
+func WarnFn(fn func() string) *Event {
+	return newEvent(LevelWarn, defaultClient).printFn(fn)
+}
+
+// ErrorFn creates a new event with the error level and associates it with the default client.
+// The message is computed by fn only if an observer consumes the event.
+func ErrorFn(fn func() string) *Event {
+	return newEvent(LevelError, defaultClient).printFn(fn)
+}
+
+// FatalFn creates a new event with the fatal level and associates it with the default client.
+// The message is computed by fn only if an observer consumes the event.
+func FatalFn(fn func() string) *Event {
+	return newEvent(LevelFatal, defaultClient).printFn(fn)
+}
+
+// PanicFn creates a new event with the panic level and associates it with the default client.
+// The message is computed by fn only if an observer consumes the event.
+func PanicFn(fn func() string) *Event {
+	return newEvent(LevelPanic, defaultClient).printFn(fn)
+}
+
+// TraceFn creates a new event with the trace level, stamped with the emitter's bound fields, topic and parent.
+// The message is computed by fn only if an observer consumes the event.
+func (em *Emitter) TraceFn(fn func() string) *Event {
+	return em.newEvent(LevelTrace).printFn(fn)
+}
+
+// DebugFn creates a new event with the debug level, stamped with the emitter's bound fields, topic and parent.
+// The message is computed by fn only if an observer consumes the event.
+func (em *Emitter) DebugFn(fn func() string) *Event {
+	return em.newEvent(LevelDebug).printFn(fn)
+}
+
+// InfoFn creates a new event with the info level, stamped with the emitter's bound fields, topic and parent.
+// The message is computed by fn only if an observer consumes the event.
+func (em *Emitter) InfoFn(fn func() string) *Event {
+	return em.newEvent(LevelInfo).printFn(fn)
+}
+
+// WarnFn creates a new event with the warn level, stamped with the emitter's bound fields, topic and parent.
+// The message is computed by fn only if an observer consumes the event.
+func (em *Emitter) WarnFn(fn func() string) *Event {
+	return em.newEvent(LevelWarn).printFn(fn)
+}
+
+// ErrorFn creates a new event with the error level, stamped with the emitter's bound fields, topic and parent.
+// The message is computed by fn only if an observer consumes the event.
+func (em *Emitter) ErrorFn(fn func() string) *Event {
+	return em.newEvent(LevelError).printFn(fn)
+}
+
+// FatalFn creates a new event with the fatal level, stamped with the emitter's bound fields, topic and parent.
+// The message is computed by fn only if an observer consumes the event.
+func (em *Emitter) FatalFn(fn func() string) *Event {
+	return em.newEvent(LevelFatal).printFn(fn)
+}
+
+// PanicFn creates a new event with the panic level, stamped with the emitter's bound fields, topic and parent.
+// The message is computed by fn only if an observer consumes the event.
+func (em *Emitter) PanicFn(fn func() string) *Event {
+	return em.newEvent(LevelPanic).printFn(fn)
+}
+
+// TraceFn creates a child event with the trace level and sets the parentID to the current event's ID.
+// The message is computed by fn only if an observer consumes the event.
+func (e *Event) TraceFn(fn func() string) *Event {
+	return newChildEvent(LevelTrace, e).printFn(fn)
+}
+
+// DebugFn creates a child event with the debug level and sets the parentID to the current event's ID.
+// The message is computed by fn only if an observer consumes the event.
+func (e *Event) DebugFn(fn func() string) *Event {
+	return newChildEvent(LevelDebug, e).printFn(fn)
+}
+
+// InfoFn creates a child event with the info level and sets the parentID to the current event's ID.
+// The message is computed by fn only if an observer consumes the event.
+func (e *Event) InfoFn(fn func() string) *Event {
+	return newChildEvent(LevelInfo, e).printFn(fn)
+}
+
+// WarnFn creates a child event with the warn level and sets the parentID to the current event's ID.
+// The message is computed by fn only if an observer consumes the event.
+func (e *Event) WarnFn(fn func() string) *Event {
+	return newChildEvent(LevelWarn, e).printFn(fn)
+}
+
+// ErrorFn creates a child event with the error level and sets the parentID to the current event's ID.
+// The message is computed by fn only if an observer consumes the event.
+func (e *Event) ErrorFn(fn func() string) *Event {
+	return newChildEvent(LevelError, e).printFn(fn)
+}
+
+// FatalFn creates a child event with the fatal level and sets the parentID to the current event's ID.
+// The message is computed by fn only if an observer consumes the event.
+func (e *Event) FatalFn(fn func() string) *Event {
+	return newChildEvent(LevelFatal, e).printFn(fn)
+}
+
+// PanicFn creates a child event with the panic level and sets the parentID to the current event's ID.
+// The message is computed by fn only if an observer consumes the event.
+func (e *Event) PanicFn(fn func() string) *Event {
+	return newChildEvent(LevelPanic, e).printFn(fn)
+}
@@ -0,0 +1,134 @@
+package skylight
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+// evaluations counts the lazy messages and values computed by a test.
+type evaluations struct{ n atomic.Int32 }
+
+func (ev *evaluations) message() string {
+	ev.n.Add(1)
+	return "expensive"
+}
+
+func (ev *evaluations) value() any {
+	ev.n.Add(1)
+	return 42
+}
+
+// String makes ev a fmt.Stringer counting its formatting.
+func (ev *evaluations) String() string {
+	ev.n.Add(1)
+	return "formatted"
+}
+
+func TestLazySkipsFilteredEvents(t *testing.T) {
+	var ev evaluations
+	c := New(WithLevel(LevelInfo), WithObserver(WildcardObserver(func(e *Event) { e.Snapshot() })))
+	em := c.With(Fields{"a": 1})
+	root := c.Info("request").Emit(true)
+	defer root.Evict()
+
+	c.DebugFn(ev.message).Lazy("lazy", ev.value).Emit()
+	c.Debug(&ev).Emit()
+	c.Debugf("%s", &ev).Emit()
+	em.TraceFn(ev.message).Lazy("lazy", ev.value).Emit()
+	root.DebugFn(ev.message).Lazy("lazy", ev.value).Emit()
+	if n := ev.n.Load(); n != 0 {
+		t.Errorf("evaluated %d times for events below the client level, want 0", n)
+	}
+}
+
+func TestLazySkipsUnobservedEvents(t *testing.T) {
+	var (
+		ev     evaluations
+		events []EventSnapshot
+	)
+	c := New(WithObserver(TopicObserver("db", func(e *Event) { events = append(events, e.Snapshot()) })))
+
+	c.InfoFn(ev.message).Lazy("lazy", ev.value).Topic("http").Emit()
+	if n := ev.n.Load(); n != 0 {
+		t.Errorf("evaluated %d times for events no observer matches, want 0", n)
+	}
+	// Only the Fn forms defer a Stringer, which may change once the call returns.
+	c.WithTopic("http").Warnf("%s", &ev).Emit()
+	if n := ev.n.Load(); n != 1 {
+		t.Errorf("formatted %d times for a Stringer argument, want 1", n)
+	}
+
+	ev.n.Store(0)
+	c.InfoFn(ev.message).Lazy("lazy", ev.value).Topic("db").Emit()
+	c.WithTopic("db").Warnf("%s", &ev).Emit()
+	if n := ev.n.Load(); n != 3 {
+		t.Errorf("evaluated %d times for observed events, want 3", n)
+	}
+	if len(events) != 2 || events[0].Message != "expensive" || fieldValues(events[0])["lazy"] != "42" || events[1].Message != "formatted" {
+		t.Errorf("observed %v", events)
+	}
+}
+
+func TestMessageArgumentsAtCall(t *testing.T) {
+	var messages []string
+	c := New(WithObserver(WildcardObserver(func(e *Event) { messages = append(messages, e.msg()) })))
+
+	user := map[string]int{"id": 1}
+	ids := []int{1}
+	e := c.Infof("user %v", user)
+	f := c.Info("ids ", ids, " of ", 1)
+	user["id"], ids[0] = 2, 2
+	e.Emit()
+	f.Emit()
+	if len(messages) != 2 || messages[0] != "user map[id:1]" || messages[1] != "ids [1] of 1" {
+		t.Errorf("messages = %q, want the arguments as they were at the call", messages)
+	}
+}
+
+func TestLazyNilFuncs(t *testing.T) {
+	var events []EventSnapshot
+	c := New(WithObserver(WildcardObserver(func(e *Event) { events = append(events, e.Snapshot()) })))
+
+	c.InfoFn(nil).Lazy("lazy", nil).Emit()
+	if len(events) != 1 || events[0].Message != "" {
+		t.Fatalf("observed %v, want one event without a message", events)
+	}
+	if f, ok := events[0].Field("lazy"); !ok || f.Value() != nil || f.Kind != KindAny {
+		t.Errorf("lazy field = %v, want a nil value", f)
+	}
+}
+
+func TestClientEnabled(t *testing.T) {
+	c := New(WithLevel(LevelInfo), WithObserver(TopicObserver("db", func(e *Event) {})))
+	tests := []struct {
+		level Level
+		topic string
+		want  bool
+	}{
+		{LevelDebug, "db", false},
+		{LevelInfo, "db", true},
+		{LevelError, "db", true},
+		{LevelError, "http", false},
+	}
+	for _, tt := range tests {
+		if got := c.Enabled(tt.level, tt.topic); got != tt.want {
+			t.Errorf("Enabled(%v, %q) = %v, want %v", tt.level, tt.topic, got, tt.want)
+		}
+	}
+	if !c.WithTopic("db").Enabled(LevelWarn) || c.WithTopic("http").Enabled(LevelWarn) {
+		t.Error("emitter Enabled doesn't follow its topic")
+	}
+
+	// Observers without a condition known ahead of time accept every level and topic above the client level.
+	all := New(WithLevel(LevelInfo), WithObserver(WildcardObserver(func(e *Event) {})))
+	if !all.Enabled(LevelInfo, "any") || all.Enabled(LevelDebug, "any") {
+		t.Error("wildcard observer not enabled for every topic above the client level")
+	}
+	if New().Enabled(LevelError, "") {
+		t.Error("client without observers enabled")
+	}
+	var nilClient *Client
+	if nilClient.Enabled(LevelError, "") || nilClient.WithTopic("db").Enabled(LevelError) {
+		t.Error("nil client enabled")
+	}
+}
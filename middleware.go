@@ -0,0 +1,204 @@
+package skylight
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// MiddlewareOption configures Middleware.
+type MiddlewareOption func(m *middleware)
+
+type middleware struct {
+	c               *Client
+	route           func(r *http.Request) string
+	propagator      Propagator
+	requestIDHeader string
+	verbosityHeader string
+}
+
+// WithRoute sets the function naming the route of a request, e.g. from the router. It defaults to the URL path.
+func WithRoute(fn func(r *http.Request) string) MiddlewareOption {
+	return func(m *middleware) {
+		m.route = fn
+	}
+}
+
+// WithPropagator sets the propagator extracting the remote parent of requests. It defaults to DefaultPropagator;
+// nil ignores incoming trace context.
+func WithPropagator(p Propagator) MiddlewareOption {
+	return func(m *middleware) {
+		m.propagator = p
+	}
+}
+
+// WithRequestIDHeader sets the header the request ID is read from, and written back to the response.
+// It defaults to X-Request-Id. Requests without it use the ID of their event.
+func WithRequestIDHeader(header string) MiddlewareOption {
+	return func(m *middleware) {
+		m.requestIDHeader = header
+	}
+}
+
+// WithVerbosityHeader honors header on incoming requests: a level name, such as "debug", lowers the client level for
+// the events of that request only. It is disabled by default, and should only be enabled behind trusted proxies.
+func WithVerbosityHeader(header string) MiddlewareOption {
+	return func(m *middleware) {
+		m.verbosityHeader = header
+	}
+}
+
+// Middleware returns HTTP middleware creating a root event for every request, with the "http.request" topic.
+// The event is stored in the request context, see EventFromContext, so that the events of handlers become its children.
+// It is emitted once the request completes, with its status, size and latency, at a level picked from the status class:
+// error for 5xx, warn for 4xx and info otherwise.
+func Middleware(c *Client, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	m := &middleware{
+		c:               c,
+		route:           func(r *http.Request) string { return r.URL.Path },
+		propagator:      DefaultPropagator(),
+		requestIDHeader: "X-Request-Id",
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m.wrap
+}
+
+func (m *middleware) wrap(next http.Handler) http.Handler {
+	if m.c == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verbosity := LevelNone
+		if m.verbosityHeader != "" {
+			if l, err := ParseLevel(r.Header.Get(m.verbosityHeader)); err == nil {
+				verbosity = l
+			}
+		}
+
+		e := acquireEvent(LevelInfo, m.c, verbosity, true)
+		if m.propagator != nil {
+			if p, ok := m.propagator.Extract(HeaderCarrier(r.Header)); ok {
+				e.RemoteParent(p)
+			}
+		}
+		route := m.route(r)
+		requestID := r.Header.Get(m.requestIDHeader)
+		if requestID == "" {
+			requestID = e.ID()
+		}
+		w.Header().Set(m.requestIDHeader, requestID)
+
+		e.Topic("http.request").
+			Messagef("%s %s", r.Method, route).
+			Str("method", r.Method).
+			Str("route", route).
+			Str("remote_addr", r.RemoteAddr).
+			Str("request_id", requestID)
+
+		rw := &responseWriter{ResponseWriter: w}
+		start := time.Now()
+		defer func() {
+			if p := recover(); p != nil {
+				if rw.status == 0 {
+					rw.status = http.StatusInternalServerError
+				}
+				m.complete(e, rw, time.Since(start), fmt.Errorf("panic: %v", p))
+				panic(p)
+			}
+			m.complete(e, rw, time.Since(start), nil)
+		}()
+		next.ServeHTTP(rw, r.WithContext(ContextWithEvent(r.Context(), e)))
+	})
+}
+
+func (m *middleware) complete(e *Event, rw *responseWriter, d time.Duration, err error) {
+	if rw.hijacked {
+		// The handler took over the connection, e.g. for a websocket: what it sent is unknown.
+		e.Bool("hijacked", true)
+	} else if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	if rw.status != 0 {
+		e.Int("status", rw.status)
+	}
+	e.Int64("bytes", rw.bytes).
+		Dur("duration", d).
+		Err("error", err).
+		end(statusLevel(rw.status))
+}
+
+// statusLevel picks the level of an HTTP exchange from its status class.
+func statusLevel(status int) Level {
+	switch {
+	case status >= 500:
+		return LevelError
+	case status >= 400:
+		return LevelWarn
+	default:
+		return LevelInfo
+	}
+}
+
+// responseWriter records the status and size of a response, and whether the connection was hijacked.
+type responseWriter struct {
+	http.ResponseWriter
+	status   int
+	bytes    int64
+	hijacked bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher when the underlying writer does.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying writer does, e.g. for websockets.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Push implements http.Pusher when the underlying writer does.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
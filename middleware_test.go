@@ -0,0 +1,243 @@
+package skylight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func snapshotObserver(events chan<- EventSnapshot) *Observer {
+	return WildcardObserver(func(e *Event) { events <- e.Snapshot() })
+}
+
+func receive(t *testing.T, events <-chan EventSnapshot) EventSnapshot {
+	t.Helper()
+	select {
+	case s := <-events:
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event emitted")
+		return EventSnapshot{}
+	}
+}
+
+func TestMiddlewareParentsChildrenAfterTheRequest(t *testing.T) {
+	events := make(chan EventSnapshot, 16)
+	c := New(WithObserver(snapshotObserver(events)))
+
+	contexts := make(chan context.Context, 1)
+	srv := httptest.NewServer(Middleware(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contexts <- r.Context()
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	request := receive(t, events)
+
+	// A goroutine started by the handler outlives the request, while other events reuse pooled state.
+	ctx := <-contexts
+	for i := 0; i < 10; i++ {
+		c.Info("unrelated").Emit()
+		receive(t, events)
+	}
+	EventFromContext(ctx).Info("late child").Emit()
+	child := receive(t, events)
+	if child.ParentID != request.ID || child.TraceID != request.TraceID {
+		t.Errorf("late child has parent %q in trace %q, want %q in trace %q",
+			child.ParentID, child.TraceID, request.ID, request.TraceID)
+	}
+}
+
+func TestMiddlewareHijack(t *testing.T) {
+	events := make(chan EventSnapshot, 1)
+	c := New(WithObserver(snapshotObserver(events)))
+
+	srv := httptest.NewServer(Middleware(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+		buf.Flush()
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "ok" {
+		t.Errorf("body = %q", body)
+	}
+	resp.Body.Close()
+
+	e := receive(t, events)
+	if f, ok := e.Field("hijacked"); !ok || f.Value() != true {
+		t.Errorf("hijacked = %v, %v", f.Value(), ok)
+	}
+	if _, ok := e.Field("status"); ok {
+		t.Error("hijacked request has a status")
+	}
+}
+
+// serve runs one request through h wrapped in Middleware, and returns the response and the event of the request.
+func serve(t *testing.T, c *Client, events <-chan EventSnapshot, r *http.Request, h http.HandlerFunc, opts ...MiddlewareOption) (*httptest.ResponseRecorder, EventSnapshot) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Middleware(c, opts...)(h).ServeHTTP(rec, r)
+	return rec, receive(t, events)
+}
+
+func TestMiddlewareStatusLevels(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		level   Level
+	}{
+		{"implicit", func(w http.ResponseWriter, r *http.Request) {}, 200, LevelInfo},
+		{"write", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }, 200, LevelInfo},
+		{"created", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(201) }, 201, LevelInfo},
+		{"redirect", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(302) }, 302, LevelInfo},
+		{"not found", func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) }, 404, LevelWarn},
+		{"client closed", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(499) }, 499, LevelWarn},
+		{"internal error", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(500) }, 500, LevelError},
+		{"unavailable", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(503); w.WriteHeader(200) }, 503, LevelError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := make(chan EventSnapshot, 1)
+			c := New(WithObserver(snapshotObserver(events)))
+			rec, e := serve(t, c, events, httptest.NewRequest("GET", "/users/42", nil), tt.handler)
+			if rec.Code != tt.status {
+				t.Errorf("response status %d, want %d", rec.Code, tt.status)
+			}
+			if f, _ := e.Field("status"); f.Value() != int64(tt.status) || e.Level != tt.level {
+				t.Errorf("event with status %v at level %v, want %d at %v", f.Value(), e.Level, tt.status, tt.level)
+			}
+			if e.Topic != "http.request" || e.Message != "GET /users/42" {
+				t.Errorf("event [%s] %q", e.Topic, e.Message)
+			}
+		})
+	}
+}
+
+func TestMiddlewareBytesAndDuration(t *testing.T) {
+	events := make(chan EventSnapshot, 1)
+	c := New(WithObserver(snapshotObserver(events)))
+	_, e := serve(t, c, events, httptest.NewRequest("POST", "/upload", nil), func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		io.WriteString(w, "hello ")
+		io.WriteString(w, "world")
+	}, WithRoute(func(r *http.Request) string { return "/:action" }))
+
+	if f, _ := e.Field("bytes"); f.Value() != int64(11) {
+		t.Errorf("bytes = %v, want 11", f.Value())
+	}
+	if f, _ := e.Field("duration"); f.Value().(time.Duration) < 10*time.Millisecond {
+		t.Errorf("duration = %v, want at least 10ms", f.Value())
+	}
+	if f, _ := e.Field("route"); f.Value() != "/:action" || e.Message != "POST /:action" {
+		t.Errorf("route %v, message %q", f.Value(), e.Message)
+	}
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	events := make(chan EventSnapshot, 1)
+	c := New(WithObserver(snapshotObserver(events)))
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-Id", "req-1")
+	rec, e := serve(t, c, events, r, ok)
+	if got := rec.Header().Get("X-Request-Id"); got != "req-1" {
+		t.Errorf("echoed request ID %q, want req-1", got)
+	}
+	if f, _ := e.Field("request_id"); f.Value() != "req-1" {
+		t.Errorf("request_id = %v, want req-1", f.Value())
+	}
+
+	// Requests without an ID use the ID of their event.
+	rec, e = serve(t, c, events, httptest.NewRequest("GET", "/", nil), ok)
+	if got := rec.Header().Get("X-Request-Id"); got == "" || got != e.ID {
+		t.Errorf("echoed request ID %q, want the event ID %q", got, e.ID)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Correlation-Id", "corr-1")
+	rec, e = serve(t, c, events, r, ok, WithRequestIDHeader("X-Correlation-Id"))
+	if got := rec.Header().Get("X-Correlation-Id"); got != "corr-1" || rec.Header().Get("X-Request-Id") != "" {
+		t.Errorf("echoed headers %v, want X-Correlation-Id only", rec.Header())
+	}
+	if f, _ := e.Field("request_id"); f.Value() != "corr-1" {
+		t.Errorf("request_id = %v, want corr-1", f.Value())
+	}
+}
+
+func TestMiddlewareVerbosityHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []MiddlewareOption
+		header string
+		want   string
+	}{
+		{"lowered", []MiddlewareOption{WithVerbosityHeader("X-Verbosity")}, "debug", "[detail GET /]"},
+		{"invalid level", []MiddlewareOption{WithVerbosityHeader("X-Verbosity")}, "chatty", "[GET /]"},
+		{"no header", []MiddlewareOption{WithVerbosityHeader("X-Verbosity")}, "", "[GET /]"},
+		{"disabled", nil, "debug", "[GET /]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var messages []string
+			c := New(WithLevel(LevelInfo), WithObserver(WildcardObserver(func(e *Event) {
+				messages = append(messages, e.Snapshot().Message)
+			})))
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Verbosity", tt.header)
+			}
+			Middleware(c, tt.opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				EventFromContext(r.Context()).Debug("detail").Emit()
+			})).ServeHTTP(httptest.NewRecorder(), r)
+			// Events outside the request keep the client level.
+			c.Debug("outside").Emit()
+
+			if got := fmt.Sprint(messages); got != tt.want {
+				t.Errorf("emitted %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	events := make(chan EventSnapshot, 1)
+	c := New(WithObserver(snapshotObserver(events)))
+	h := Middleware(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(errors.New("nil map"))
+	}))
+	func() {
+		defer func() {
+			if p := recover(); p == nil {
+				t.Error("the panic of the handler was swallowed")
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+	e := receive(t, events)
+	f, _ := e.Field("status")
+	errField, _ := e.Field("error")
+	if f.Value() != int64(500) || e.Level != LevelError || errField.Kind != KindError {
+		t.Errorf("panicking request: status %v, level %v, error %v", f.Value(), e.Level, errField.Value())
+	}
+}
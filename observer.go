@@ -1,12 +1,68 @@
 package skylight
 
 type ObserverHandler func(*Event)
+
+// ObserverCondition reports whether an observer takes an event. Conditions run before the caller and stack of the
+// event are captured, which only happens once an observer takes it: Event.Caller and Event.Stack report nothing yet.
 type ObserverCondition func(*Event) bool
 
 type Observer struct {
-	id      string
-	cond    ObserverCondition
-	handler ObserverHandler
+	id         string
+	cond       ObserverCondition
+	handler    ObserverHandler
+	flush      func()
+	close      func()
+	evict      ObserverHandler
+	extraStats func(*ObserverStats)
+	// enabled reports whether the observer may accept events with a level and topic, for Client.Enabled.
+	// A nil func means it may accept any event.
+	enabled func(level Level, topic string) bool
+	stats   observerStats
+}
+
+// WithID names the observer in the client statistics. IDs should be unique within a client: the statistics suffix
+// duplicates, see ObserverStats.ID.
+func (o *Observer) WithID(id string) *Observer {
+	if o == nil {
+		return nil
+	}
+	o.id = id
+	return o
+}
+
+// ID returns the name of the observer.
+func (o *Observer) ID() string {
+	if o == nil {
+		return ""
+	}
+	return o.id
+}
+
+// WithFlush sets the function called when the client is flushed, e.g. before a fatal event exits the process.
+func (o *Observer) WithFlush(fn func()) *Observer {
+	if o == nil {
+		return nil
+	}
+	o.flush = fn
+	return o
+}
+
+// WithClose sets the function called when the client is closed.
+func (o *Observer) WithClose(fn func()) *Observer {
+	if o == nil {
+		return nil
+	}
+	o.close = fn
+	return o
+}
+
+// WithEvict sets the function called when a held event matching the observer is evicted, e.g. to end a span.
+func (o *Observer) WithEvict(fn ObserverHandler) *Observer {
+	if o == nil {
+		return nil
+	}
+	o.evict = fn
+	return o
 }
 
 func WildcardObserver(handler ObserverHandler) *Observer {
@@ -20,6 +76,7 @@ func TopicObserver(topic string, handler ObserverHandler) *Observer {
 	return &Observer{
 		cond:    func(e *Event) bool { return e.topic == topic },
 		handler: handler,
+		enabled: func(l Level, t string) bool { return t == topic },
 	}
 }
 
@@ -27,5 +84,6 @@ func LevelObserver(level Level, handler ObserverHandler) *Observer {
 	return &Observer{
 		cond:    func(e *Event) bool { return e.level <= level },
 		handler: handler,
+		enabled: func(l Level, t string) bool { return l <= level },
 	}
 }
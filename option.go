@@ -14,6 +14,66 @@ func WithObserver(o ...*Observer) Option {
 	}
 }
 
+func WithFlightRecorder(r *FlightRecorder) Option {
+	return func(c *Client) {
+		c.WithFlightRecorder(r)
+	}
+}
+
+func WithIDGenerator(gen IDGenerator) Option {
+	return func(c *Client) {
+		c.WithIDGenerator(gen)
+	}
+}
+
+func WithCaller(level Level) Option {
+	return func(c *Client) {
+		c.WithCaller(level)
+	}
+}
+
+func WithStack(level Level) Option {
+	return func(c *Client) {
+		c.WithStack(level)
+	}
+}
+
+func WithCallerSkip(n int) Option {
+	return func(c *Client) {
+		c.WithCallerSkip(n)
+	}
+}
+
+func WithDebugEvents(enabled bool) Option {
+	return func(c *Client) {
+		c.WithDebugEvents(enabled)
+	}
+}
+
+func WithExitFunc(fn func(code int)) Option {
+	return func(c *Client) {
+		c.WithExitFunc(fn)
+	}
+}
+
+func WithPanicFunc(fn func(err error)) Option {
+	return func(c *Client) {
+		c.WithPanicFunc(fn)
+	}
+}
+
+func WithResource(r *Resource) Option {
+	return func(c *Client) {
+		c.WithResource(r)
+	}
+}
+
+func WithEnricher(fn ...Enricher) Option {
+	return func(c *Client) {
+		c.WithEnricher(fn...)
+	}
+}
+
 func WithStandardLogger() Option {
 	return func(c *Client) {
 		c.WithStandardLogger()
@@ -0,0 +1,258 @@
+package skylight
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Carrier holds propagation metadata crossing a process boundary, such as HTTP headers or message metadata.
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// HeaderCarrier adapts HTTP headers to a Carrier.
+type HeaderCarrier http.Header
+
+func (c HeaderCarrier) Get(key string) string { return http.Header(c).Get(key) }
+
+func (c HeaderCarrier) Set(key, value string) { http.Header(c).Set(key, value) }
+
+// MapCarrier adapts string maps, e.g. message metadata, to a Carrier. Keys are matched case-insensitively.
+type MapCarrier map[string]string
+
+func (c MapCarrier) Get(key string) string {
+	if v, ok := c[key]; ok {
+		return v
+	}
+	for k, v := range c {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func (c MapCarrier) Set(key, value string) { c[key] = value }
+
+// RemoteParent is an event of another process, extracted from a carrier.
+type RemoteParent struct {
+	// TraceID is the W3C trace ID of the event tree, as 32 hex digits.
+	TraceID string
+	// ParentID is the ID of the remote event, or its W3C parent ID when it was propagated with traceparent.
+	ParentID string
+	// TraceState is the W3C tracestate, passed along unchanged.
+	TraceState string
+}
+
+// Propagator carries the identity of an event across process boundaries, so that the event trees of several
+// services join up.
+type Propagator interface {
+	// Inject writes the trace and ID of e to c.
+	Inject(e *Event, c Carrier)
+	// Extract reads the remote parent written to c by Inject, and reports whether there was a valid one.
+	Extract(c Carrier) (RemoteParent, bool)
+}
+
+// DefaultPropagator propagates events both with the skylight header, which keeps exact event IDs,
+// and with W3C trace context for other services.
+func DefaultPropagator() Propagator {
+	return Propagators(HeaderPropagator("Skylight-Parent"), W3CPropagator())
+}
+
+// Propagators combines propagators. Inject uses all of them, Extract returns the first remote parent found.
+func Propagators(p ...Propagator) Propagator {
+	return propagators(p)
+}
+
+type propagators []Propagator
+
+func (ps propagators) Inject(e *Event, c Carrier) {
+	for _, p := range ps {
+		p.Inject(e, c)
+	}
+}
+
+func (ps propagators) Extract(c Carrier) (RemoteParent, bool) {
+	for _, p := range ps {
+		if rp, ok := p.Extract(c); ok {
+			return rp, true
+		}
+	}
+	return RemoteParent{}, false
+}
+
+// W3CPropagator propagates events with the W3C traceparent and tracestate headers. The parent ID of traceparent is the
+// span ID of the event, see Event.SpanID: remote children only refer to the exact event ID when it is a W3C parent ID,
+// e.g. with W3CSpanIDGenerator.
+func W3CPropagator() Propagator {
+	return w3cPropagator{}
+}
+
+type w3cPropagator struct{}
+
+func (w3cPropagator) Inject(e *Event, c Carrier) {
+	if !e.live() {
+		return
+	}
+	c.Set("traceparent", "00-"+e.TraceID()+"-"+e.SpanID()+"-01")
+	if e.traceState != "" {
+		c.Set("tracestate", e.traceState)
+	}
+}
+
+func (w3cPropagator) Extract(c Carrier) (RemoteParent, bool) {
+	// version "-" trace-id "-" parent-id "-" trace-flags, where later versions may append fields.
+	tp := strings.TrimSpace(c.Get("traceparent"))
+	if len(tp) < 55 || (len(tp) > 55 && tp[55] != '-') {
+		return RemoteParent{}, false
+	}
+	version, traceID, parentID, flags := tp[0:2], tp[3:35], tp[36:52], tp[53:55]
+	if tp[2] != '-' || tp[35] != '-' || tp[52] != '-' ||
+		!isHexID(version, false) || version == "ff" || (version == "00" && len(tp) != 55) ||
+		!isHexID(traceID, true) || !isHexID(parentID, true) || !isHexID(flags, false) {
+		return RemoteParent{}, false
+	}
+	return RemoteParent{
+		TraceID:    traceID,
+		ParentID:   parentID,
+		TraceState: strings.TrimSpace(c.Get("tracestate")),
+	}, true
+}
+
+// HeaderPropagator propagates events with a single header holding the trace ID and the exact event ID, separated by a
+// dash, so that remote children refer to the event ID whatever the ID generator. Extract only accepts event IDs of up
+// to maxRemoteIDLen visible ASCII characters other than commas, which covers the IDs of every generator of the package.
+func HeaderPropagator(header string) Propagator {
+	return headerPropagator(header)
+}
+
+type headerPropagator string
+
+func (h headerPropagator) Inject(e *Event, c Carrier) {
+	if !e.live() {
+		return
+	}
+	c.Set(string(h), e.TraceID()+"-"+e.ID())
+}
+
+func (h headerPropagator) Extract(c Carrier) (RemoteParent, bool) {
+	v := strings.TrimSpace(c.Get(string(h)))
+	if len(v) < 34 || v[32] != '-' || !isHexID(v[:32], true) || !isRemoteID(v[33:]) {
+		return RemoteParent{}, false
+	}
+	return RemoteParent{TraceID: v[:32], ParentID: v[33:]}, true
+}
+
+// maxRemoteIDLen bounds the event IDs HeaderPropagator extracts, so that a header can't make every child carry an
+// arbitrarily large parent ID.
+const maxRemoteIDLen = 128
+
+// isRemoteID reports whether s is a valid event ID for HeaderPropagator.
+func isRemoteID(s string) bool {
+	if len(s) > maxRemoteIDLen {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c >= 0x7f || c == ',' {
+			return false
+		}
+	}
+	return true
+}
+
+// isHexID reports whether s is made of lowercase hex digits, and not all zero if nonZero is set.
+func isHexID(s string, nonZero bool) bool {
+	zero := true
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '0':
+		case c >= '1' && c <= '9', c >= 'a' && c <= 'f':
+			zero = false
+		default:
+			return false
+		}
+	}
+	return !nonZero || !zero
+}
+
+// DeriveTraceID returns the W3C trace ID of the event tree rooted at the event with the given ID, as 32 hex digits.
+// IDs that already are W3C trace IDs, e.g. from W3CTraceIDGenerator, are used as is. Other IDs are hashed.
+func DeriveTraceID(eventID string) string {
+	if len(eventID) == 32 && isHexID(eventID, true) {
+		return eventID
+	}
+	sum := sha256.Sum256([]byte(eventID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// DeriveSpanID returns the W3C parent ID of the event with the given ID, as 16 hex digits.
+// IDs that already are W3C parent IDs, e.g. from W3CSpanIDGenerator, are used as is. Other IDs are hashed.
+func DeriveSpanID(eventID string) string {
+	if len(eventID) == 16 && isHexID(eventID, true) {
+		return eventID
+	}
+	sum := sha256.Sum256([]byte(eventID))
+	return hex.EncodeToString(sum[16:24])
+}
+
+// TraceID returns the W3C trace ID of the event tree. It is inherited from the parent event, or from the remote parent
+// of the process, or given with the parent ID; for other events it is derived from the parent ID, or from the event ID
+// for roots, see DeriveTraceID and Event.ParentID.
+func (e *Event) TraceID() string {
+	if !e.live() {
+		return ""
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.traceIDLocked()
+}
+
+func (e *Event) traceIDLocked() string {
+	if e.traceID == "" {
+		if e.parentID != "" {
+			e.traceID = DeriveTraceID(e.parentID)
+		} else {
+			e.traceID = DeriveTraceID(e.idLocked())
+		}
+	}
+	return e.traceID
+}
+
+// SpanID returns the W3C parent ID of the event, derived from its ID, see DeriveSpanID.
+func (e *Event) SpanID() string {
+	if !e.live() {
+		return ""
+	}
+	return DeriveSpanID(e.ID())
+}
+
+// RemoteParent makes the event a child of an event of another process, extracted by a Propagator.
+func (e *Event) RemoteParent(p RemoteParent) *Event {
+	if !e.live() {
+		return e
+	}
+	e.parentID = p.ParentID
+	e.traceID = p.TraceID
+	e.traceState = p.TraceState
+	return e
+}
+
+// WithRemoteParent returns an emitter making every event it creates a child of an event of another process.
+func (c *Client) WithRemoteParent(p RemoteParent) *Emitter {
+	return c.emitter().WithRemoteParent(p)
+}
+
+// WithRemoteParent returns a copy of the emitter bound to a remote parent.
+func (em *Emitter) WithRemoteParent(p RemoteParent) *Emitter {
+	if em == nil {
+		return nil
+	}
+	d := *em
+	d.parentID = p.ParentID
+	d.traceID = p.TraceID
+	d.traceState = p.TraceState
+	return &d
+}
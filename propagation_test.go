@@ -0,0 +1,195 @@
+package skylight
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGrandchildLinkedByIDStaysInTrace(t *testing.T) {
+	c := New()
+	root := c.Info("root").Emit(true)
+	child := root.Info("child").Emit(true)
+
+	grandchild := c.Info("grandchild").ParentID(child.ID(), child.TraceID())
+	if got, want := grandchild.TraceID(), root.TraceID(); got != want {
+		t.Errorf("grandchild trace = %s, want the root trace %s", got, want)
+	}
+	viaEmitter := c.WithParent(child.ID(), child.TraceID()).Info("grandchild")
+	if got, want := viaEmitter.TraceID(), root.TraceID(); got != want {
+		t.Errorf("emitter grandchild trace = %s, want the root trace %s", got, want)
+	}
+
+	// Without the trace, the trace is derived from the parent ID, which only matches for children of the root.
+	if got, want := c.Info("child").ParentID(root.ID()).TraceID(), root.TraceID(); got != want {
+		t.Errorf("child trace = %s, want the root trace %s", got, want)
+	}
+	if got := c.Info("grandchild").ParentID(child.ID()).TraceID(); got != DeriveTraceID(child.ID()) {
+		t.Errorf("grandchild trace = %s, want the one derived from its parent", got)
+	}
+	child.Evict()
+	root.Evict()
+}
+
+func TestW3CExtract(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		name, traceparent string
+		ok                bool
+	}{
+		{"valid", "00-" + traceID + "-" + spanID + "-01", true},
+		{"surrounding spaces", " 00-" + traceID + "-" + spanID + "-00 ", true},
+		{"future version", "01-" + traceID + "-" + spanID + "-01", true},
+		{"future version with more fields", "cc-" + traceID + "-" + spanID + "-01-what-the-future-holds", true},
+		{"future version glued to more fields", "cc-" + traceID + "-" + spanID + "-01what", false},
+		{"version 00 with more fields", "00-" + traceID + "-" + spanID + "-01-extra", false},
+		{"version ff", "ff-" + traceID + "-" + spanID + "-01", false},
+		{"too short", "00-" + traceID + "-" + spanID[1:] + "-01", false},
+		{"too long", "00-" + traceID + "0-" + spanID + "-01", false},
+		{"empty", "", false},
+		{"uppercase trace ID", "00-" + strings.ToUpper(traceID) + "-" + spanID + "-01", false},
+		{"uppercase span ID", "00-" + traceID + "-" + strings.ToUpper(spanID) + "-01", false},
+		{"uppercase version", "0A-" + traceID + "-" + spanID + "-01", false},
+		{"zero trace ID", "00-" + strings.Repeat("0", 32) + "-" + spanID + "-01", false},
+		{"zero span ID", "00-" + traceID + "-" + strings.Repeat("0", 16) + "-01", false},
+		{"bad separator", "00_" + traceID + "-" + spanID + "-01", false},
+		{"bad flags", "00-" + traceID + "-" + spanID + "-0g", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp, ok := W3CPropagator().Extract(MapCarrier{"traceparent": tt.traceparent})
+			if ok != tt.ok {
+				t.Fatalf("Extract(%q) ok = %v, want %v", tt.traceparent, ok, tt.ok)
+			}
+			if ok && (rp.TraceID != traceID || rp.ParentID != spanID) {
+				t.Errorf("Extract(%q) = %+v", tt.traceparent, rp)
+			}
+		})
+	}
+}
+
+func TestW3CInjectExtract(t *testing.T) {
+	c := New()
+	root := c.Info("root").Emit(true)
+	defer root.Evict()
+
+	h := http.Header{}
+	W3CPropagator().Inject(root, HeaderCarrier(h))
+	if want := "00-" + root.TraceID() + "-" + root.SpanID() + "-01"; h.Get("Traceparent") != want {
+		t.Errorf("traceparent = %q, want %q", h.Get("Traceparent"), want)
+	}
+	if _, ok := h["Tracestate"]; ok {
+		t.Errorf("tracestate %q injected without one", h.Get("Tracestate"))
+	}
+
+	// The tracestate of a remote parent is passed along unchanged.
+	h.Set("Tracestate", " vendor=opaque,other=1 ")
+	rp, ok := W3CPropagator().Extract(HeaderCarrier(h))
+	if !ok || rp.TraceState != "vendor=opaque,other=1" {
+		t.Fatalf("extracted %+v, %v, want the tracestate", rp, ok)
+	}
+	child := c.Info("remote child").RemoteParent(rp)
+	out := http.Header{}
+	W3CPropagator().Inject(child, HeaderCarrier(out))
+	if out.Get("Tracestate") != rp.TraceState || child.TraceID() != root.TraceID() || child.parentID != root.SpanID() {
+		t.Errorf("remote child injected %v, with trace %s and parent %s", out, child.TraceID(), child.parentID)
+	}
+	child.Emit()
+
+	// A stale event injects nothing. Debug builds panic instead.
+	if debugEvents {
+		return
+	}
+	stale := c.Info("stale")
+	stale.Emit()
+	out = http.Header{}
+	W3CPropagator().Inject(stale, HeaderCarrier(out))
+	if len(out) != 0 {
+		t.Errorf("stale event injected %v", out)
+	}
+}
+
+func TestHeaderPropagator(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	p := HeaderPropagator("Skylight-Parent")
+	tests := []struct {
+		name, header, parentID string
+		ok                     bool
+	}{
+		{"nanoid", traceID + "-V1StGXR8_Z5jdHi6", "V1StGXR8_Z5jdHi6", true},
+		{"ID with dashes", traceID + "-0190a3c2-7b1e-7d4f", "0190a3c2-7b1e-7d4f", true},
+		{"longest ID", traceID + "-" + strings.Repeat("a", maxRemoteIDLen), strings.Repeat("a", maxRemoteIDLen), true},
+		{"ID too long", traceID + "-" + strings.Repeat("a", maxRemoteIDLen+1), "", false},
+		{"empty ID", traceID + "-", "", false},
+		{"space in ID", traceID + "-a b", "", false},
+		{"control in ID", traceID + "-a\x00b", "", false},
+		{"non-ASCII ID", traceID + "-caf\u00e9", "", false},
+		{"list", traceID + "-a," + traceID + "-b", "", false},
+		{"uppercase trace ID", strings.ToUpper(traceID) + "-a", "", false},
+		{"zero trace ID", strings.Repeat("0", 32) + "-a", "", false},
+		{"no separator", traceID + "_a", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp, ok := p.Extract(MapCarrier{"Skylight-Parent": tt.header})
+			if ok != tt.ok {
+				t.Fatalf("Extract(%q) ok = %v, want %v", tt.header, ok, tt.ok)
+			}
+			if ok && (rp.TraceID != traceID || rp.ParentID != tt.parentID) {
+				t.Errorf("Extract(%q) = %+v, want parent %q", tt.header, rp, tt.parentID)
+			}
+		})
+	}
+
+	// The exact event ID crosses the boundary, whatever the generator.
+	c := New(WithIDGenerator(SequentialIDGenerator("evt-")))
+	root := c.Info("root").Emit(true)
+	defer root.Evict()
+	h := http.Header{}
+	p.Inject(root, HeaderCarrier(h))
+	rp, ok := p.Extract(HeaderCarrier(h))
+	if !ok || rp.ParentID != root.ID() || rp.TraceID != root.TraceID() {
+		t.Errorf("round trip of %s: %+v, %v", h.Get("Skylight-Parent"), rp, ok)
+	}
+
+	// The default propagator prefers the exact ID, and falls back to traceparent.
+	rp, ok = DefaultPropagator().Extract(HeaderCarrier(h))
+	if !ok || rp.ParentID != root.ID() {
+		t.Errorf("default propagator extracted %+v, %v, want the exact ID", rp, ok)
+	}
+	DefaultPropagator().Inject(root, HeaderCarrier(h))
+	h.Del("Skylight-Parent")
+	rp, ok = DefaultPropagator().Extract(HeaderCarrier(h))
+	if !ok || rp.ParentID != root.SpanID() {
+		t.Errorf("default propagator extracted %+v, %v, want the span ID", rp, ok)
+	}
+}
+
+func TestMapCarrier(t *testing.T) {
+	c := MapCarrier{"Traceparent": "upper", "tracestate": "lower"}
+	tests := []struct{ key, want string }{
+		{"Traceparent", "upper"},
+		{"traceparent", "upper"},
+		{"TRACESTATE", "lower"},
+		{"tracestate", "lower"},
+		{"missing", ""},
+	}
+	for _, tt := range tests {
+		if got := c.Get(tt.key); got != tt.want {
+			t.Errorf("Get(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+
+	// An exact match wins over a case-insensitive one.
+	c["traceparent"] = "exact"
+	if got := c.Get("traceparent"); got != "exact" {
+		t.Errorf("Get(traceparent) = %q, want the exact match", got)
+	}
+	c.Set("Skylight-Parent", "v")
+	if c["Skylight-Parent"] != "v" || c.Get("skylight-parent") != "v" {
+		t.Errorf("Set stored %v", c)
+	}
+}
@@ -0,0 +1,113 @@
+package skylight
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Recover is meant to be deferred. When the surrounding function panics, it emits an error event with the panic value
+// under the "panic" key, and the stack of the panic when the client captures stacks at the error level, which it does
+// by default. The event is a child of parent, or a root event of the default client when parent is nil.
+//
+// When the client has a flight recorder, a crash bundle is written too, see FlightRecorder.Recover.
+//
+// The panic is swallowed, unless repanic is true: the observers are then flushed, and the panic resumes with its
+// original value. The event has the error level rather than the panic level, since emitting a panic event panics
+// itself, see WithPanicFunc, which would replace the original panic.
+//
+//	defer skylight.Recover(e)
+func Recover(parent *Event, repanic ...bool) {
+	if v := recover(); v != nil {
+		defaultClient.recovered(parent, v, repanic)
+	}
+}
+
+// Recover is meant to be deferred, like the Recover function, and emits the event of a panic as a root event of c.
+//
+//	defer c.Recover()
+func (c *Client) Recover(repanic ...bool) {
+	if v := recover(); v != nil {
+		c.recovered(nil, v, repanic)
+	}
+}
+
+// recovered emits the event of the recovered panic v, as a child of parent or else a root event of c, and resumes the
+// panic when repanic is true, whether the event was emitted or not.
+func (c *Client) recovered(parent *Event, v any, repanic []bool) {
+	if parent.canParent() {
+		c = parent.c
+	}
+	// Skip recovered and the deferred Recover function, see panicEvent.
+	panicEvent(c, parent, v).emit(2, false)
+	c.flightRecorder().dumpPanic(v)
+	if len(repanic) > 0 && repanic[0] {
+		c.Flush()
+		c.flightRecorder().resume(v)
+		panic(v)
+	}
+}
+
+// panicEvent creates the error event of a recovered panic, as a child of parent or else a root event of c. It must be
+// emitted from the deferred function calling recover, so that the captured stack starts where the panic happened.
+func panicEvent(c *Client, parent *Event, v any) *Event {
+	var e *Event
+	if parent.canParent() {
+		e = newChildEvent(LevelError, parent)
+	} else {
+		e = newEvent(LevelError, c)
+	}
+	if e == nil {
+		return nil
+	}
+	e.printf("panic: %v", []any{v}).Any("panic", v)
+	if err, ok := v.(error); ok {
+		e.WithError(err)
+	}
+	return e
+}
+
+// Go runs fn in a new goroutine, under an event with the "goroutine" topic that records its lifetime. The event is a
+// child of the event carried by ctx, or a root event of the default client, and is carried by the context given to fn,
+// so that the events of fn become its children even after the parent event has been evicted.
+//
+// The event is emitted when fn returns, at the info level, or the error level when fn fails or panics. A panic of fn
+// is recovered and emitted as a child event, with a crash bundle when the client has a flight recorder, see Recover,
+// so that background work can't crash the program.
+func Go(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	defaultClient.Go(ctx, name, fn)
+}
+
+// Go runs fn in a new goroutine like the Go function, with a root event of c when ctx doesn't carry an event.
+func (c *Client) Go(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	e := begin(ctx, c)
+	e.Topic("goroutine").Message(name).Str("name", name)
+	start := time.Now()
+
+	go func() {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			panicEvent(c, e, v).emit(1, false)
+			if e.canParent() {
+				e.c.flightRecorder().dumpPanic(v)
+			} else {
+				c.flightRecorder().dumpPanic(v)
+			}
+			e.Dur("duration", time.Since(start)).
+				Err("error", fmt.Errorf("panic: %v", v)).
+				end(LevelError)
+		}()
+
+		err := fn(ContextWithEvent(ctx, e))
+		level := LevelInfo
+		if err != nil {
+			level = LevelError
+		}
+		e.Dur("duration", time.Since(start)).
+			Err("error", err).
+			end(level)
+	}()
+}
@@ -0,0 +1,117 @@
+package skylight_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/benchatech/skylight"
+)
+
+func panicking() {
+	panic("boom")
+}
+
+// repanicked runs fn and returns the value it panicked with.
+func repanicked(fn func()) (v any) {
+	defer func() { v = recover() }()
+	fn()
+	return nil
+}
+
+func TestRecoverRepanicsWithTheOriginalValue(t *testing.T) {
+	var (
+		events  []skylight.EventSnapshot
+		flushed bool
+	)
+	o := skylight.WildcardObserver(func(e *skylight.Event) { events = append(events, e.Snapshot()) }).
+		WithFlush(func() { flushed = true })
+	c := skylight.New(skylight.WithObserver(o))
+
+	v := repanicked(func() {
+		defer c.Recover(true)
+		panicking()
+	})
+	if v != "boom" {
+		t.Errorf("repanicked with %#v, want the original value", v)
+	}
+	if !flushed {
+		t.Error("observers not flushed before repanicking")
+	}
+	if len(events) != 1 || events[0].Level != skylight.LevelError {
+		t.Fatalf("events = %v, want one error event", events)
+	}
+	if f, _ := events[0].Field("panic"); f.Value() != "boom" {
+		t.Errorf("panic = %v", f.Value())
+	}
+	if stack := events[0].Stack; len(stack) == 0 || !strings.HasSuffix(stack[0].Function, ".panicking") {
+		t.Errorf("stack = %v, want one starting where the panic happened", stack)
+	}
+
+	// The panic resumes even when no event is emitted.
+	quiet := skylight.New(skylight.WithLevel(skylight.LevelFatal))
+	if v := repanicked(func() {
+		defer quiet.Recover(true)
+		panicking()
+	}); v != "boom" {
+		t.Errorf("filtered: repanicked with %#v, want the original value", v)
+	}
+}
+
+func TestRecoverChildOfParent(t *testing.T) {
+	var events []skylight.EventSnapshot
+	c := skylight.New(skylight.WithObserver(skylight.WildcardObserver(func(e *skylight.Event) { events = append(events, e.Snapshot()) })))
+	parent := c.Info("request").Emit(true)
+	defer parent.Evict()
+
+	if v := repanicked(func() {
+		defer skylight.Recover(parent)
+		panicking()
+	}); v != nil {
+		t.Errorf("panic not swallowed: %v", v)
+	}
+	if len(events) != 2 || events[1].ParentID != parent.ID() {
+		t.Errorf("events = %v, want the panic as a child of the request", events)
+	}
+}
+
+func TestClientGo(t *testing.T) {
+	events := make(chan skylight.EventSnapshot, 4)
+	c := skylight.New(skylight.WithObserver(skylight.WildcardObserver(func(e *skylight.Event) { events <- e.Snapshot() })))
+
+	c.Go(context.Background(), "job", func(ctx context.Context) error {
+		skylight.EventFromContext(ctx).Info("step").Emit()
+		return errors.New("failed")
+	})
+	step, job := <-events, <-events
+	if job.Topic != "goroutine" || job.Level != skylight.LevelError || step.ParentID != job.ID {
+		t.Errorf("job %s at %v, step under %q, want a goroutine error event parenting the step %q", job.Topic, job.Level, step.ParentID, job.ID)
+	}
+
+	c.Go(context.Background(), "crash", func(ctx context.Context) error { panicking(); return nil })
+	crash, job := <-events, <-events
+	if crash.ParentID != job.ID || job.Level != skylight.LevelError {
+		t.Errorf("panic under %q, job at %v, want the panic under the failed job %q", crash.ParentID, job.Level, job.ID)
+	}
+}
+
+func TestClientGoRecoversRepanics(t *testing.T) {
+	events := make(chan skylight.EventSnapshot, 4)
+	c := skylight.New(skylight.WithObserver(skylight.WildcardObserver(func(e *skylight.Event) { events <- e.Snapshot() })))
+
+	c.Go(context.Background(), "job", func(ctx context.Context) error {
+		defer skylight.Recover(skylight.EventFromContext(ctx), true)
+		panicking()
+		return nil
+	})
+	recovered, resumed, job := <-events, <-events, <-events
+	for _, e := range []skylight.EventSnapshot{recovered, resumed} {
+		if f, _ := e.Field("panic"); f.Value() != "boom" || e.ParentID != job.ID || e.Level != skylight.LevelError {
+			t.Errorf("panic %v under %q at %v, want the original value under the job %q", f.Value(), e.ParentID, e.Level, job.ID)
+		}
+	}
+	if f, _ := job.Field("error"); job.Level != skylight.LevelError || f.String() != "error=panic: boom" {
+		t.Errorf("job at %v with error %v, want the resumed panic", job.Level, f)
+	}
+}
@@ -0,0 +1,166 @@
+package skylight
+
+import (
+	"os"
+	"path"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// Resource describes the process emitting events: service, host, build and deployment metadata.
+// Its fields are the same for every event of a client, so sinks can send them once per batch instead of once per event.
+// A resource must not be modified once attached to a client.
+type Resource struct {
+	fields []Field
+}
+
+// NewResource creates an empty resource.
+func NewResource() *Resource {
+	return &Resource{}
+}
+
+// DetectResource creates a resource describing the current process: service name and version, VCS revision,
+// host name, pid, Go version, and Kubernetes metadata exposed as environment variables.
+// Keys follow the OpenTelemetry semantic conventions.
+func DetectResource() *Resource {
+	r := NewResource()
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Path != "" {
+			r.With("service.name", serviceName(info.Main.Path))
+		}
+		if v := info.Main.Version; v != "" && v != "(devel)" {
+			r.With("service.version", v)
+		}
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision", "vcs.time":
+				r.With(s.Key, s.Value)
+			case "vcs.modified":
+				r.With(s.Key, s.Value == "true")
+			}
+		}
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		r.With("service.name", name)
+	}
+
+	if host, err := os.Hostname(); err == nil {
+		r.With("host.name", host)
+	}
+	r.With("process.pid", os.Getpid())
+	r.With("process.runtime.version", runtime.Version())
+
+	// Kubernetes only sets KUBERNETES_SERVICE_HOST; the rest is commonly injected with the downward API.
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		for _, k := range kubernetesEnv {
+			for _, env := range k.envs {
+				if v := os.Getenv(env); v != "" {
+					r.With(k.key, v)
+					break
+				}
+			}
+		}
+	}
+
+	return r
+}
+
+// serviceName returns the last element of a module path, skipping its major version suffix, e.g. "api" for "example.com/api/v2".
+func serviceName(modulePath string) string {
+	dir, last := path.Split(modulePath)
+	if dir != "" && len(last) > 1 && last[0] == 'v' && strings.Trim(last[1:], "0123456789") == "" {
+		return path.Base(dir)
+	}
+	return last
+}
+
+// kubernetesEnv maps resource keys to the environment variables they are read from, in order of preference.
+var kubernetesEnv = []struct {
+	key  string
+	envs []string
+}{
+	{"k8s.namespace.name", []string{"K8S_NAMESPACE", "K8S_POD_NAMESPACE", "POD_NAMESPACE"}},
+	{"k8s.pod.name", []string{"K8S_POD_NAME", "POD_NAME"}},
+	{"k8s.pod.uid", []string{"K8S_POD_UID", "POD_UID"}},
+	{"k8s.node.name", []string{"K8S_NODE_NAME", "NODE_NAME"}},
+	{"k8s.container.name", []string{"K8S_CONTAINER_NAME", "CONTAINER_NAME"}},
+}
+
+// With sets a field of the resource, replacing any field with the same key.
+func (r *Resource) With(key string, v any) *Resource {
+	if r == nil {
+		return nil
+	}
+	r.fields = setField(r.fields, anyField(key, v))
+	return r
+}
+
+// WithService sets the service name and version of the resource.
+func (r *Resource) WithService(name, version string) *Resource {
+	if r == nil {
+		return nil
+	}
+	r.With("service.name", name)
+	if version != "" {
+		r.With("service.version", version)
+	}
+	return r
+}
+
+// Fields returns the fields of the resource. The slice must not be modified.
+func (r *Resource) Fields() []Field {
+	if r == nil {
+		return nil
+	}
+	return r.fields
+}
+
+// Field returns the resource field with the given key.
+func (r *Resource) Field(key string) (Field, bool) {
+	for _, f := range r.Fields() {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// VisitFields passes every field of the resource to v, in the order they were added.
+func (r *Resource) VisitFields(v FieldVisitor) {
+	for _, f := range r.Fields() {
+		f.Visit(v)
+	}
+}
+
+// Enricher adds fields to an event when it is emitted, before any observer sees it.
+type Enricher func(e *Event)
+
+// Enricher returns an enricher copying the resource fields into every event, for observers that don't handle resources.
+// Fields already set on the event are kept.
+func (r *Resource) Enricher() Enricher {
+	return func(e *Event) {
+		for _, f := range r.Fields() {
+			if !slices.ContainsFunc(e.fields, func(ef Field) bool { return ef.Key == f.Key }) {
+				e.fields = append(e.fields, f)
+			}
+		}
+	}
+}
+
+// Resource returns the resource of the client the event was created from.
+func (e *Event) Resource() *Resource {
+	if !e.live() {
+		return nil
+	}
+	return e.c.resource
+}
+
+// enrich runs the client enrichers on e.
+func (e *Event) enrich() {
+	for _, fn := range e.c.enrichers {
+		fn(e)
+	}
+}
@@ -0,0 +1,86 @@
+package skylight
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestServiceName(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"example.com/api", "api"},
+		{"example.com/api/v2", "api"},
+		{"example.com/api/v10", "api"},
+		{"example.com/api/v", "v"},
+		{"example.com/api/v2beta", "v2beta"},
+		{"example.com/version", "version"},
+		{"api", "api"},
+		{"v2", "v2"},
+	}
+	for _, tt := range tests {
+		if got := serviceName(tt.path); got != tt.want {
+			t.Errorf("serviceName(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDetectResource(t *testing.T) {
+	t.Setenv("OTEL_SERVICE_NAME", "checkout")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	t.Setenv("K8S_NAMESPACE", "")
+	t.Setenv("K8S_POD_NAMESPACE", "prod")
+	t.Setenv("POD_NAMESPACE", "other")
+	t.Setenv("POD_NAME", "checkout-7d9f")
+
+	host, _ := os.Hostname()
+	want := map[string]string{
+		"service.name":            "checkout",
+		"host.name":               host,
+		"process.pid":             fmt.Sprint(os.Getpid()),
+		"process.runtime.version": runtime.Version(),
+		"k8s.namespace.name":      "prod",
+		"k8s.pod.name":            "checkout-7d9f",
+	}
+	r := DetectResource()
+	for k, v := range want {
+		if f, ok := r.Field(k); !ok || fmt.Sprint(f.Value()) != v {
+			t.Errorf("%s = %v, want %q", k, f.Value(), v)
+		}
+	}
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	if _, ok := DetectResource().Field("k8s.pod.name"); ok {
+		t.Error("Kubernetes metadata detected outside of Kubernetes")
+	}
+}
+
+func TestResourceEnricher(t *testing.T) {
+	var events []EventSnapshot
+	r := NewResource().WithService("checkout", "1.2.0").With("deployment.environment", "prod")
+	c := New(WithResource(r), WithEnricher(r.Enricher()),
+		WithObserver(WildcardObserver(func(e *Event) { events = append(events, e.Snapshot()) })))
+
+	c.Info("request").Str("service.name", "override").Emit()
+	if len(events) != 1 {
+		t.Fatalf("emitted %d events", len(events))
+	}
+	got := fieldValues(events[0])
+	want := map[string]string{"service.name": "override", "service.version": "1.2.0", "deployment.environment": "prod"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("fields = %v, want %v", got, want)
+	}
+	if events[0].Resource != r {
+		t.Error("snapshot doesn't share the client resource")
+	}
+
+	// A nil resource adds nothing.
+	events = nil
+	c = New(WithEnricher((*Resource)(nil).Enricher()), WithObserver(WildcardObserver(func(e *Event) { events = append(events, e.Snapshot()) })))
+	c.Info("request").Emit()
+	if len(events) != 1 || len(events[0].Fields) != 0 {
+		t.Errorf("events = %v, want one without fields", events)
+	}
+}
@@ -0,0 +1,190 @@
+package skylight
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// permanentError marks an error that retrying won't fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as permanent, so that a RetrySink neither retries nor spools the batch that caused it.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// RetrySink wraps a sink, retrying failed batches with jittered exponential backoff.
+// With a spool, batches that still fail are written to disk and replayed in order once the sink recovers: before the
+// next batch, or on the next tick of the Batcher when no events are emitted.
+type RetrySink struct {
+	sink       Sink
+	attempts   int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	spool      *Spool
+
+	mu sync.Mutex
+}
+
+// NewRetrySink wraps sink. By default a batch is tried up to 5 times, waiting between 100ms and 10s between attempts.
+func NewRetrySink(sink Sink) *RetrySink {
+	return &RetrySink{
+		sink:       sink,
+		attempts:   5,
+		minBackoff: 100 * time.Millisecond,
+		maxBackoff: 10 * time.Second,
+	}
+}
+
+// WithAttempts sets the number of times a batch is tried before it is spooled or reported as failed.
+func (r *RetrySink) WithAttempts(n int) *RetrySink {
+	if r == nil {
+		return nil
+	}
+	r.attempts = max(n, 1)
+	return r
+}
+
+// WithBackoff sets the wait before the first retry and the maximum wait between retries.
+func (r *RetrySink) WithBackoff(initial, limit time.Duration) *RetrySink {
+	if r == nil {
+		return nil
+	}
+	r.minBackoff, r.maxBackoff = initial, limit
+	return r
+}
+
+// WithSpool spools batches that can't be written, and replays them before any new batch.
+func (r *RetrySink) WithSpool(s *Spool) *RetrySink {
+	if r == nil {
+		return nil
+	}
+	r.spool = s
+	return r
+}
+
+func (r *RetrySink) Write(ctx context.Context, events []EventSnapshot) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.spool == nil {
+		return r.write(ctx, events)
+	}
+
+	// New batches queue behind the spooled ones, so that events are delivered in order.
+	if err := r.replay(ctx); err != nil {
+		return r.spool.Append(events)
+	}
+	err := r.write(ctx, events)
+	if err != nil && !IsPermanent(err) {
+		return r.spool.Append(events)
+	}
+	return err
+}
+
+// Flush replays the spool, then flushes the wrapped sink.
+func (r *RetrySink) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.replay(ctx); err != nil {
+		return err
+	}
+	return r.sink.Flush(ctx)
+}
+
+// Close tries to replay the spool once, then closes the wrapped sink. Batches still spooled are replayed by the next process.
+func (r *RetrySink) Close(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return errors.Join(r.replay(ctx), r.sink.Close(ctx))
+}
+
+// Unwrap returns the wrapped sink, so that the Batcher finds the stats of a BreakerSink behind the RetrySink.
+func (r *RetrySink) Unwrap() Sink {
+	return r.sink
+}
+
+// idle replays the spool when no batch is written. Failures are left for the next tick.
+func (r *RetrySink) idle(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.replay(ctx)
+}
+
+// replay writes the spooled batches, oldest first, stopping at the first failure.
+// Each batch is tried once, since replaying happens again on the next write. Batches the sink rejects as permanent
+// failures are discarded and counted as dropped by the spool.
+func (r *RetrySink) replay(ctx context.Context) error {
+	if r.spool == nil {
+		return nil
+	}
+	for {
+		events, seq, ok := r.spool.peek()
+		if !ok {
+			return nil
+		}
+		err := r.sink.Write(ctx, events)
+		if err != nil && !IsPermanent(err) {
+			return err
+		}
+		r.spool.remove(seq)
+		if err != nil {
+			r.spool.dropped.Add(uint64(len(events)))
+		}
+	}
+}
+
+func (r *RetrySink) write(ctx context.Context, events []EventSnapshot) error {
+	var err error
+	for attempt := 0; attempt < r.attempts; attempt++ {
+		if attempt > 0 {
+			t := time.NewTimer(r.backoff(attempt))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return errors.Join(err, ctx.Err())
+			case <-t.C:
+			}
+		}
+		if err = r.sink.Write(ctx, events); err == nil || IsPermanent(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// backoff returns the wait before the given attempt.
+func (r *RetrySink) backoff(attempt int) time.Duration {
+	return jitteredBackoff(attempt, r.minBackoff, r.maxBackoff)
+}
+
+// jitteredBackoff returns the wait before the given attempt: an exponentially growing delay with equal jitter, that is
+// a random wait between half the delay and the full delay.
+func jitteredBackoff(attempt int, initial, limit time.Duration) time.Duration {
+	d := initial << (attempt - 1)
+	if d <= 0 || d > limit {
+		d = limit
+	}
+	return d/2 + rand.N(d/2+1)
+}
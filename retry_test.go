@@ -0,0 +1,213 @@
+package skylight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// standIn is a local HTTP stand-in for a collector, answering with status while counting the events it accepts.
+type standIn struct {
+	mu       sync.Mutex
+	status   int
+	received int
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != http.StatusOK {
+		w.WriteHeader(s.status)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	events, err := decodeBatch(body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.received += len(events)
+}
+
+func (s *standIn) set(status int) {
+	s.mu.Lock()
+	s.status = status
+	s.mu.Unlock()
+}
+
+func (s *standIn) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.received
+}
+
+func newRetryClient(t *testing.T, status int) (*standIn, *Spool, *Client) {
+	t.Helper()
+	collector := &standIn{status: status}
+	srv := httptest.NewServer(collector)
+	t.Cleanup(srv.Close)
+
+	spool, err := OpenSpool(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := NewRetrySink(NewHTTPSink(srv.URL)).WithAttempts(2).WithBackoff(time.Millisecond, time.Millisecond).WithSpool(spool)
+	b := NewBatcher(sink).WithInterval(10 * time.Millisecond).WithErrorHandler(func(error) {})
+	c := New(WithObserver(b.Observer()))
+	t.Cleanup(c.Close)
+	return collector, spool, c
+}
+
+func TestRetrySinkReplaysWithoutTraffic(t *testing.T) {
+	collector, spool, c := newRetryClient(t, http.StatusServiceUnavailable)
+	for i := 0; i < 3; i++ {
+		c.Info("during outage").Emit()
+	}
+	c.Flush()
+	if spool.Len() == 0 {
+		t.Fatal("nothing spooled during the outage")
+	}
+
+	collector.set(http.StatusOK)
+	deadline := time.Now().Add(5 * time.Second)
+	for collector.count() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := collector.count(); got != 3 {
+		t.Errorf("collector received %d events, want 3", got)
+	}
+	if spool.Len() != 0 {
+		t.Errorf("%d batches still spooled", spool.Len())
+	}
+}
+
+func TestRetrySinkCountsPermanentReplayFailures(t *testing.T) {
+	collector, spool, c := newRetryClient(t, http.StatusServiceUnavailable)
+	c.Info("during outage").Emit()
+	c.Flush()
+
+	collector.set(http.StatusBadRequest)
+	c.Flush()
+	if spool.Len() != 0 || spool.Dropped() != 1 {
+		t.Errorf("spooled %d batches, dropped %d events, want 0 and 1", spool.Len(), spool.Dropped())
+	}
+}
+
+func TestJitteredBackoff(t *testing.T) {
+	for attempt := 1; attempt < 10; attempt++ {
+		want := min(10*time.Millisecond<<(attempt-1), time.Second)
+		for i := 0; i < 100; i++ {
+			if d := jitteredBackoff(attempt, 10*time.Millisecond, time.Second); d < want/2 || d > want {
+				t.Fatalf("attempt %d: backoff %v outside [%v, %v]", attempt, d, want/2, want)
+			}
+		}
+	}
+}
+
+// flakySink fails the first failures writes with err, then keeps the IDs of the first events of the batches written.
+type flakySink struct {
+	failures int
+	err      error
+	writes   int
+	batches  []string
+}
+
+func (s *flakySink) Write(ctx context.Context, events []EventSnapshot) error {
+	s.writes++
+	if s.writes <= s.failures {
+		return s.err
+	}
+	s.batches = append(s.batches, events[0].ID)
+	return nil
+}
+
+func (s *flakySink) Flush(ctx context.Context) error { return nil }
+
+func (s *flakySink) Close(ctx context.Context) error { return nil }
+
+func TestRetrySinkRetries(t *testing.T) {
+	unavailable := errors.New("unavailable")
+	tests := []struct {
+		name     string
+		failures int
+		err      error
+		writes   int
+		want     error
+	}{
+		{"recovers", 2, unavailable, 3, nil},
+		{"gives up", 5, unavailable, 3, unavailable},
+		{"permanent", 5, Permanent(unavailable), 1, unavailable},
+	}
+	for _, tt := range tests {
+		sink := &flakySink{failures: tt.failures, err: tt.err}
+		r := NewRetrySink(sink).WithAttempts(3).WithBackoff(time.Millisecond, time.Millisecond)
+		err := r.Write(context.Background(), spoolBatch("a", 1))
+		if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.want)
+		}
+		if sink.writes != tt.writes {
+			t.Errorf("%s: %d attempts, want %d", tt.name, sink.writes, tt.writes)
+		}
+	}
+}
+
+func TestRetrySinkStopsOnCancel(t *testing.T) {
+	sink := &flakySink{failures: 5, err: errors.New("unavailable")}
+	r := NewRetrySink(sink).WithBackoff(time.Hour, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := r.Write(ctx, spoolBatch("a", 1)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("writing with a cancelled context: %v, want the context error", err)
+	}
+	if sink.writes != 1 {
+		t.Errorf("%d attempts, want 1", sink.writes)
+	}
+}
+
+func TestRetrySinkSpoolsInOrder(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &flakySink{failures: math.MaxInt, err: errors.New("unavailable")}
+	r := NewRetrySink(sink).WithAttempts(2).WithBackoff(time.Millisecond, time.Millisecond).WithSpool(spool)
+	ctx := context.Background()
+
+	if err := r.Write(ctx, spoolBatch("a", 1)); err != nil {
+		t.Fatalf("spooled batch reported as failed: %v", err)
+	}
+	if err := r.Write(ctx, spoolBatch("b", 1)); err != nil {
+		t.Fatalf("spooled batch reported as failed: %v", err)
+	}
+	if spool.Len() != 2 {
+		t.Fatalf("%d batches spooled, want 2", spool.Len())
+	}
+	// The spooled batches go first once the sink recovers.
+	sink.failures = sink.writes
+	if err := r.Write(ctx, spoolBatch("c", 1)); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(sink.batches); got != "[a-0 b-0 c-0]" {
+		t.Errorf("sink received %s, want the batches in order", got)
+	}
+
+	// Permanent failures aren't spooled.
+	sink.failures, sink.err = sink.writes+1, Permanent(errors.New("bad batch"))
+	if err := r.Write(ctx, spoolBatch("d", 1)); !IsPermanent(err) || spool.Len() != 0 {
+		t.Errorf("permanent failure: %v, %d batches spooled", err, spool.Len())
+	}
+
+	// A full spool reports the batches it drops.
+	spool.WithMaxBytes(0)
+	sink.failures, sink.err = sink.writes+2, errors.New("unavailable")
+	if err := r.Write(ctx, spoolBatch("e", 1)); !errors.Is(err, ErrSpoolFull) {
+		t.Errorf("spooling to a full spool: %v, want ErrSpoolFull", err)
+	}
+}
@@ -0,0 +1,321 @@
+package skylight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sink receives batches of emitted events, typically to send them to a file or over the network.
+// Sinks are run as observers through a Batcher.
+type Sink interface {
+	// Write writes a batch of events. The slice must not be retained after Write returns.
+	Write(ctx context.Context, events []EventSnapshot) error
+	// Flush writes any data buffered by the sink.
+	Flush(ctx context.Context) error
+	// Close flushes and releases the sink. Write is not called after Close.
+	Close(ctx context.Context) error
+}
+
+// Batcher runs a Sink as an observer. Events are queued and written in batches, once a batch reaches a number of events,
+// a size in bytes, or a maximum age.
+type Batcher struct {
+	sink      Sink
+	cond      ObserverCondition
+	maxCount  int
+	maxBytes  int
+	interval  time.Duration
+	timeout   time.Duration
+	queueSize int
+	onError   func(error)
+
+	start    sync.Once
+	queue    chan EventSnapshot
+	requests chan batchRequest
+	// done is closed when run returns, so that requests racing Close don't block.
+	done chan struct{}
+	// mu makes closing wait for the handlers queuing an event, so that the events queued before Close are all written
+	// and the later ones all counted as dropped.
+	mu      sync.RWMutex
+	closed  atomic.Bool
+	dropped atomic.Uint64
+	errors  atomic.Uint64
+}
+
+// idleSink is implemented by sinks with work to do even when no events are emitted, such as a RetrySink replaying
+// its spool once the destination recovers from an outage.
+type idleSink interface {
+	idle(ctx context.Context)
+}
+
+// maxSinkDepth bounds how many sink wrappers are unwrapped, in case a sink unwraps to itself.
+const maxSinkDepth = 32
+
+// breakerStats returns the stats of the first sink providing them, unwrapping sinks with an Unwrap() Sink method
+// such as RetrySink.
+func breakerStats(sink Sink) (BreakerStats, bool) {
+	for depth := 0; sink != nil && depth < maxSinkDepth; depth++ {
+		if bs, ok := sink.(interface{ Stats() BreakerStats }); ok {
+			return bs.Stats(), true
+		}
+		u, ok := sink.(interface{ Unwrap() Sink })
+		if !ok {
+			break
+		}
+		sink = u.Unwrap()
+	}
+	return BreakerStats{}, false
+}
+
+type batchRequest struct {
+	close bool
+	done  chan error
+}
+
+// NewBatcher creates a batcher for sink. By default it writes batches of up to 100 events or 1 MiB, at least every second,
+// queues up to 10000 events and reports errors on stderr.
+func NewBatcher(sink Sink) *Batcher {
+	return &Batcher{
+		sink:      sink,
+		cond:      func(e *Event) bool { return true },
+		maxCount:  100,
+		maxBytes:  1 << 20,
+		interval:  time.Second,
+		timeout:   5 * time.Second,
+		queueSize: 10000,
+		onError: func(err error) {
+			fmt.Fprintf(os.Stderr, "skylight: sink: %v\n", err)
+		},
+	}
+}
+
+// WithCondition only batches the events matching cond.
+func (b *Batcher) WithCondition(cond ObserverCondition) *Batcher {
+	if b == nil {
+		return nil
+	}
+	b.cond = cond
+	return b
+}
+
+// WithMaxCount sets the maximum number of events per batch.
+func (b *Batcher) WithMaxCount(n int) *Batcher {
+	if b == nil {
+		return nil
+	}
+	b.maxCount = n
+	return b
+}
+
+// WithMaxBytes sets the maximum estimated size of a batch in bytes.
+func (b *Batcher) WithMaxBytes(n int) *Batcher {
+	if b == nil {
+		return nil
+	}
+	b.maxBytes = n
+	return b
+}
+
+// WithInterval sets the maximum time events wait in a batch before it is written.
+// A non-positive d keeps the default of one second.
+func (b *Batcher) WithInterval(d time.Duration) *Batcher {
+	if b == nil {
+		return nil
+	}
+	if d <= 0 {
+		d = time.Second
+	}
+	b.interval = d
+	return b
+}
+
+// WithTimeout sets the timeout of each Write, Flush and Close call on the sink.
+func (b *Batcher) WithTimeout(d time.Duration) *Batcher {
+	if b == nil {
+		return nil
+	}
+	b.timeout = d
+	return b
+}
+
+// WithQueueSize sets the number of events that can wait to be batched. Events emitted while the queue is full are dropped.
+func (b *Batcher) WithQueueSize(n int) *Batcher {
+	if b == nil {
+		return nil
+	}
+	b.queueSize = n
+	return b
+}
+
+// WithErrorHandler sets the function called with the errors returned by the sink.
+func (b *Batcher) WithErrorHandler(fn func(error)) *Batcher {
+	if b == nil {
+		return nil
+	}
+	b.onError = fn
+	return b
+}
+
+// Observer returns the observer feeding the batcher, to be added to a client.
+// Flushing or closing the client flushes or closes the sink.
+func (b *Batcher) Observer() *Observer {
+	b.start.Do(func() {
+		b.queue = make(chan EventSnapshot, b.queueSize)
+		b.requests = make(chan batchRequest)
+		b.done = make(chan struct{})
+		go b.run()
+	})
+	return &Observer{
+		cond:    b.cond,
+		handler: b.handle,
+		flush:   func() { b.report(b.Flush()) },
+		close:   func() { b.report(b.Close()) },
+		extraStats: func(s *ObserverStats) {
+			s.Dropped = b.dropped.Load()
+			s.Errors = b.errors.Load()
+			s.QueueDepth = len(b.queue)
+			if stats, ok := breakerStats(b.sink); ok {
+				s.Breaker = &stats
+			}
+		},
+	}
+}
+
+// Dropped returns the number of events dropped because the queue was full or the batcher closed.
+func (b *Batcher) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+func (b *Batcher) handle(e *Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed.Load() {
+		b.dropped.Add(1)
+		return
+	}
+	select {
+	case b.queue <- e.Snapshot():
+	default:
+		b.dropped.Add(1)
+	}
+}
+
+// Flush writes the queued events and flushes the sink.
+func (b *Batcher) Flush() error {
+	return b.request(false)
+}
+
+// Close writes the queued events and closes the sink. Events emitted afterwards are dropped.
+// A batcher whose observer was never created closes the sink directly.
+func (b *Batcher) Close() error {
+	b.mu.Lock()
+	closed := b.closed.Swap(true)
+	b.mu.Unlock()
+	if closed {
+		return nil
+	}
+	started := true
+	b.start.Do(func() { started = false })
+	if !started {
+		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+		defer cancel()
+		return b.sink.Close(ctx)
+	}
+	return b.request(true)
+}
+
+func (b *Batcher) request(close bool) error {
+	if b.requests == nil || (!close && b.closed.Load()) {
+		return nil
+	}
+	done := make(chan error, 1)
+	select {
+	case b.requests <- batchRequest{close: close, done: done}:
+		return <-done
+	case <-b.done:
+		return nil
+	}
+}
+
+func (b *Batcher) report(err error) {
+	if err == nil {
+		return
+	}
+	b.errors.Add(1)
+	if b.onError != nil {
+		b.onError(err)
+	}
+}
+
+func (b *Batcher) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	var (
+		batch []EventSnapshot
+		size  int
+	)
+
+	write := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+		err := b.sink.Write(ctx, batch)
+		cancel()
+		clear(batch)
+		batch, size = batch[:0], 0
+		return err
+	}
+
+	add := func(s EventSnapshot) {
+		batch = append(batch, s)
+		size += s.size()
+		if len(batch) >= b.maxCount || size >= b.maxBytes {
+			b.report(write())
+		}
+	}
+
+	for {
+		select {
+		case s := <-b.queue:
+			add(s)
+		case <-ticker.C:
+			if len(batch) > 0 {
+				b.report(write())
+			} else if is, ok := b.sink.(idleSink); ok {
+				ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+				is.idle(ctx)
+				cancel()
+			}
+		case req := <-b.requests:
+			for drained := false; !drained; {
+				select {
+				case s := <-b.queue:
+					add(s)
+				default:
+					drained = true
+				}
+			}
+			err := write()
+
+			ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+			if req.close {
+				err = errors.Join(err, b.sink.Close(ctx))
+			} else {
+				err = errors.Join(err, b.sink.Flush(ctx))
+			}
+			cancel()
+
+			req.done <- err
+			if req.close {
+				return
+			}
+		}
+	}
+}
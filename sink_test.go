@@ -0,0 +1,208 @@
+package skylight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySink keeps the events written to it, and the size of each batch.
+type memorySink struct {
+	mu      sync.Mutex
+	events  []EventSnapshot
+	batches []int
+	closed  bool
+}
+
+func (s *memorySink) Write(ctx context.Context, events []EventSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	s.batches = append(s.batches, len(events))
+	return nil
+}
+
+func (s *memorySink) Flush(ctx context.Context) error { return nil }
+
+func (s *memorySink) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *memorySink) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+func (s *memorySink) batchSizes() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprint(s.batches)
+}
+
+// waitWritten waits for n events to be written to s.
+func (s *memorySink) waitWritten(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.len() < n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if s.len() != n {
+		t.Fatalf("%d events written, want %d", s.len(), n)
+	}
+}
+
+func TestBatcherFlushRacingClose(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		b := NewBatcher(&memorySink{})
+		b.Observer()
+
+		done := make(chan struct{})
+		go func() {
+			b.Flush()
+			close(done)
+		}()
+		b.Close()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Flush blocked after Close")
+		}
+	}
+}
+
+func TestBatcherCountsEventsAfterClose(t *testing.T) {
+	sink := &memorySink{}
+	b := NewBatcher(sink)
+	c := New(WithObserver(b.Observer()))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Info("event").Emit()
+			}
+		}()
+	}
+	b.Close()
+	wg.Wait()
+
+	if got := uint64(sink.len()) + b.Dropped(); got != 400 {
+		t.Errorf("written %d + dropped %d = %d, want 400", sink.len(), b.Dropped(), got)
+	}
+}
+
+func TestBatcherZeroInterval(t *testing.T) {
+	sink := &memorySink{}
+	b := NewBatcher(sink).WithInterval(0)
+	c := New(WithObserver(b.Observer()))
+	c.Info("event").Emit()
+	c.Close()
+
+	if sink.len() != 1 || !sink.closed {
+		t.Errorf("written %d events, closed %v, want 1 and closed", sink.len(), sink.closed)
+	}
+}
+
+func TestBatcherBatches(t *testing.T) {
+	one := func() int {
+		var size int
+		c := New(WithObserver(WildcardObserver(func(e *Event) {
+			s := e.Snapshot()
+			size = s.size()
+		})))
+		c.Info("event").Emit()
+		return size
+	}()
+	tests := []struct {
+		name    string
+		batcher func(*Batcher) *Batcher
+		// written is the number of events written before Flush.
+		written int
+		want    string
+	}{
+		{"count", func(b *Batcher) *Batcher { return b.WithMaxCount(3) }, 6, "[3 3 1]"},
+		{"bytes", func(b *Batcher) *Batcher { return b.WithMaxBytes(2 * one) }, 6, "[2 2 2 1]"},
+		{"interval", func(b *Batcher) *Batcher { return b.WithInterval(10 * time.Millisecond) }, 7, "[7]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &memorySink{}
+			b := tt.batcher(NewBatcher(sink).WithInterval(time.Hour))
+			c := New(WithObserver(b.Observer()))
+			defer c.Close()
+			for i := 0; i < 7; i++ {
+				c.Info("event").Emit()
+			}
+			sink.waitWritten(t, tt.written)
+			c.Flush()
+			if got := sink.batchSizes(); got != tt.want {
+				t.Errorf("batches of %s events, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatcherCloseWithoutObserver(t *testing.T) {
+	sink := &memorySink{}
+	b := NewBatcher(sink)
+	if err := b.Close(); err != nil || !sink.closed {
+		t.Errorf("Close: %v, sink closed %v", err, sink.closed)
+	}
+	// The observer of a closed batcher drops its events.
+	c := New(WithObserver(b.Observer()))
+	c.Info("late").Emit()
+	c.Flush()
+	if sink.len() != 0 || b.Dropped() != 1 {
+		t.Errorf("written %d, dropped %d events after Close, want 0 and 1", sink.len(), b.Dropped())
+	}
+}
+
+// jsonSink encodes the batches written to it, reading their values on the goroutine of the Batcher.
+type jsonSink struct {
+	memorySink
+}
+
+func (s *jsonSink) Write(ctx context.Context, events []EventSnapshot) error {
+	if _, err := json.Marshal(events); err != nil {
+		return err
+	}
+	return s.memorySink.Write(ctx, events)
+}
+
+func TestBatcherSnapshotsValues(t *testing.T) {
+	sink := &jsonSink{}
+	b := NewBatcher(sink).WithInterval(time.Millisecond)
+	c := New(WithObserver(b.Observer()))
+	defer c.Close()
+
+	tags := []string{"before"}
+	user := Fields{"plan": "free", "tags": tags, "limits": map[string]int{"rps": 1}}
+	c.Info("event").Any("user", user).Any("tags", tags).Emit()
+	// The batcher encodes the event while the caller goes on with its values.
+	tags[0] = "after"
+	user["plan"] = "pro"
+	user["limits"].(map[string]int)["rps"] = 2
+	sink.waitWritten(t, 1)
+
+	s := sink.events[0]
+	got, _ := s.Field("user")
+	want := Fields{"plan": "free", "tags": []string{"before"}, "limits": map[string]int{"rps": 1}}
+	if fmt.Sprint(got.Value()) != fmt.Sprint(want) {
+		t.Errorf("user = %v, want the value at Emit %v", got.Value(), want)
+	}
+	if got, _ := s.Field("tags"); fmt.Sprint(got.Value()) != "[before]" {
+		t.Errorf("tags = %v, want [before]", got.Value())
+	}
+	if _, ok := got.Value().(Fields); !ok {
+		t.Errorf("user is a %T, want Fields", got.Value())
+	}
+}
@@ -0,0 +1,359 @@
+// Package skylightgrpc provides gRPC interceptors creating skylight events for every call.
+package skylightgrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benchatech/skylight"
+	"github.com/benchatech/skylight/internal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	hooks      = internal.GetHooks[*skylight.Client, *skylight.Event, skylight.Level]()
+	beginEvent = hooks.BeginEvent
+	endEvent   = hooks.EndEvent
+)
+
+// Option configures the interceptors.
+type Option func(cfg *config)
+
+type config struct {
+	propagator skylight.Propagator
+}
+
+// WithPropagator sets the propagator carrying event parentage in gRPC metadata. It defaults to
+// skylight.DefaultPropagator; nil disables propagation.
+func WithPropagator(p skylight.Propagator) Option {
+	return func(cfg *config) {
+		cfg.propagator = p
+	}
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{propagator: skylight.DefaultPropagator()}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// MetadataCarrier adapts gRPC metadata to a skylight.Carrier.
+type MetadataCarrier metadata.MD
+
+func (c MetadataCarrier) Get(key string) string {
+	if vs := metadata.MD(c).Get(key); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+func (c MetadataCarrier) Set(key, value string) { metadata.MD(c).Set(key, value) }
+
+// CodeLevel maps a gRPC status code to a level: info for OK, warn for the codes caused by the caller,
+// and error for the others.
+func CodeLevel(code codes.Code) skylight.Level {
+	switch code {
+	case codes.OK:
+		return skylight.LevelInfo
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied,
+		codes.Unauthenticated, codes.ResourceExhausted, codes.FailedPrecondition, codes.Aborted, codes.OutOfRange:
+		return skylight.LevelWarn
+	default:
+		return skylight.LevelError
+	}
+}
+
+// UnaryServerInterceptor creates a root event with the "grpc.server" topic for every call, stored in the handler
+// context so that the events of the handler become its children. The event is a child of the remote caller when
+// the call metadata carries one.
+func UnaryServerInterceptor(c *skylight.Client, opts ...Option) grpc.UnaryServerInterceptor {
+	cfg := newConfig(opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		e := cfg.serverEvent(ctx, c, info.FullMethod)
+		if e == nil {
+			return handler(ctx, req)
+		}
+		start := time.Now()
+		defer func() {
+			if p := recover(); p != nil {
+				end(e, start, panicError(p))
+				panic(p)
+			}
+		}()
+		resp, err := handler(skylight.ContextWithEvent(ctx, e), req)
+		end(e, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor creates a root event with the "grpc.server" topic for every stream, like
+// UnaryServerInterceptor. Every message sent or received is a debug child event with the "grpc.message" topic,
+// and the event records the message counts.
+func StreamServerInterceptor(c *skylight.Client, opts ...Option) grpc.StreamServerInterceptor {
+	cfg := newConfig(opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		e := cfg.serverEvent(ss.Context(), c, info.FullMethod)
+		if e == nil {
+			return handler(srv, ss)
+		}
+		start := time.Now()
+		ws := &serverStream{ServerStream: ss, ctx: skylight.ContextWithEvent(ss.Context(), e), counter: counter{e: e}}
+		defer func() {
+			if p := recover(); p != nil {
+				ws.finish(start, panicError(p))
+				panic(p)
+			}
+		}()
+		err := handler(srv, ws)
+		ws.finish(start, err)
+		return err
+	}
+}
+
+// UnaryClientInterceptor creates an event with the "grpc.client" topic for every call. It is a child of the event in
+// the call context, or a root event of c when there is none; c may be nil to only record calls made on behalf of an
+// event. The event identity is sent in the call metadata.
+func UnaryClientInterceptor(c *skylight.Client, opts ...Option) grpc.UnaryClientInterceptor {
+	cfg := newConfig(opts)
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		e := cfg.clientEvent(ctx, c, method, cc.Target())
+		if e == nil {
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		}
+		start := time.Now()
+		err := invoker(cfg.inject(ctx, e), method, req, reply, cc, callOpts...)
+		end(e, start, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor creates an event with the "grpc.client" topic for every stream, like
+// UnaryClientInterceptor, with message child events and counts like StreamServerInterceptor.
+// The event is emitted when the stream ends: when receiving fails, including with io.EOF, after the only
+// response of a stream without server streaming, or when the context of the stream is done. gRPC requires callers
+// to do one or the other; the event of a stream dropped without either is ended with the Canceled code once the
+// stream is garbage collected. Since that depends on when the garbage collector runs, the duration of such an event
+// is meaningless, and it has an "abandoned" field set to true, which tells it from a stream whose context was canceled.
+func StreamClientInterceptor(c *skylight.Client, opts ...Option) grpc.StreamClientInterceptor {
+	cfg := newConfig(opts)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		e := cfg.clientEvent(ctx, c, method, cc.Target())
+		if e == nil {
+			return streamer(ctx, desc, cc, method, callOpts...)
+		}
+		start := time.Now()
+		cs, err := streamer(cfg.inject(ctx, e), desc, cc, method, callOpts...)
+		if err != nil {
+			end(e, start, err)
+			return cs, err
+		}
+		state := &clientState{start: start, done: make(chan struct{}), counter: counter{e: e}}
+		s := &clientStream{ClientStream: cs, desc: desc, clientState: state}
+		runtime.SetFinalizer(s, func(s *clientStream) { s.finish(errAbandoned) })
+		// Callers that stop reading must cancel the context, which ends the stream without a final RecvMsg.
+		// The goroutine only references the state, so that an abandoned stream can still be collected.
+		go func() {
+			select {
+			case <-ctx.Done():
+				state.finish(status.FromContextError(ctx.Err()).Err())
+			case <-state.done:
+			}
+		}()
+		return s, nil
+	}
+}
+
+func (cfg *config) serverEvent(ctx context.Context, c *skylight.Client, method string) *skylight.Event {
+	e := beginEvent(ctx, c)
+	if e == nil {
+		return nil
+	}
+	if cfg.propagator != nil && skylight.EventFromContext(ctx) == nil {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if p, ok := cfg.propagator.Extract(MetadataCarrier(md)); ok {
+				e.RemoteParent(p)
+			}
+		}
+	}
+	e.Topic("grpc.server").Message(method)
+	setMethod(e, method)
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		e.Str("peer", p.Addr.String())
+	}
+	return e
+}
+
+func (cfg *config) clientEvent(ctx context.Context, c *skylight.Client, method, target string) *skylight.Event {
+	e := beginEvent(ctx, c)
+	if e == nil {
+		return nil
+	}
+	e.Topic("grpc.client").Message(method).Str("peer", target)
+	setMethod(e, method)
+	return e
+}
+
+// inject adds the identity of e to the outgoing metadata of ctx.
+func (cfg *config) inject(ctx context.Context, e *skylight.Event) context.Context {
+	if cfg.propagator == nil {
+		return ctx
+	}
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	cfg.propagator.Inject(e, MetadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// setMethod records a full method name, "/package.Service/Method", and its service.
+func setMethod(e *skylight.Event, method string) {
+	e.Str("method", method)
+	if service, _, ok := strings.Cut(strings.TrimPrefix(method, "/"), "/"); ok {
+		e.Str("service", service)
+	}
+}
+
+func end(e *skylight.Event, start time.Time, err error) {
+	code := status.Code(err)
+	e.Str("code", code.String()).
+		Dur("duration", time.Since(start)).
+		Err("error", err)
+	endEvent(e, CodeLevel(code))
+}
+
+// panicError is the status recorded for a handler that panicked.
+func panicError(p any) error {
+	return status.Error(codes.Internal, fmt.Sprintf("panic: %v", p))
+}
+
+// counter counts the messages of a stream and emits a child event for each of them. Client streams may send and
+// receive from different goroutines, and end from either, so mu orders the messages with the end of the stream.
+type counter struct {
+	e        *skylight.Event
+	mu       sync.Mutex
+	sent     int64
+	received int64
+	ended    bool
+}
+
+func (c *counter) message(direction string, n *int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ended {
+		return
+	}
+	*n++
+	c.e.Debug("message ", direction).
+		Topic("grpc.message").
+		Str("direction", direction).
+		Int64("seq", *n).
+		Emit()
+}
+
+// finish adds the message counts to the stream event and ends it, reporting false when it already ended.
+func (c *counter) finish(start time.Time, err error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ended {
+		return false
+	}
+	c.ended = true
+	c.e.Int64("messages_sent", c.sent).
+		Int64("messages_received", c.received)
+	if err == errAbandoned {
+		c.e.Bool("abandoned", true)
+	}
+	end(c.e, start, err)
+	return true
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	counter
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.message("sent", &s.sent)
+	}
+	return err
+}
+
+func (s *serverStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.message("received", &s.received)
+	}
+	return err
+}
+
+// errAbandoned is the status recorded for a client stream garbage collected before it ended.
+var errAbandoned = status.Error(codes.Canceled, "skylightgrpc: stream abandoned before it ended")
+
+// clientStream is the stream handed to the caller. Its state is kept apart, so that the stream is collected once the
+// caller drops it, even though the state is still watched for the end of the context.
+type clientStream struct {
+	grpc.ClientStream
+	desc *grpc.StreamDesc
+	*clientState
+}
+
+type clientState struct {
+	start time.Time
+	done  chan struct{}
+	counter
+}
+
+func (s *clientStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.message("sent", &s.sent)
+	} else if !errors.Is(err, io.EOF) {
+		// io.EOF means the stream was aborted: RecvMsg reports the actual status.
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		s.message("received", &s.received)
+		if !s.desc.ServerStreams {
+			s.finish(nil)
+		}
+	case errors.Is(err, io.EOF):
+		s.finish(nil)
+	default:
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *clientState) finish(err error) {
+	if s.counter.finish(s.start, err) {
+		close(s.done)
+	}
+}
@@ -0,0 +1,206 @@
+package skylightgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benchatech/skylight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newHealth serves the health service over an in-memory connection, with interceptors emitting to events.
+func newHealth(t *testing.T, events chan<- skylight.EventSnapshot) healthpb.HealthClient {
+	t.Helper()
+	c := skylight.New(skylight.WithObserver(skylight.WildcardObserver(func(e *skylight.Event) {
+		events <- e.Snapshot()
+	})))
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.UnaryInterceptor(UnaryServerInterceptor(c)), grpc.StreamInterceptor(StreamServerInterceptor(c)))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	cc, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(c)),
+		grpc.WithStreamInterceptor(StreamClientInterceptor(c)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return healthpb.NewHealthClient(cc)
+}
+
+// receive returns the next event with the given topic.
+func receive(t *testing.T, events <-chan skylight.EventSnapshot, topic string) skylight.EventSnapshot {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Topic == topic {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("no %s event emitted", topic)
+			return skylight.EventSnapshot{}
+		}
+	}
+}
+
+func field(e skylight.EventSnapshot, key string) any {
+	f, _ := e.Field(key)
+	return f.Value()
+}
+
+func TestUnaryCall(t *testing.T) {
+	events := make(chan skylight.EventSnapshot, 16)
+	client := newHealth(t, events)
+
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	server := receive(t, events, "grpc.server")
+	call := receive(t, events, "grpc.client")
+	if server.ParentID != call.ID || server.TraceID != call.TraceID {
+		t.Errorf("server event has parent %q in trace %q, want the client event %q in trace %q",
+			server.ParentID, server.TraceID, call.ID, call.TraceID)
+	}
+	for _, e := range []skylight.EventSnapshot{server, call} {
+		if field(e, "code") != "OK" || field(e, "method") != "/grpc.health.v1.Health/Check" || e.Level != skylight.LevelInfo {
+			t.Errorf("%s event: code %v, method %v, level %v", e.Topic, field(e, "code"), field(e, "method"), e.Level)
+		}
+	}
+}
+
+func TestClientStreamEndsWithItsContext(t *testing.T) {
+	events := make(chan skylight.EventSnapshot, 16)
+	client := newHealth(t, events)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	// The caller stops reading and cancels: no RecvMsg reports the end of the stream.
+	cancel()
+
+	e := receive(t, events, "grpc.client")
+	if field(e, "code") != codes.Canceled.String() || field(e, "messages_received") != int64(1) {
+		t.Errorf("stream event: code %v after %v messages, want Canceled after 1", field(e, "code"), field(e, "messages_received"))
+	}
+	if _, ok := e.Field("abandoned"); ok {
+		t.Error("canceled stream reported as abandoned")
+	}
+}
+
+func TestClientStreamEndsWhenAbandoned(t *testing.T) {
+	events := make(chan skylight.EventSnapshot, 16)
+	client := newHealth(t, events)
+
+	// The caller neither reads the stream to the end nor cancels its context, and drops it.
+	func() {
+		stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Recv(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case e := <-events:
+			if e.Topic != "grpc.client" {
+				continue
+			}
+			if field(e, "code") != codes.Canceled.String() || field(e, "messages_received") != int64(1) || e.Level != skylight.LevelWarn {
+				t.Errorf("stream event: code %v after %v messages at %v, want Canceled after 1", field(e, "code"), field(e, "messages_received"), e.Level)
+			}
+			if field(e, "abandoned") != true {
+				t.Errorf("abandoned = %v, want true", field(e, "abandoned"))
+			}
+			return
+		case <-timeout:
+			t.Fatal("abandoned stream never ended")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestUnaryServerPanic(t *testing.T) {
+	events := make(chan skylight.EventSnapshot, 1)
+	c := skylight.New(skylight.WithObserver(skylight.WildcardObserver(func(e *skylight.Event) {
+		events <- e.Snapshot()
+	})))
+	interceptor := UnaryServerInterceptor(c)
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recovered %v, want the handler panic", p)
+			}
+		}()
+		interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test.Service/Panic"},
+			func(ctx context.Context, req any) (any, error) { panic("boom") })
+	}()
+
+	e := receive(t, events, "grpc.server")
+	if field(e, "code") != codes.Internal.String() || e.Level != skylight.LevelError {
+		t.Errorf("panicking call: code %v at level %v, want Internal at error", field(e, "code"), e.Level)
+	}
+}
+
+// fakeClientStream succeeds sending, and ends the stream on the first receive.
+type fakeClientStream struct {
+	grpc.ClientStream
+}
+
+func (fakeClientStream) SendMsg(m any) error { return nil }
+func (fakeClientStream) RecvMsg(m any) error { return io.EOF }
+
+func TestClientStreamSendRacingEnd(t *testing.T) {
+	c := skylight.New(skylight.WithLevel(skylight.LevelDebug))
+	for i := 0; i < 100; i++ {
+		s := &clientStream{
+			ClientStream: fakeClientStream{},
+			desc:         &grpc.StreamDesc{ServerStreams: true},
+			clientState: &clientState{
+				start:   time.Now(),
+				counter: counter{e: beginEvent(context.Background(), c)},
+				done:    make(chan struct{}),
+			},
+		}
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				s.SendMsg(nil)
+			}
+		}()
+		if err := s.RecvMsg(nil); !errors.Is(err, io.EOF) {
+			t.Fatal(err)
+		}
+		wg.Wait()
+	}
+}
@@ -0,0 +1,184 @@
+package skylightotel
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/benchatech/skylight"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+)
+
+// attributes converts event fields to span attributes. Durations and times are rendered as strings.
+type attributes []attribute.KeyValue
+
+func (a *attributes) VisitString(key, value string) {
+	*a = append(*a, attribute.String(key, value))
+}
+
+func (a *attributes) VisitInt64(key string, value int64) {
+	*a = append(*a, attribute.Int64(key, value))
+}
+
+func (a *attributes) VisitFloat64(key string, value float64) {
+	*a = append(*a, attribute.Float64(key, value))
+}
+
+func (a *attributes) VisitBool(key string, value bool) {
+	*a = append(*a, attribute.Bool(key, value))
+}
+
+func (a *attributes) VisitDuration(key string, value time.Duration) {
+	*a = append(*a, attribute.String(key, value.String()))
+}
+
+func (a *attributes) VisitTime(key string, value time.Time) {
+	*a = append(*a, attribute.String(key, value.Format(time.RFC3339Nano)))
+}
+
+func (a *attributes) VisitError(key string, err error) {
+	if err != nil {
+		*a = append(*a, attribute.String(key, err.Error()))
+	}
+}
+
+func (a *attributes) VisitAny(key string, value any) {
+	*a = append(*a, attribute.String(key, fmt.Sprint(value)))
+}
+
+// logAttributes converts event fields to log record attributes.
+type logAttributes []log.KeyValue
+
+func (a *logAttributes) VisitString(key, value string) {
+	*a = append(*a, log.String(key, value))
+}
+
+func (a *logAttributes) VisitInt64(key string, value int64) {
+	*a = append(*a, log.Int64(key, value))
+}
+
+func (a *logAttributes) VisitFloat64(key string, value float64) {
+	*a = append(*a, log.Float64(key, value))
+}
+
+func (a *logAttributes) VisitBool(key string, value bool) {
+	*a = append(*a, log.Bool(key, value))
+}
+
+func (a *logAttributes) VisitDuration(key string, value time.Duration) {
+	*a = append(*a, log.String(key, value.String()))
+}
+
+func (a *logAttributes) VisitTime(key string, value time.Time) {
+	*a = append(*a, log.String(key, value.Format(time.RFC3339Nano)))
+}
+
+func (a *logAttributes) VisitError(key string, err error) {
+	if err != nil {
+		*a = append(*a, log.String(key, err.Error()))
+	}
+}
+
+func (a *logAttributes) VisitAny(key string, value any) {
+	*a = append(*a, log.String(key, fmt.Sprint(value)))
+}
+
+// Resource converts a skylight resource to an OpenTelemetry resource, to configure the providers with the same
+// process metadata as the client.
+func Resource(r *skylight.Resource) *resource.Resource {
+	var attrs attributes
+	r.VisitFields(&attrs)
+	return resource.NewSchemaless(attrs...)
+}
+
+func severity(level skylight.Level) log.Severity {
+	switch level {
+	case skylight.LevelTrace:
+		return log.SeverityTrace
+	case skylight.LevelDebug:
+		return log.SeverityDebug
+	case skylight.LevelInfo:
+		return log.SeverityInfo
+	case skylight.LevelWarn:
+		return log.SeverityWarn
+	case skylight.LevelError:
+		return log.SeverityError
+	case skylight.LevelFatal:
+		return log.SeverityFatal
+	case skylight.LevelPanic:
+		return log.SeverityFatal4
+	default:
+		return log.SeverityUndefined
+	}
+}
+
+// otlpAttributes converts event and resource fields to OTLP attributes.
+type otlpAttributes []*commonpb.KeyValue
+
+func (a *otlpAttributes) add(key string, v *commonpb.AnyValue) {
+	*a = append(*a, &commonpb.KeyValue{Key: key, Value: v})
+}
+
+func (a *otlpAttributes) VisitString(key, value string) {
+	a.add(key, &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}})
+}
+
+func (a *otlpAttributes) VisitInt64(key string, value int64) {
+	a.add(key, &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: value}})
+}
+
+func (a *otlpAttributes) VisitFloat64(key string, value float64) {
+	a.add(key, &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: value}})
+}
+
+func (a *otlpAttributes) VisitBool(key string, value bool) {
+	a.add(key, &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: value}})
+}
+
+func (a *otlpAttributes) VisitDuration(key string, value time.Duration) {
+	a.VisitString(key, value.String())
+}
+
+func (a *otlpAttributes) VisitTime(key string, value time.Time) {
+	a.VisitString(key, value.Format(time.RFC3339Nano))
+}
+
+// VisitError adds the structured rendering of err, see skylight.RenderError, as a key-value list.
+func (a *otlpAttributes) VisitError(key string, err error) {
+	if err != nil {
+		a.add(key, errorValue(skylight.RenderError(err)))
+	}
+}
+
+func (a *otlpAttributes) VisitAny(key string, value any) {
+	a.VisitString(key, fmt.Sprint(value))
+}
+
+// errorValue converts the rendering of an error to an OTLP key-value list with the members of skylight.ErrorInfo.
+func errorValue(info *skylight.ErrorInfo) *commonpb.AnyValue {
+	var attrs otlpAttributes
+	attrs.VisitString("message", info.Message)
+	attrs.VisitString("type", info.Type)
+	if len(info.Stack) > 0 {
+		frames := make([]*commonpb.AnyValue, len(info.Stack))
+		for i, f := range info.Stack {
+			frames[i] = &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{
+				StringValue: fmt.Sprintf("%s %s:%d", f.Function, f.File, f.Line),
+			}}
+		}
+		attrs.add("stack", &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: frames}}})
+	}
+	if info.Cause != nil {
+		attrs.add("cause", errorValue(info.Cause))
+	}
+	if len(info.Errors) > 0 {
+		errs := make([]*commonpb.AnyValue, len(info.Errors))
+		for i := range info.Errors {
+			errs[i] = errorValue(&info.Errors[i])
+		}
+		attrs.add("errors", &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: errs}}})
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: attrs}}}
+}
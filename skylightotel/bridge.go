@@ -0,0 +1,250 @@
+// Package skylightotel maps skylight events to OpenTelemetry spans, span events and log records,
+// so that traces and logs correlate with the events of a client.
+package skylightotel
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/benchatech/skylight"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DurationKey is the field that makes an event timed: an event with a duration under this key becomes a span
+// ending when the event was emitted.
+const DurationKey = "duration"
+
+const instrumentationName = "github.com/benchatech/skylight/skylightotel"
+
+// Bridge maps event trees to OpenTelemetry:
+//   - held events become spans, ended when the event is evicted;
+//   - timed events, with a DurationKey field, become spans ending when the event was emitted;
+//   - other events become log records when a logger provider is set, or events of the span of their parent otherwise.
+//
+// Parent IDs become span parents, and trace and span IDs come from the event IDs, see IDGenerator.
+//
+// The spans of held events that are never evicted are ended once too many spans are open, oldest first, and when the
+// client is closed.
+type Bridge struct {
+	tracer   trace.Tracer
+	logger   log.Logger
+	maxSpans int
+
+	mu    sync.Mutex
+	spans map[string]*list.Element
+	// open lists the open spans, oldest first.
+	open *list.List
+}
+
+// openSpan is an element of Bridge.open.
+type openSpan struct {
+	id   string
+	span trace.Span
+}
+
+// NewBridge creates a bridge creating spans with tp. By default up to 10000 spans of held events are kept open.
+func NewBridge(tp trace.TracerProvider) *Bridge {
+	return &Bridge{
+		tracer:   tp.Tracer(instrumentationName),
+		maxSpans: 10000,
+		spans:    make(map[string]*list.Element),
+		open:     list.New(),
+	}
+}
+
+// WithMaxOpenSpans sets the number of spans of held events kept open. Beyond it, the oldest span is ended.
+func (b *Bridge) WithMaxOpenSpans(n int) *Bridge {
+	if b == nil {
+		return nil
+	}
+	b.maxSpans = max(n, 1)
+	return b
+}
+
+// WithLoggerProvider emits the events that don't become spans as log records of lp, carrying the trace context of their parent.
+func (b *Bridge) WithLoggerProvider(lp log.LoggerProvider) *Bridge {
+	if b == nil {
+		return nil
+	}
+	b.logger = lp.Logger(instrumentationName)
+	return b
+}
+
+// Observer returns the observer feeding the bridge, to be added to a client.
+// Closing the client ends the spans still open.
+func (b *Bridge) Observer() *skylight.Observer {
+	return skylight.WildcardObserver(b.handle).
+		WithEvict(b.evict).
+		WithClose(b.Close).
+		WithID("otel")
+}
+
+// Close ends the spans of the held events that were not evicted yet.
+func (b *Bridge) Close() {
+	b.mu.Lock()
+	open := b.open
+	b.spans = make(map[string]*list.Element)
+	b.open = list.New()
+	b.mu.Unlock()
+
+	for el := open.Front(); el != nil; el = el.Next() {
+		el.Value.(openSpan).span.End()
+	}
+}
+
+func (b *Bridge) handle(e *skylight.Event) {
+	s := e.Snapshot()
+	ctx := b.parentContext(&s)
+
+	d, timed := duration(&s)
+	if !e.Held() && !timed {
+		b.event(ctx, &s)
+		return
+	}
+
+	start := s.CreatedAt
+	if timed {
+		start = s.EmittedAt.Add(-d)
+	}
+	traceID, _ := trace.TraceIDFromHex(s.TraceID)
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		traceID = sc.TraceID()
+	}
+	_, span := b.tracer.Start(withIDs(ctx, traceID, SpanID(s.ID)), spanName(&s),
+		trace.WithTimestamp(start),
+		trace.WithAttributes(eventAttributes(&s)...),
+	)
+	setStatus(span, &s)
+
+	if timed {
+		span.End(trace.WithTimestamp(s.EmittedAt))
+		return
+	}
+	var oldest trace.Span
+	b.mu.Lock()
+	b.spans[s.ID] = b.open.PushBack(openSpan{id: s.ID, span: span})
+	if b.open.Len() > b.maxSpans {
+		o := b.open.Remove(b.open.Front()).(openSpan)
+		delete(b.spans, o.id)
+		oldest = o.span
+	}
+	b.mu.Unlock()
+	if oldest != nil {
+		oldest.End()
+	}
+}
+
+// span returns the open span of the event with the given ID.
+func (b *Bridge) span(id string) (trace.Span, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	el, ok := b.spans[id]
+	if !ok {
+		return nil, false
+	}
+	return el.Value.(openSpan).span, true
+}
+
+// evict ends the span of a held event, with the fields added to the event since it was emitted.
+func (b *Bridge) evict(e *skylight.Event) {
+	s := e.Snapshot()
+	b.mu.Lock()
+	el, ok := b.spans[s.ID]
+	if ok {
+		delete(b.spans, s.ID)
+		b.open.Remove(el)
+	}
+	b.mu.Unlock()
+	if !ok {
+		return
+	}
+	span := el.Value.(openSpan).span
+	span.SetAttributes(eventAttributes(&s)...)
+	setStatus(span, &s)
+	span.End()
+}
+
+// event emits an ordinary event as a log record, or as an event of its parent span.
+func (b *Bridge) event(ctx context.Context, s *skylight.EventSnapshot) {
+	if b.logger != nil {
+		var r log.Record
+		r.SetTimestamp(s.EmittedAt)
+		r.SetObservedTimestamp(s.EmittedAt)
+		r.SetSeverity(severity(s.Level))
+		r.SetSeverityText(s.Level.String())
+		r.SetBody(log.StringValue(s.Message))
+		attrs := logAttributes{log.String("skylight.event_id", s.ID)}
+		if s.Topic != "" {
+			attrs = append(attrs, log.String("skylight.topic", s.Topic))
+		}
+		s.VisitFields(&attrs)
+		r.AddAttributes(attrs...)
+		b.logger.Emit(ctx, r)
+		return
+	}
+
+	if span, ok := b.span(s.ParentID); ok {
+		span.AddEvent(s.Message,
+			trace.WithTimestamp(s.EmittedAt),
+			trace.WithAttributes(eventAttributes(s)...),
+		)
+	}
+}
+
+// parentContext returns a context carrying the span context of the parent event. Parents without an open span,
+// e.g. events of another process, are referred to by the trace of the event and the span ID derived from the parent ID.
+func (b *Bridge) parentContext(s *skylight.EventSnapshot) context.Context {
+	ctx := context.Background()
+	if s.ParentID == "" {
+		return ctx
+	}
+	if span, ok := b.span(s.ParentID); ok {
+		return trace.ContextWithSpanContext(ctx, span.SpanContext())
+	}
+	traceID, _ := trace.TraceIDFromHex(s.TraceID)
+	return trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     SpanID(s.ParentID),
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	}))
+}
+
+func duration(s *skylight.EventSnapshot) (time.Duration, bool) {
+	f, ok := s.Field(DurationKey)
+	if !ok || f.Kind != skylight.KindDuration {
+		return 0, false
+	}
+	return f.Value().(time.Duration), true
+}
+
+// spanName names spans after the event topic, which has a lower cardinality than the message.
+func spanName(s *skylight.EventSnapshot) string {
+	if s.Topic != "" {
+		return s.Topic
+	}
+	return s.Message
+}
+
+func eventAttributes(s *skylight.EventSnapshot) []attribute.KeyValue {
+	attrs := attributes{
+		attribute.String("skylight.event_id", s.ID),
+		attribute.String("skylight.level", s.Level.String()),
+	}
+	if s.Topic != "" {
+		attrs = append(attrs, attribute.String("skylight.message", s.Message))
+	}
+	s.VisitFields(&attrs)
+	return attrs
+}
+
+func setStatus(span trace.Span, s *skylight.EventSnapshot) {
+	if s.Level >= skylight.LevelError {
+		span.SetStatus(codes.Error, s.Message)
+	}
+}
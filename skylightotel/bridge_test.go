@@ -0,0 +1,135 @@
+package skylightotel_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/benchatech/skylight"
+	"github.com/benchatech/skylight/skylightotel"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/logtest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newBridge(t *testing.T) (*tracetest.SpanRecorder, *skylightotel.Bridge) {
+	t.Helper()
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr), sdktrace.WithIDGenerator(skylightotel.IDGenerator()))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	return sr, skylightotel.NewBridge(tp)
+}
+
+func TestBridgeSpans(t *testing.T) {
+	sr, b := newBridge(t)
+	c := skylight.New(skylight.WithObserver(b.Observer()))
+
+	req := c.Info("request").Topic("http").Emit(true)
+	reqID, traceID := req.ID(), req.TraceID()
+	req.Info("query").Topic("sql").Dur(skylightotel.DurationKey, 5*time.Millisecond).Emit()
+	req.Warn("slow").Emit()
+	req.Evict()
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans ended, want 2", len(spans))
+	}
+	query, request := spans[0], spans[1]
+	if request.Name() != "http" || request.SpanContext().SpanID() != skylightotel.SpanID(reqID) {
+		t.Errorf("request span = %s %s, want http %s", request.Name(), request.SpanContext().SpanID(), skylightotel.SpanID(reqID))
+	}
+	if got := request.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("trace ID = %s, want %s", got, traceID)
+	}
+	if query.Name() != "sql" || query.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Errorf("query span = %s with parent %s, want sql under the request span", query.Name(), query.Parent().SpanID())
+	}
+	if d := query.EndTime().Sub(query.StartTime()); d != 5*time.Millisecond {
+		t.Errorf("query span lasted %v, want 5ms", d)
+	}
+	if events := request.Events(); len(events) != 1 || events[0].Name != "slow" {
+		t.Errorf("request span events = %v, want the slow event", events)
+	}
+}
+
+func TestBridgeBoundsOpenSpans(t *testing.T) {
+	sr, b := newBridge(t)
+	c := skylight.New(skylight.WithObserver(b.WithMaxOpenSpans(2).Observer()))
+
+	first := c.Info("first").Emit(true)
+	firstID := first.ID()
+	c.Info("second").Emit(true)
+	c.Info("third").Emit(true)
+
+	spans := sr.Ended()
+	if len(spans) != 1 || spans[0].SpanContext().SpanID() != skylightotel.SpanID(firstID) {
+		t.Fatalf("ended %d spans, want the oldest one", len(spans))
+	}
+
+	c.Close()
+	if n := len(sr.Ended()); n != 3 {
+		t.Errorf("ended %d spans after Close, want 3", n)
+	}
+}
+
+func TestBridgeLogRecords(t *testing.T) {
+	sr, b := newBridge(t)
+	lp := logtest.NewRecorder()
+	c := skylight.New(skylight.WithLevel(skylight.LevelTrace), skylight.WithObserver(b.WithLoggerProvider(lp).Observer()))
+
+	req := c.Info("request").Topic("http").Emit(true)
+	req.Warn("cache miss").Topic("cache").Str("key", "user:42").Int("attempt", 2).Bool("stale", true).Emit()
+	req.Info("query").Dur(skylightotel.DurationKey, time.Millisecond).Emit()
+	c.Trace("plain").Emit()
+	c.Debug("plain").Emit()
+	c.Info("plain").Emit()
+	c.Error("plain").Emit()
+	req.Evict()
+
+	scopes := lp.Result()
+	if len(scopes) != 1 || scopes[0].Name != "github.com/benchatech/skylight/skylightotel" {
+		t.Fatalf("log scopes = %v, want the bridge scope", scopes)
+	}
+	records := scopes[0].Records
+	// Spans don't become log records, nor span events.
+	if len(records) != 5 {
+		t.Fatalf("%d log records, want 5", len(records))
+	}
+	if events := sr.Ended()[1].Events(); len(events) != 0 {
+		t.Errorf("request span has events %v, want log records instead", events)
+	}
+
+	miss := records[0]
+	if miss.Severity() != log.SeverityWarn || miss.SeverityText() != "warn" || miss.Body().AsString() != "cache miss" {
+		t.Errorf("record %v %q %v, want warn \"cache miss\"", miss.Severity(), miss.SeverityText(), miss.Body())
+	}
+	attrs := map[string]string{}
+	miss.WalkAttributes(func(kv log.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.String()
+		return true
+	})
+	want := map[string]string{"skylight.topic": "cache", "key": "user:42", "attempt": "2", "stale": "true"}
+	for k, v := range want {
+		if attrs[k] != v {
+			t.Errorf("attribute %s = %q, want %q", k, attrs[k], v)
+		}
+	}
+	if attrs["skylight.event_id"] == "" {
+		t.Error("record without the event ID")
+	}
+	// The record carries the trace context of its parent span.
+	if sc := trace.SpanContextFromContext(miss.Context()); sc.SpanID() != sr.Ended()[1].SpanContext().SpanID() {
+		t.Errorf("record in span %s, want the request span", sc.SpanID())
+	}
+
+	var severities []string
+	for _, r := range records[1:] {
+		severities = append(severities, fmt.Sprintf("%v/%s", r.Severity(), r.SeverityText()))
+	}
+	if got := fmt.Sprint(severities); got != "[TRACE/trace DEBUG/debug INFO/info ERROR/error]" {
+		t.Errorf("severities = %s", got)
+	}
+}
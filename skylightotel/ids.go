@@ -0,0 +1,71 @@
+package skylightotel
+
+import (
+	"context"
+	"crypto/rand"
+
+	"github.com/benchatech/skylight"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceID returns the trace ID of the trace rooted at the event with the given ID, see skylight.DeriveTraceID.
+func TraceID(eventID string) trace.TraceID {
+	id, _ := trace.TraceIDFromHex(skylight.DeriveTraceID(eventID))
+	return id
+}
+
+// SpanID returns the span ID of the event with the given ID, see skylight.DeriveSpanID.
+func SpanID(eventID string) trace.SpanID {
+	id, _ := trace.SpanIDFromHex(skylight.DeriveSpanID(eventID))
+	return id
+}
+
+type idsKey struct{}
+
+type ids struct {
+	traceID trace.TraceID
+	spanID  trace.SpanID
+}
+
+// withIDs returns a context asking the IDGenerator for the given IDs.
+func withIDs(ctx context.Context, traceID trace.TraceID, spanID trace.SpanID) context.Context {
+	return context.WithValue(ctx, idsKey{}, ids{traceID: traceID, spanID: spanID})
+}
+
+// IDGenerator returns an ID generator for the OpenTelemetry SDK that gives the spans created by a Bridge the IDs of
+// their events, see TraceID and SpanID. Other spans get random IDs.
+//
+//	sdktrace.NewTracerProvider(sdktrace.WithIDGenerator(skylightotel.IDGenerator()))
+//
+// Without it, the spans of a bridge still share the trace of their parent event, but get random span IDs.
+func IDGenerator() sdktrace.IDGenerator {
+	return idGenerator{}
+}
+
+type idGenerator struct{}
+
+func (idGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	if ids, ok := ctx.Value(idsKey{}).(ids); ok {
+		return ids.traceID, ids.spanID
+	}
+	var (
+		traceID trace.TraceID
+		spanID  trace.SpanID
+	)
+	for !traceID.IsValid() {
+		rand.Read(traceID[:])
+	}
+	for !spanID.IsValid() {
+		rand.Read(spanID[:])
+	}
+	return traceID, spanID
+}
+
+func (g idGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	if ids, ok := ctx.Value(idsKey{}).(ids); ok {
+		return ids.spanID
+	}
+	_, spanID := g.NewIDs(ctx)
+	return spanID
+}
@@ -0,0 +1,238 @@
+package skylightotel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/benchatech/skylight"
+	"go.opentelemetry.io/otel/trace"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// LogsSink exports events as OTLP log records over HTTP. It is meant to be run by a skylight.Batcher, which batches
+// the events, and wrapped in a skylight.RetrySink to retry failed exports.
+//
+// Severities map from levels, attributes from fields, with errors as key-value lists of their structured rendering
+// (see skylight.RenderError), and resource attributes from the client resource, see
+// skylight.Client.WithResource. Events carry the trace of their event tree and the span ID of their parent, derived like
+// those of Bridge; events without a parent carry their own span ID.
+type LogsSink struct {
+	url      string
+	client   *http.Client
+	header   http.Header
+	json     bool
+	compress bool
+}
+
+// NewLogsSink creates a sink posting to url, e.g. "http://localhost:4318/v1/logs".
+// By default it uses http.DefaultClient and sends gzipped protobuf.
+func NewLogsSink(url string) *LogsSink {
+	return &LogsSink{
+		url:      url,
+		client:   http.DefaultClient,
+		header:   make(http.Header),
+		compress: true,
+	}
+}
+
+// WithClient sets the HTTP client used to post batches.
+func (s *LogsSink) WithClient(c *http.Client) *LogsSink {
+	if s == nil {
+		return nil
+	}
+	s.client = c
+	return s
+}
+
+// WithHeader adds a header to every request, e.g. for authentication.
+func (s *LogsSink) WithHeader(key, value string) *LogsSink {
+	if s == nil {
+		return nil
+	}
+	s.header.Add(key, value)
+	return s
+}
+
+// WithJSON sends batches with the OTLP JSON encoding instead of protobuf.
+func (s *LogsSink) WithJSON(enabled bool) *LogsSink {
+	if s == nil {
+		return nil
+	}
+	s.json = enabled
+	return s
+}
+
+// WithCompression enables or disables gzip compression of the requests.
+func (s *LogsSink) WithCompression(enabled bool) *LogsSink {
+	if s == nil {
+		return nil
+	}
+	s.compress = enabled
+	return s
+}
+
+func (s *LogsSink) Write(ctx context.Context, events []skylight.EventSnapshot) error {
+	body, contentType, err := s.encode(logsRequest(events))
+	if err != nil {
+		return skylight.Permanent(fmt.Errorf("skylight: otlp logs: %w", err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return skylight.Permanent(fmt.Errorf("skylight: otlp logs: %w", err))
+	}
+	for k, v := range s.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("skylight: otlp logs: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("skylight: otlp logs: %s", resp.Status)
+	// The OTLP specification only lists these statuses as retryable.
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return err
+	default:
+		return skylight.Permanent(err)
+	}
+}
+
+func (s *LogsSink) Flush(ctx context.Context) error { return nil }
+
+func (s *LogsSink) Close(ctx context.Context) error { return nil }
+
+func (s *LogsSink) encode(req *collogspb.ExportLogsServiceRequest) ([]byte, string, error) {
+	var (
+		data        []byte
+		contentType string
+		err         error
+	)
+	if s.json {
+		data, err = marshalJSON(req)
+		contentType = "application/json"
+	} else {
+		data, err = proto.Marshal(req)
+		contentType = "application/x-protobuf"
+	}
+	if err != nil || !s.compress {
+		return data, contentType, err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, "", err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), contentType, nil
+}
+
+// logsRequest groups events by resource, so that each resource is sent once per batch.
+func logsRequest(events []skylight.EventSnapshot) *collogspb.ExportLogsServiceRequest {
+	req := &collogspb.ExportLogsServiceRequest{}
+	scopes := make(map[*skylight.Resource]*logspb.ScopeLogs)
+	for i := range events {
+		s := &events[i]
+		scope, ok := scopes[s.Resource]
+		if !ok {
+			var attrs otlpAttributes
+			s.Resource.VisitFields(&attrs)
+			scope = &logspb.ScopeLogs{Scope: &commonpb.InstrumentationScope{Name: instrumentationName}}
+			req.ResourceLogs = append(req.ResourceLogs, &logspb.ResourceLogs{
+				Resource:  &resourcepb.Resource{Attributes: attrs},
+				ScopeLogs: []*logspb.ScopeLogs{scope},
+			})
+			scopes[s.Resource] = scope
+		}
+		scope.LogRecords = append(scope.LogRecords, logRecord(s))
+	}
+	return req
+}
+
+func logRecord(s *skylight.EventSnapshot) *logspb.LogRecord {
+	attrs := otlpAttributes{}
+	attrs.VisitString("skylight.event_id", s.ID)
+	if s.Topic != "" {
+		attrs.VisitString("skylight.topic", s.Topic)
+	}
+	s.VisitFields(&attrs)
+
+	spanOf := s.ParentID
+	if spanOf == "" {
+		spanOf = s.ID
+	}
+	traceID, _ := trace.TraceIDFromHex(s.TraceID)
+	spanID := SpanID(spanOf)
+
+	return &logspb.LogRecord{
+		TimeUnixNano:         uint64(s.CreatedAt.UnixNano()),
+		ObservedTimeUnixNano: uint64(s.EmittedAt.UnixNano()),
+		SeverityNumber:       logspb.SeverityNumber(severity(s.Level)),
+		SeverityText:         s.Level.String(),
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s.Message}},
+		Attributes:           attrs,
+		TraceId:              traceID[:],
+		SpanId:               spanID[:],
+		Flags:                uint32(trace.FlagsSampled),
+	}
+}
+
+// marshalJSON encodes req with the OTLP JSON encoding, which differs from the canonical protobuf JSON mapping:
+// enums are numbers, and trace and span IDs are hex strings instead of base64.
+func marshalJSON(req *collogspb.ExportLogsServiceRequest) ([]byte, error) {
+	data, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	hexIDs(v)
+	return json.Marshal(v)
+}
+
+func hexIDs(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, x := range v {
+			if s, ok := x.(string); ok && (k == "traceId" || k == "spanId") {
+				if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+					v[k] = hex.EncodeToString(b)
+				}
+				continue
+			}
+			hexIDs(x)
+		}
+	case []any:
+		for _, x := range v {
+			hexIDs(x)
+		}
+	}
+}
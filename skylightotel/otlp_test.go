@@ -0,0 +1,163 @@
+package skylightotel_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/benchatech/skylight"
+	"github.com/benchatech/skylight/skylightotel"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// receiver is a stub OTLP/HTTP logs receiver keeping the last request body.
+type receiver struct {
+	contentType string
+	body        []byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body io.Reader = req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	r.contentType = req.Header.Get("Content-Type")
+	r.body, _ = io.ReadAll(body)
+}
+
+func export(t *testing.T, sink *skylightotel.LogsSink, events []skylight.EventSnapshot) {
+	t.Helper()
+	if err := sink.Write(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func snapshots(emit func(c *skylight.Client)) []skylight.EventSnapshot {
+	var events []skylight.EventSnapshot
+	c := skylight.New(
+		skylight.WithResource(skylight.NewResource().With("service.name", "test")),
+		skylight.WithObserver(skylight.WildcardObserver(func(e *skylight.Event) { events = append(events, e.Snapshot()) })),
+	)
+	emit(c)
+	return events
+}
+
+func TestLogsSinkProtobuf(t *testing.T) {
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	cause := errors.New("connection reset")
+	events := snapshots(func(c *skylight.Client) {
+		req := c.Info("request").Emit(true)
+		req.Error("query failed").WithError(fmt.Errorf("query: %w", cause)).Emit()
+		req.Evict()
+	})
+	export(t, skylightotel.NewLogsSink(srv.URL), events)
+
+	if r.contentType != "application/x-protobuf" {
+		t.Errorf("content type = %q", r.contentType)
+	}
+	var got collogspb.ExportLogsServiceRequest
+	if err := proto.Unmarshal(r.body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(got.ResourceLogs); n != 1 {
+		t.Fatalf("%d resource logs, want 1", n)
+	}
+	rl := got.ResourceLogs[0]
+	if a := rl.Resource.Attributes; len(a) != 1 || a[0].Key != "service.name" || a[0].Value.GetStringValue() != "test" {
+		t.Errorf("resource attributes = %v", a)
+	}
+	records := rl.ScopeLogs[0].LogRecords
+	if len(records) != 2 {
+		t.Fatalf("%d log records, want 2", len(records))
+	}
+	request, query := records[0], records[1]
+	if string(query.TraceId) != string(request.TraceId) || string(query.SpanId) != string(request.SpanId) {
+		t.Error("child record is not in the trace and span of its parent")
+	}
+	if query.SeverityText != "error" || query.Body.GetStringValue() != "query failed" {
+		t.Errorf("record = %s %q", query.SeverityText, query.Body.GetStringValue())
+	}
+
+	var errValue *commonpb.KeyValueList
+	for _, a := range query.Attributes {
+		if a.Key == "error" {
+			errValue = a.Value.GetKvlistValue()
+		}
+	}
+	if errValue == nil {
+		t.Fatal("error attribute is not a key-value list")
+	}
+	members := map[string]*commonpb.AnyValue{}
+	for _, kv := range errValue.Values {
+		members[kv.Key] = kv.Value
+	}
+	if members["message"].GetStringValue() != "query: connection reset" || members["type"].GetStringValue() != "*fmt.wrapError" {
+		t.Errorf("error = %v", errValue)
+	}
+	if c := members["cause"].GetKvlistValue(); c == nil || c.Values[0].Value.GetStringValue() != "connection reset" {
+		t.Errorf("error cause = %v", members["cause"])
+	}
+}
+
+func TestLogsSinkJSON(t *testing.T) {
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	events := snapshots(func(c *skylight.Client) { c.Warn("slow").Emit() })
+	export(t, skylightotel.NewLogsSink(srv.URL).WithJSON(true).WithCompression(false), events)
+
+	var got struct {
+		ResourceLogs []struct {
+			ScopeLogs []struct {
+				LogRecords []struct {
+					SeverityNumber int    `json:"severityNumber"`
+					TraceID        string `json:"traceId"`
+					SpanID         string `json:"spanId"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	if err := json.Unmarshal(r.body, &got); err != nil {
+		t.Fatal(err)
+	}
+	rec := got.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if rec.TraceID != events[0].TraceID || rec.SpanID != skylightotel.SpanID(events[0].ID).String() {
+		t.Errorf("IDs = %s %s, want hex IDs of the event", rec.TraceID, rec.SpanID)
+	}
+	if rec.SeverityNumber != 13 {
+		t.Errorf("severity = %d, want 13 (warn)", rec.SeverityNumber)
+	}
+}
+
+func TestLogsSinkRetryableStatus(t *testing.T) {
+	for status, retryable := range map[int]bool{
+		http.StatusServiceUnavailable: true,
+		http.StatusTooManyRequests:    true,
+		http.StatusBadRequest:         false,
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(status) }))
+		err := skylightotel.NewLogsSink(srv.URL).Write(context.Background(), snapshots(func(c *skylight.Client) { c.Info("event").Emit() }))
+		srv.Close()
+		if err == nil || skylight.IsPermanent(err) == retryable || !strings.Contains(err.Error(), fmt.Sprint(status)) {
+			t.Errorf("status %d: error %v, want retryable %v", status, err, retryable)
+		}
+	}
+}
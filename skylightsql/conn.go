@@ -0,0 +1,183 @@
+package skylightsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+// conn wraps a driver connection. It implements every optional connection interface, and falls back to what
+// database/sql does on its own when the wrapped connection doesn't.
+type conn struct {
+	driver.Conn
+	cfg *config
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	start := time.Now()
+	var (
+		s   driver.Stmt
+		err error
+	)
+	if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		s, err = pc.PrepareContext(ctx, query)
+	} else {
+		s, err = c.Conn.Prepare(query)
+		if err == nil && ctx.Err() != nil {
+			s.Close()
+			s, err = nil, ctx.Err()
+		}
+	}
+	c.cfg.record(ctx, "prepare", query, -1, start, nil, err)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{Stmt: s, conn: c, query: query}, nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	var (
+		t   driver.Tx
+		err error
+	)
+	if bc, ok := c.Conn.(driver.ConnBeginTx); ok {
+		t, err = bc.BeginTx(ctx, opts)
+	} else if opts.Isolation != driver.IsolationLevel(0) || opts.ReadOnly {
+		err = errors.New("skylightsql: driver does not support non-default isolation level or read-only transactions")
+	} else {
+		t, err = c.Conn.Begin()
+	}
+	c.cfg.record(ctx, "begin", "", -1, start, nil, err)
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: t, cfg: c.cfg, ctx: ctx}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var (
+		res driver.Result
+		err error
+	)
+	switch ec := c.Conn.(type) {
+	case driver.ExecerContext:
+		res, err = ec.ExecContext(ctx, query, args)
+	case driver.Execer:
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			res, err = ec.Exec(query, values)
+		}
+	default:
+		err = driver.ErrSkip
+	}
+	// On driver.ErrSkip, database/sql prepares a statement instead, which is recorded on its own.
+	if errors.Is(err, driver.ErrSkip) {
+		return nil, err
+	}
+	c.cfg.record(ctx, "exec", query, len(args), start, res, err)
+	return res, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var (
+		rows driver.Rows
+		err  error
+	)
+	switch qc := c.Conn.(type) {
+	case driver.QueryerContext:
+		rows, err = qc.QueryContext(ctx, query, args)
+	case driver.Queryer:
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			rows, err = qc.Query(query, values)
+		}
+	default:
+		err = driver.ErrSkip
+	}
+	if errors.Is(err, driver.ErrSkip) {
+		return nil, err
+	}
+	c.cfg.record(ctx, "query", query, len(args), start, nil, err)
+	return rows, err
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// CheckNamedValue defers to the connection, and otherwise converts the value with driver.DefaultParameterConverter.
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return convertValue(nv)
+}
+
+// convertValue converts an argument like database/sql does for drivers without a driver.NamedValueChecker, calling
+// its Value method if it is a driver.Valuer.
+func convertValue(nv *driver.NamedValue) (err error) {
+	nv.Value, err = driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	return err
+}
+
+// tx wraps a transaction. Its events are parented like the event of the call that began it.
+type tx struct {
+	driver.Tx
+	cfg *config
+	ctx context.Context
+}
+
+func (t *tx) Commit() error {
+	start := time.Now()
+	err := t.Tx.Commit()
+	t.cfg.record(t.ctx, "commit", "", -1, start, nil, err)
+	return err
+}
+
+func (t *tx) Rollback() error {
+	start := time.Now()
+	err := t.Tx.Rollback()
+	t.cfg.record(t.ctx, "rollback", "", -1, start, nil, err)
+	return err
+}
+
+// namedValues converts arguments for the drivers predating named parameters.
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("skylightsql: driver does not support the use of named parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
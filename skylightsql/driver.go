@@ -0,0 +1,173 @@
+// Package skylightsql wraps database/sql drivers to emit a skylight event for every query, statement and transaction.
+//
+// Register a wrapped driver, or open a database from a wrapped connector:
+//
+//	sql.Register("postgres-skylight", skylightsql.Wrap(pq.Driver{}, skylightsql.WithSlowThreshold(time.Second)))
+//	db := sql.OpenDB(skylightsql.WrapConnector(connector))
+//
+// Events are children of the event carried by the context of the call, see skylight.EventFromContext.
+package skylightsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"time"
+
+	"github.com/benchatech/skylight"
+	"github.com/benchatech/skylight/internal"
+)
+
+var (
+	hooks      = internal.GetHooks[*skylight.Client, *skylight.Event, skylight.Level]()
+	beginEvent = hooks.BeginEvent
+	endEvent   = hooks.EndEvent
+)
+
+// Option configures a wrapped driver.
+type Option func(cfg *config)
+
+type config struct {
+	c      *skylight.Client
+	slow   time.Duration
+	redact func(query string) string
+}
+
+// WithClient emits the events of calls whose context doesn't carry an event as root events of c.
+// By default only the calls made on behalf of an event are recorded.
+func WithClient(c *skylight.Client) Option {
+	return func(cfg *config) {
+		cfg.c = c
+	}
+}
+
+// WithSlowThreshold raises the level of the events of calls lasting at least d from debug to warn.
+// It is disabled by default.
+func WithSlowThreshold(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.slow = d
+	}
+}
+
+// WithRedactor sets the function redacting SQL text before it is recorded. It defaults to Redact; nil records the
+// text as is.
+func WithRedactor(fn func(query string) string) Option {
+	return func(cfg *config) {
+		cfg.redact = fn
+	}
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{redact: Redact}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// record emits the event of a call that started at start, at debug level, or warn for slow calls and error for
+// failed ones. The event is only created once the call returns, so that the calls a driver skips with
+// driver.ErrSkip, and retries differently, aren't recorded twice.
+func (cfg *config) record(ctx context.Context, op, query string, args int, start time.Time, res driver.Result, err error) {
+	d := time.Since(start)
+	e := beginEvent(ctx, cfg.c)
+	if e == nil {
+		return
+	}
+	e.Topic("sql").Message("sql ", op).Str("operation", op)
+	if query != "" {
+		if cfg.redact != nil {
+			query = cfg.redact(query)
+		}
+		e.Str("statement", query)
+	}
+	if args >= 0 {
+		e.Int("args", args)
+	}
+	if res != nil {
+		if n, err := res.RowsAffected(); err == nil {
+			e.Int64("rows_affected", n)
+		}
+	}
+	e.Dur("duration", d)
+
+	level := skylight.LevelDebug
+	switch {
+	case err != nil:
+		level = skylight.LevelError
+		e.Err("error", err)
+	case cfg.slow > 0 && d >= cfg.slow:
+		level = skylight.LevelWarn
+		e.Bool("slow", true)
+	}
+	endEvent(e, level)
+}
+
+// Wrap wraps a driver. If d implements driver.DriverContext, so does the wrapped driver.
+func Wrap(d driver.Driver, opts ...Option) driver.Driver {
+	w := &wrappedDriver{Driver: d, cfg: newConfig(opts)}
+	if _, ok := d.(driver.DriverContext); ok {
+		return &wrappedDriverContext{w}
+	}
+	return w
+}
+
+// WrapConnector wraps a connector, for sql.OpenDB.
+func WrapConnector(c driver.Connector, opts ...Option) driver.Connector {
+	return &connector{Connector: c, cfg: newConfig(opts)}
+}
+
+type wrappedDriver struct {
+	driver.Driver
+	cfg *config
+}
+
+func (d *wrappedDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, cfg: d.cfg}, nil
+}
+
+type wrappedDriverContext struct {
+	*wrappedDriver
+}
+
+func (d *wrappedDriverContext) OpenConnector(name string) (driver.Connector, error) {
+	c, err := d.Driver.(driver.DriverContext).OpenConnector(name)
+	if err != nil {
+		return nil, err
+	}
+	return &connector{Connector: c, cfg: d.cfg, driver: d}, nil
+}
+
+type connector struct {
+	driver.Connector
+	cfg    *config
+	driver driver.Driver
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	dc, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: dc, cfg: c.cfg}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	if c.driver != nil {
+		return c.driver
+	}
+	return &wrappedDriver{Driver: c.Connector.Driver(), cfg: c.cfg}
+}
+
+// Close closes the wrapped connector when it implements io.Closer, which sql.DB.Close relies on to release its
+// resources.
+func (c *connector) Close() error {
+	if cl, ok := c.Connector.(io.Closer); ok {
+		return cl.Close()
+	}
+	return nil
+}
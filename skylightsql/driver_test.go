@@ -0,0 +1,226 @@
+package skylightsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benchatech/skylight"
+)
+
+// fakeDB is an in-memory database recording the arguments of the statements it executes. Its connections and
+// statements only implement the required driver interfaces, and its statements don't know their number of inputs.
+// Preparing FAIL fails, and executing SLEEP takes sleepFor.
+type fakeDB struct {
+	mu   sync.Mutex
+	args [][]driver.Value
+}
+
+func (db *fakeDB) Connect(ctx context.Context) (driver.Conn, error) { return &fakeConn{db: db}, nil }
+func (db *fakeDB) Driver() driver.Driver                            { return nil }
+
+func (db *fakeDB) lastArgs() []driver.Value {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.args[len(db.args)-1]
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if query == "FAIL" {
+		return nil, errors.New("syntax error")
+	}
+	return &fakeStmt{db: c.db, sleep: query == "SLEEP"}, nil
+}
+
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	sleep bool
+}
+
+const sleepFor = 20 * time.Millisecond
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.sleep {
+		time.Sleep(sleepFor)
+	}
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.args = append(s.db.args, args)
+	return driver.RowsAffected(len(args)), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if _, err := s.Exec(args); err != nil {
+		return nil, err
+	}
+	return fakeRows{}, nil
+}
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string              { return []string{"n"} }
+func (fakeRows) Close() error                   { return nil }
+func (fakeRows) Next(dest []driver.Value) error { return io.EOF }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+func newFakeDB(t *testing.T, opts ...Option) (*fakeDB, *sql.DB) {
+	t.Helper()
+	fake := &fakeDB{}
+	db := sql.OpenDB(WrapConnector(fake, opts...))
+	t.Cleanup(func() { db.Close() })
+	return fake, db
+}
+
+func TestValuerArguments(t *testing.T) {
+	fake, db := newFakeDB(t)
+	if _, err := db.Exec("INSERT INTO t VALUES (?, ?, ?)", sql.NullString{String: "x", Valid: true}, sql.NullInt64{}, int32(7)); err != nil {
+		t.Fatal(err)
+	}
+	args := fake.lastArgs()
+	if len(args) != 3 || args[0] != "x" || args[1] != nil || args[2] != int64(7) {
+		t.Errorf("driver received %#v, want converted values", args)
+	}
+
+	// Whether database/sql converts the values a statement checker skips depends on its version: the wrapper doesn't
+	// skip them when the driver has no checker or column converter of its own.
+	c := &conn{Conn: &fakeConn{db: fake}, cfg: newConfig(nil)}
+	for _, checker := range []driver.NamedValueChecker{c, &stmt{Stmt: &fakeStmt{db: fake}, conn: c}} {
+		nv := &driver.NamedValue{Ordinal: 1, Value: sql.NullString{String: "x", Valid: true}}
+		if err := checker.CheckNamedValue(nv); err != nil || nv.Value != "x" {
+			t.Errorf("%T.CheckNamedValue: %#v, %v, want the converted value", checker, nv.Value, err)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []skylight.EventSnapshot
+	)
+	c := skylight.New(skylight.WithLevel(skylight.LevelDebug), skylight.WithObserver(skylight.TopicObserver("sql", func(e *skylight.Event) {
+		mu.Lock()
+		events = append(events, e.Snapshot())
+		mu.Unlock()
+	})))
+	_, db := newFakeDB(t)
+
+	root := c.Info("request").Emit(true)
+	defer root.Evict()
+	ctx := skylight.ContextWithEvent(context.Background(), root)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE t SET name = 'bob' WHERE id = ?", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "FAIL"); err == nil {
+		t.Fatal("no error preparing FAIL")
+	}
+	// Calls without an event in their context, and no client, aren't recorded.
+	if _, err := db.Exec("DELETE FROM t"); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var ops []string
+	for _, e := range events {
+		ops = append(ops, e.Message)
+		if e.ParentID != root.ID() {
+			t.Errorf("%s event has parent %q, want the request %q", e.Message, e.ParentID, root.ID())
+		}
+	}
+	want := []string{"sql begin", "sql prepare", "sql stmt.exec", "sql commit", "sql prepare"}
+	if len(ops) != len(want) {
+		t.Fatalf("events = %v, want %v", ops, want)
+	}
+	for i := range want {
+		if ops[i] != want[i] {
+			t.Fatalf("events = %v, want %v", ops, want)
+		}
+	}
+	exec := events[2]
+	if f, _ := exec.Field("statement"); f.Value() != "UPDATE t SET name = ? WHERE id = ?" {
+		t.Errorf("statement = %v", f.Value())
+	}
+	if f, _ := exec.Field("rows_affected"); f.Value() != int64(1) || exec.Level != skylight.LevelDebug {
+		t.Errorf("exec: %v rows affected at level %v", f.Value(), exec.Level)
+	}
+	if failed := events[4]; failed.Level != skylight.LevelError {
+		t.Errorf("failed prepare at level %v, want error", failed.Level)
+	}
+}
+
+func TestSlowThreshold(t *testing.T) {
+	var events []skylight.EventSnapshot
+	c := skylight.New(skylight.WithLevel(skylight.LevelDebug), skylight.WithObserver(skylight.TopicObserver("sql", func(e *skylight.Event) {
+		events = append(events, e.Snapshot())
+	})))
+	_, db := newFakeDB(t, WithClient(c), WithSlowThreshold(sleepFor/2))
+
+	if _, err := db.Exec("SLEEP"); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("%d events, want prepare and exec", len(events))
+	}
+	prepare, exec := events[0], events[1]
+	if _, slow := prepare.Field("slow"); slow || prepare.Level != skylight.LevelDebug {
+		t.Errorf("fast prepare at level %v, slow %v, want debug", prepare.Level, slow)
+	}
+	if f, _ := exec.Field("slow"); f.Value() != true || exec.Level != skylight.LevelWarn {
+		t.Errorf("slow exec at level %v, slow %v, want warn", exec.Level, f.Value())
+	}
+	if f, _ := exec.Field("duration"); f.Value().(time.Duration) < sleepFor {
+		t.Errorf("slow exec lasted %v, want at least %v", f.Value(), sleepFor)
+	}
+}
+
+// closingDB is a fakeDB whose connector holds resources, released by Close.
+type closingDB struct {
+	*fakeDB
+	closed int
+}
+
+func (db *closingDB) Close() error {
+	db.closed++
+	return nil
+}
+
+func TestConnectorClose(t *testing.T) {
+	fake := &closingDB{fakeDB: &fakeDB{}}
+	db := sql.OpenDB(WrapConnector(fake))
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fake.closed != 1 {
+		t.Errorf("wrapped connector closed %d times, want 1", fake.closed)
+	}
+}
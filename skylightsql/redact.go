@@ -0,0 +1,134 @@
+package skylightsql
+
+import "strings"
+
+// Redact replaces the literals of a SQL query, quoted strings and numbers, with "?", so that recorded statements
+// neither leak values nor blow up cardinality. Strings include the escape strings (E'...') and dollar-quoted strings
+// ($$...$$ or $tag$...$tag$) of PostgreSQL. Placeholders, comments and identifiers quoted with backticks are kept.
+// A string whose end depends on whether backslashes escape quotes, as they do in MySQL, is redacted up to the end
+// of the query.
+//
+// Double-quoted text is redacted as a string, as MySQL reads it by default. Use RedactANSI for dialects where double
+// quotes delimit identifiers.
+func Redact(query string) string {
+	return redact(query, false)
+}
+
+// RedactANSI is Redact for dialects where double quotes delimit identifiers, such as PostgreSQL, SQLite or MySQL
+// in ANSI_QUOTES mode: double-quoted identifiers are kept. Use it with WithRedactor.
+func RedactANSI(query string) string {
+	return redact(query, true)
+}
+
+// redact implements Redact, keeping double-quoted text as an identifier when ansi is set.
+func redact(query string, ansi bool) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' && !ansi:
+			j := skipQuoted(query, i, false)
+			if skipQuoted(query, i, true) != j {
+				// MySQL escapes quotes with backslashes, standard SQL doesn't: rather than guess where the string
+				// ends, and leak the rest of it, redact the rest of the query.
+				j = len(query)
+			}
+			i = j
+			b.WriteByte('?')
+		case (c == 'E' || c == 'e') && i+1 < len(query) && query[i+1] == '\'' && (i == 0 || !isWord(query[i-1])):
+			i = skipQuoted(query, i+1, true)
+			b.WriteByte('?')
+		case c == '$' && (i == 0 || !isWord(query[i-1])) && dollarTag(query[i:]) != "":
+			tag := dollarTag(query[i:])
+			if j := strings.Index(query[i+len(tag):], tag); j >= 0 {
+				i += 2*len(tag) + j
+			} else {
+				i = len(query)
+			}
+			b.WriteByte('?')
+		case c == '"' || c == '`':
+			// Quoted identifiers: double quotes only get here when they are ANSI.
+			j := skipQuoted(query, i, false)
+			b.WriteString(query[i:j])
+			i = j
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				j = len(query) - i
+			}
+			b.WriteString(query[i : i+j])
+			i += j
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i+2:], "*/")
+			if j < 0 {
+				j = len(query) - i
+			} else {
+				j += 4
+			}
+			b.WriteString(query[i : i+j])
+			i += j
+		case isDigit(c) && (i == 0 || !isWord(query[i-1])):
+			j := i
+			for j < len(query) && (isWord(query[j]) || query[j] == '.') {
+				j++
+			}
+			b.WriteByte('?')
+			i = j
+		case isWord(c) || c == '$':
+			// Identifiers and placeholders such as $1 or :name may contain digits.
+			j := i + 1
+			for j < len(query) && isWord(query[j]) {
+				j++
+			}
+			b.WriteString(query[i:j])
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// skipQuoted returns the index following the quoted text starting at i, where a doubled quote is an escaped quote,
+// and so is a quote following a backslash when backslash escapes are enabled.
+func skipQuoted(s string, i int, backslash bool) int {
+	q := s[i]
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if backslash {
+				i++
+			}
+		case q:
+			if i+1 < len(s) && s[i+1] == q {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// dollarTag returns the opening delimiter of the dollar-quoted string s starts with, such as "$$" or "$body$",
+// or "" when s doesn't start with one, e.g. when it starts with a placeholder such as $1.
+func dollarTag(s string) string {
+	j := 1
+	for j < len(s) && isWord(s[j]) && !(j == 1 && isDigit(s[j])) {
+		j++
+	}
+	if j < len(s) && s[j] == '$' {
+		return s[:j+1]
+	}
+	return ""
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWord(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c >= 0x80
+}
@@ -0,0 +1,49 @@
+package skylightsql
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{`SELECT * FROM users WHERE id = 42 AND name = 'bob'`, `SELECT * FROM users WHERE id = ? AND name = ?`},
+		{"SELECT `col1`, t2.col FROM t2 WHERE a = $1 -- 'comment'", "SELECT `col1`, t2.col FROM t2 WHERE a = $1 -- 'comment'"},
+		// Double quotes delimit strings in MySQL's default mode.
+		{`SELECT * FROM users WHERE password = "hunter2"`, `SELECT * FROM users WHERE password = ?`},
+		{`SELECT "it\" secret", "x" FROM t`, `SELECT ?`},
+		{`SELECT 'a"b', "c'd"`, `SELECT ?, ?`},
+		{`SELECT 'it''s', 'x'`, `SELECT ?, ?`},
+		// Backslashes may escape quotes, as in MySQL, or not: when it matters, the rest of the query is redacted.
+		{`SELECT * FROM t WHERE a = 'it\'s secret' AND b = 'hunter2'`, `SELECT * FROM t WHERE a = ?`},
+		{`SELECT 'C:\' , 'secret'`, `SELECT ?`},
+		{`SELECT 'C:\\', 'D:\\' FROM t`, `SELECT ?, ? FROM t`},
+		{`SELECT 'a\nb', 1`, `SELECT ?, ?`},
+		{`SELECT E'it\'s', 'secret'`, `SELECT ?, ?`},
+		{`SELECT e'a\\', 1`, `SELECT ?, ?`},
+		{`SELECT $$it's a secret$$, 2`, `SELECT ?, ?`},
+		{`SELECT $body$ $$secret$$ $body$ FROM t`, `SELECT ? FROM t`},
+		{`SELECT $tag$unterminated secret`, `SELECT ?`},
+		{`INSERT INTO t VALUES ($1, $2)`, `INSERT INTO t VALUES ($1, $2)`},
+		{`SELECT price$1 FROM t`, `SELECT price$1 FROM t`},
+	}
+	for _, tt := range tests {
+		if got := Redact(tt.query); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestRedactANSI(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{`SELECT "col1", t2.col FROM t2 WHERE a = $1 -- 'comment'`, `SELECT "col1", t2.col FROM t2 WHERE a = $1 -- 'comment'`},
+		{`SELECT "a""b" FROM "t" WHERE name = 'bob' AND id = 7`, `SELECT "a""b" FROM "t" WHERE name = ? AND id = ?`},
+		{`SELECT 'it\'s', 'secret'`, `SELECT ?`},
+	}
+	for _, tt := range tests {
+		if got := RedactANSI(tt.query); got != tt.want {
+			t.Errorf("RedactANSI(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package skylightsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// stmt wraps a prepared statement, whose executions are recorded with the statement text.
+type stmt struct {
+	driver.Stmt
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	start := time.Now()
+	res, err := s.Stmt.Exec(args)
+	s.conn.cfg.record(context.Background(), "stmt.exec", s.query, len(args), start, res, err)
+	return res, err
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.Stmt.Query(args)
+	s.conn.cfg.record(context.Background(), "stmt.query", s.query, len(args), start, nil, err)
+	return rows, err
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var (
+		res driver.Result
+		err error
+	)
+	if sc, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = sc.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			res, err = s.Stmt.Exec(values)
+		}
+	}
+	s.conn.cfg.record(ctx, "stmt.exec", s.query, len(args), start, res, err)
+	return res, err
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var (
+		rows driver.Rows
+		err  error
+	)
+	if sc, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = sc.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			rows, err = s.Stmt.Query(values)
+		}
+	}
+	s.conn.cfg.record(ctx, "stmt.query", s.query, len(args), start, nil, err)
+	return rows, err
+}
+
+// CheckNamedValue defers to the statement, then to its connection: database/sql only asks the connection when the
+// statement doesn't implement driver.NamedValueChecker. When neither checks the value, it is converted like
+// database/sql does: by the column converter of the statement, or else by driver.DefaultParameterConverter, which
+// database/sql would otherwise skip for the statements of unknown input count.
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	err := driver.ErrSkip
+	if nc, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		err = nc.CheckNamedValue(nv)
+	} else if nc, ok := s.conn.Conn.(driver.NamedValueChecker); ok {
+		err = nc.CheckNamedValue(nv)
+	}
+	if err != driver.ErrSkip {
+		return err
+	}
+	if _, ok := s.Stmt.(driver.ColumnConverter); ok {
+		return driver.ErrSkip
+	}
+	return convertValue(nv)
+}
+
+func (s *stmt) ColumnConverter(idx int) driver.ValueConverter {
+	if cc, ok := s.Stmt.(driver.ColumnConverter); ok {
+		return cc.ColumnConverter(idx)
+	}
+	return driver.DefaultParameterConverter
+}
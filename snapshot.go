@@ -0,0 +1,155 @@
+package skylight
+
+import (
+	"reflect"
+	"slices"
+	"time"
+)
+
+// EventSnapshot is an immutable copy of an emitted event, safe to keep after the event has been recycled.
+type EventSnapshot struct {
+	ID       string
+	ParentID string
+	// TraceID is the W3C trace ID of the event tree, see Event.TraceID.
+	TraceID   string
+	CreatedAt time.Time
+	EmittedAt time.Time
+	Level     Level
+	Topic     string
+	Message   string
+	Fields    []Field
+	// Caller is the frame the event was emitted from, when caller capture is enabled for its level.
+	Caller *Frame
+	// Stack is the call stack the event was emitted from, when stack capture is enabled for its level.
+	Stack []Frame
+	// Resource describes the process that emitted the event. It is shared by the snapshots of a client and must not be modified.
+	Resource *Resource
+}
+
+// Snapshot returns an immutable copy of the event. The maps and slices of Any values are copied, since they belong to
+// the caller while the snapshot may be read by another goroutine, such as the one of a Batcher. Values behind
+// pointers are not.
+func (e *Event) Snapshot() EventSnapshot {
+	if !e.live() {
+		return EventSnapshot{}
+	}
+	e.resolve()
+	s := EventSnapshot{
+		ID:        e.ID(),
+		ParentID:  e.parentID,
+		TraceID:   e.TraceID(),
+		CreatedAt: e.createdAt,
+		EmittedAt: e.emittedAt,
+		Level:     e.level,
+		Topic:     e.topic,
+		Message:   e.message.text,
+		Fields:    slices.Clone(e.fields),
+		Stack:     slices.Clone(e.Stack()),
+		Resource:  e.c.resource,
+	}
+	for i, f := range s.Fields {
+		if f.Kind == KindAny {
+			s.Fields[i].obj = snapshotValue(f.obj)
+		}
+	}
+	if f, ok := e.Caller(); ok {
+		s.Caller = &f
+	}
+	return s
+}
+
+// Field returns the field with the given key.
+func (s *EventSnapshot) Field(key string) (Field, bool) {
+	for _, f := range s.Fields {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// VisitFields passes every field of the snapshot to v, in the order they were added.
+func (s *EventSnapshot) VisitFields(v FieldVisitor) {
+	for _, f := range s.Fields {
+		f.Visit(v)
+	}
+}
+
+// size estimates the encoded size of the snapshot in bytes, for batching.
+func (s *EventSnapshot) size() int {
+	n := 64 + len(s.ID) + len(s.ParentID) + len(s.Topic) + len(s.Message)
+	for _, f := range s.Fields {
+		n += len(f.Key) + 8 + len(f.str)
+	}
+	for _, f := range s.Stack {
+		n += len(f.Function) + len(f.File) + 8
+	}
+	return n
+}
+
+// snapshotValue returns v with its maps, slices and arrays copied, so that a snapshot doesn't share them with the
+// caller. Containers nested deeper than maxFieldsDepth are dropped, in case v contains itself.
+func snapshotValue(v any) any {
+	switch v.(type) {
+	case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return copyValue(rv, 0).Interface()
+	default:
+		return v
+	}
+}
+
+func copyValue(v reflect.Value, depth int) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		return copyValue(v.Elem(), depth)
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		if depth >= maxFieldsDepth {
+			return reflect.Zero(v.Type())
+		}
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for it := v.MapRange(); it.Next(); {
+			m.SetMapIndex(it.Key(), copyValue(it.Value(), depth+1))
+		}
+		return m
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		if depth >= maxFieldsDepth {
+			return reflect.Zero(v.Type())
+		}
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		copyElems(s, v, depth)
+		return s
+	case reflect.Array:
+		a := reflect.New(v.Type()).Elem()
+		copyElems(a, v, depth)
+		return a
+	default:
+		return v
+	}
+}
+
+// copyElems copies the elements of the slice or array src to dst.
+func copyElems(dst, src reflect.Value, depth int) {
+	switch src.Type().Elem().Kind() {
+	case reflect.Interface, reflect.Map, reflect.Slice, reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			if c := copyValue(src.Index(i), depth+1); c.IsValid() {
+				dst.Index(i).Set(c)
+			}
+		}
+	default:
+		reflect.Copy(dst, src)
+	}
+}
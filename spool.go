@@ -0,0 +1,239 @@
+package skylight
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DropPolicy decides which batches a full spool discards.
+type DropPolicy int
+
+const (
+	// DropOldest removes the oldest spooled batches to make room for new ones.
+	DropOldest DropPolicy = iota
+
+	// DropNewest discards new batches while the spool is full.
+	DropNewest
+)
+
+// ErrSpoolFull is returned when a batch is discarded because the spool is full.
+var ErrSpoolFull = errors.New("skylight: spool full")
+
+const spoolExt = ".batch"
+
+// Spool is a directory of batches waiting to be written to a sink, oldest first, in the binary format of BinaryEncoder.
+// Each batch is written to its own file before Append returns, so spooled events survive process restarts.
+type Spool struct {
+	dir      string
+	maxBytes int64
+	policy   DropPolicy
+
+	mu      sync.Mutex
+	seq     uint64
+	files   []spoolFile
+	size    int64
+	dropped atomic.Uint64
+}
+
+type spoolFile struct {
+	seq  uint64
+	size int64
+	n    int
+}
+
+// OpenSpool opens the spool in dir, creating the directory if needed and picking up batches left by a previous process.
+// By default the spool holds up to 64 MiB and drops the oldest batches when full.
+func OpenSpool(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("skylight: open spool: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("skylight: open spool: %w", err)
+	}
+
+	s := &Spool{
+		dir:      dir,
+		maxBytes: 64 << 20,
+		policy:   DropOldest,
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, spoolExt+".tmp") {
+			// Interrupted while writing: the batch was never acknowledged as spooled.
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolExt), 10, 64)
+		if err != nil || !strings.HasSuffix(name, spoolExt) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		s.files = append(s.files, spoolFile{seq: seq, size: info.Size(), n: -1})
+		s.size += info.Size()
+		s.seq = max(s.seq, seq)
+	}
+	slices.SortFunc(s.files, func(a, b spoolFile) int {
+		switch {
+		case a.seq < b.seq:
+			return -1
+		case a.seq > b.seq:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return s, nil
+}
+
+// WithMaxBytes sets the maximum size of the spool on disk.
+func (s *Spool) WithMaxBytes(n int64) *Spool {
+	if s == nil {
+		return nil
+	}
+	s.maxBytes = n
+	return s
+}
+
+// WithDropPolicy sets which batches are discarded when the spool is full.
+func (s *Spool) WithDropPolicy(p DropPolicy) *Spool {
+	if s == nil {
+		return nil
+	}
+	s.policy = p
+	return s
+}
+
+// Len returns the number of spooled batches.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.files)
+}
+
+// Size returns the size of the spool on disk in bytes.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Dropped returns the number of events discarded because the spool was full, a spooled batch was unreadable, or the
+// sink rejected a replayed batch with a permanent error.
+func (s *Spool) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Append writes a batch to the spool.
+func (s *Spool) Append(events []EventSnapshot) error {
+	data, err := encodeBinaryBatch(events)
+	if err != nil {
+		return fmt.Errorf("skylight: spool: %w", err)
+	}
+	size := int64(len(data))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size+size > s.maxBytes {
+		if s.policy == DropNewest || size > s.maxBytes {
+			s.dropped.Add(uint64(len(events)))
+			return ErrSpoolFull
+		}
+		for len(s.files) > 0 && s.size+size > s.maxBytes {
+			s.dropLocked(s.files[0])
+		}
+	}
+
+	seq := s.seq + 1
+	path := s.path(seq)
+	if err := writeFileSync(path+".tmp", data); err != nil {
+		return fmt.Errorf("skylight: spool: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("skylight: spool: %w", err)
+	}
+	s.seq = seq
+	s.files = append(s.files, spoolFile{seq: seq, size: size, n: len(events)})
+	s.size += size
+	return nil
+}
+
+// peek returns the oldest spooled batch. Unreadable batches are discarded.
+func (s *Spool) peek() ([]EventSnapshot, uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.files) > 0 {
+		f := s.files[0]
+		data, err := os.ReadFile(s.path(f.seq))
+		if err == nil {
+			events, err := decodeBinaryBatch(data)
+			if err == nil {
+				return events, f.seq, true
+			}
+		}
+		s.dropLocked(f)
+	}
+	return nil, 0, false
+}
+
+// remove deletes a batch once it has been written to the sink.
+func (s *Spool) remove(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.files, func(f spoolFile) bool { return f.seq == seq })
+	if i < 0 {
+		return
+	}
+	os.Remove(s.path(seq))
+	s.size -= s.files[i].size
+	s.files = slices.Delete(s.files, i, i+1)
+}
+
+func (s *Spool) dropLocked(f spoolFile) {
+	if f.n > 0 {
+		s.dropped.Add(uint64(f.n))
+	} else if f.n < 0 {
+		// Batches left by a previous process: count their events before discarding them.
+		if data, err := os.ReadFile(s.path(f.seq)); err == nil {
+			if events, err := decodeBinaryBatch(data); err == nil {
+				s.dropped.Add(uint64(len(events)))
+			}
+		}
+	}
+	os.Remove(s.path(f.seq))
+	s.size -= f.size
+	s.files = slices.DeleteFunc(s.files, func(g spoolFile) bool { return g.seq == f.seq })
+}
+
+func (s *Spool) path(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolExt))
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
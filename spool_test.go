@@ -0,0 +1,161 @@
+package skylight
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// spoolBatch returns a batch of n events whose IDs start with name.
+func spoolBatch(name string, n int) []EventSnapshot {
+	events := make([]EventSnapshot, n)
+	for i := range events {
+		events[i] = EventSnapshot{ID: fmt.Sprintf("%s-%d", name, i), Message: "spooled"}
+	}
+	return events
+}
+
+// batchSize returns the size of the spool file of events.
+func batchSize(t *testing.T, events []EventSnapshot) int64 {
+	t.Helper()
+	data, err := encodeBinaryBatch(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int64(len(data))
+}
+
+// nextBatch returns the ID of the first event of the oldest spooled batch, and removes the batch.
+func nextBatch(t *testing.T, s *Spool) string {
+	t.Helper()
+	events, seq, ok := s.peek()
+	if !ok {
+		return ""
+	}
+	s.remove(seq)
+	return events[0].ID
+}
+
+func openSpool(t *testing.T, dir string) *Spool {
+	t.Helper()
+	s, err := OpenSpool(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSpoolDropPolicies(t *testing.T) {
+	size := batchSize(t, spoolBatch("a", 2))
+	tests := []struct {
+		policy  DropPolicy
+		err     error
+		batches []string
+	}{
+		{DropOldest, nil, []string{"b-0", "c-0"}},
+		{DropNewest, ErrSpoolFull, []string{"a-0", "b-0"}},
+	}
+	for _, tt := range tests {
+		s := openSpool(t, t.TempDir()).WithMaxBytes(2 * size).WithDropPolicy(tt.policy)
+		for _, name := range []string{"a", "b"} {
+			if err := s.Append(spoolBatch(name, 2)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Append(spoolBatch("c", 2)); !errors.Is(err, tt.err) {
+			t.Errorf("policy %d: appending to a full spool: %v, want %v", tt.policy, err, tt.err)
+		}
+		if s.Len() != 2 || s.Size() != 2*size || s.Dropped() != 2 {
+			t.Errorf("policy %d: %d batches of %d bytes, %d dropped, want 2, %d and 2", tt.policy, s.Len(), s.Size(), s.Dropped(), 2*size)
+		}
+		for _, want := range tt.batches {
+			if got := nextBatch(t, s); got != want {
+				t.Errorf("policy %d: spooled batch %q, want %q", tt.policy, got, want)
+			}
+		}
+		if s.Len() != 0 || s.Size() != 0 {
+			t.Errorf("policy %d: %d batches of %d bytes left", tt.policy, s.Len(), s.Size())
+		}
+	}
+}
+
+func TestSpoolMaxBytes(t *testing.T) {
+	small := spoolBatch("small", 1)
+	s := openSpool(t, t.TempDir()).WithMaxBytes(batchSize(t, small))
+	if err := s.Append(small); err != nil {
+		t.Fatal(err)
+	}
+	// A batch larger than the whole spool is refused, even when older batches could be dropped.
+	if err := s.Append(spoolBatch("large", 10)); !errors.Is(err, ErrSpoolFull) {
+		t.Errorf("appending a batch larger than the spool: %v, want ErrSpoolFull", err)
+	}
+	if s.Len() != 1 || s.Dropped() != 10 {
+		t.Errorf("%d batches, %d dropped, want the small batch kept and 10 dropped", s.Len(), s.Dropped())
+	}
+}
+
+func TestSpoolSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	s := openSpool(t, dir)
+	for _, name := range []string{"a", "b"} {
+		if err := s.Append(spoolBatch(name, 3)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := s.Size()
+
+	// A batch being written when the process died, and a file the spool doesn't own.
+	tmp := filepath.Join(dir, fmt.Sprintf("%020d%s.tmp", 3, spoolExt))
+	other := filepath.Join(dir, "README")
+	for _, path := range []string{tmp, other} {
+		if err := os.WriteFile(path, []byte("partial"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s = openSpool(t, dir)
+	if s.Len() != 2 || s.Size() != size {
+		t.Fatalf("reopened spool has %d batches of %d bytes, want 2 of %d", s.Len(), s.Size(), size)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("interrupted batch left in the spool: %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("unrelated file removed: %v", err)
+	}
+
+	// New batches go after the leftover ones, and dropping a leftover batch counts its events.
+	s.WithMaxBytes(size)
+	if err := s.Append(spoolBatch("c", 3)); err != nil {
+		t.Fatal(err)
+	}
+	if s.Dropped() != 3 {
+		t.Errorf("dropped %d events of the leftover batch, want 3", s.Dropped())
+	}
+	for _, want := range []string{"b-0", "c-0", ""} {
+		if got := nextBatch(t, s); got != want {
+			t.Errorf("spooled batch %q, want %q", got, want)
+		}
+	}
+}
+
+func TestSpoolDropsUnreadableBatches(t *testing.T) {
+	dir := t.TempDir()
+	s := openSpool(t, dir)
+	for _, name := range []string{"a", "b"} {
+		if err := s.Append(spoolBatch(name, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(s.path(1), []byte("SKYB\x01garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextBatch(t, s); got != "b-0" {
+		t.Errorf("spooled batch %q, want the readable one", got)
+	}
+	if s.Dropped() != 1 || s.Len() != 0 {
+		t.Errorf("%d batches, %d dropped, want the corrupt batch dropped", s.Len(), s.Dropped())
+	}
+}
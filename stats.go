@@ -0,0 +1,363 @@
+package skylight
+
+import (
+	"expvar"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxStatsTopics bounds the number of topics counted separately. Further topics are counted together, see Stats.OtherTopics.
+const maxStatsTopics = 1000
+
+// Stats is a point in time view of the events going through a client.
+type Stats struct {
+	Observers []ObserverStats `json:"observers"`
+	// Levels counts the emitted events per level.
+	Levels map[string]uint64 `json:"levels"`
+	// Topics counts the emitted events per topic.
+	Topics map[string]uint64 `json:"topics"`
+	// OtherTopics counts the emitted events whose topic isn't in Topics, because too many topics were seen.
+	OtherTopics uint64 `json:"other_topics"`
+	// Held is the number of events emitted with Emit(true) that haven't been evicted yet.
+	Held int64 `json:"held"`
+}
+
+// ObserverStats is a point in time view of an observer.
+type ObserverStats struct {
+	// ID is the ID of the observer, see Observer.WithID, or "observer-N" for the Nth observer of the client without
+	// one. IDs are unique within Stats: an ID already taken by an earlier observer gets a "-2", "-3"... suffix.
+	ID string `json:"id"`
+	// Matched counts the events matching the observer condition.
+	Matched uint64 `json:"matched"`
+	// Handled counts the events handled without panicking.
+	Handled uint64 `json:"handled"`
+	// Dropped counts the events dropped by the observer, e.g. when a Batcher queue is full.
+	Dropped uint64 `json:"dropped"`
+	// Panics counts the handler panics, which propagate to the caller of Emit.
+	Panics uint64 `json:"panics"`
+	// Errors counts the errors reported by the observer, e.g. failed sink writes.
+	Errors uint64 `json:"errors"`
+	// QueueDepth is the number of events waiting to be handled, for observers that queue them.
+	QueueDepth int `json:"queue_depth"`
+	// Handler latency percentiles, estimated with exponential buckets.
+	LatencyP50 time.Duration `json:"latency_p50"`
+	LatencyP90 time.Duration `json:"latency_p90"`
+	LatencyP99 time.Duration `json:"latency_p99"`
+	// LatencySum is the total time spent in the handler, over LatencyCount calls.
+	LatencySum   time.Duration `json:"latency_sum"`
+	LatencyCount uint64        `json:"latency_count"`
+	// Breaker is the state of the circuit breaker of the observer sink, if any.
+	Breaker *BreakerStats `json:"breaker,omitempty"`
+}
+
+// observerStats holds the counters of an observer.
+type observerStats struct {
+	matched atomic.Uint64
+	handled atomic.Uint64
+	panics  atomic.Uint64
+	latency latencyHistogram
+}
+
+// clientStats holds the counters of a client.
+type clientStats struct {
+	levels [LevelPanic + 1]atomic.Uint64
+	topics sync.Map
+	ntopic atomic.Int64
+	other  atomic.Uint64
+	held   atomic.Int64
+}
+
+func (s *clientStats) count(e *Event) {
+	if e.level >= 0 && int(e.level) < len(s.levels) {
+		s.levels[e.level].Add(1)
+	}
+
+	if n := s.topic(e.topic); n != nil {
+		n.Add(1)
+	} else {
+		s.other.Add(1)
+	}
+}
+
+// topic returns the counter of a topic, or nil when maxStatsTopics topics are already counted.
+func (s *clientStats) topic(topic string) *atomic.Uint64 {
+	if n, ok := s.topics.Load(topic); ok {
+		return n.(*atomic.Uint64)
+	}
+	// Reserve a slot before storing the topic, so that concurrent new topics can't exceed the limit.
+	for {
+		k := s.ntopic.Load()
+		if k >= maxStatsTopics {
+			// The topic may have taken the last slot in the meantime.
+			if n, ok := s.topics.Load(topic); ok {
+				return n.(*atomic.Uint64)
+			}
+			return nil
+		}
+		if s.ntopic.CompareAndSwap(k, k+1) {
+			break
+		}
+	}
+	n, loaded := s.topics.LoadOrStore(topic, new(atomic.Uint64))
+	if loaded {
+		s.ntopic.Add(-1)
+	}
+	return n.(*atomic.Uint64)
+}
+
+// latencyHistogram counts durations in buckets of powers of two nanoseconds, and sums them.
+type latencyHistogram struct {
+	buckets [64]atomic.Uint64
+	count   atomic.Uint64
+	sum     atomic.Int64
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	if d < 1 {
+		d = 1
+	}
+	h.buckets[bits.Len64(uint64(d))-1].Add(1)
+	h.sum.Add(int64(d))
+	h.count.Add(1)
+}
+
+// percentiles returns the upper bound of the buckets holding each percentile.
+func (h *latencyHistogram) percentiles(ps ...float64) []time.Duration {
+	var (
+		counts [64]uint64
+		total  uint64
+	)
+	for i := range h.buckets {
+		counts[i] = h.buckets[i].Load()
+		total += counts[i]
+	}
+
+	out := make([]time.Duration, len(ps))
+	if total == 0 {
+		return out
+	}
+	for i, p := range ps {
+		rank := uint64(p * float64(total))
+		var seen uint64
+		for b, n := range counts {
+			seen += n
+			if seen > rank || seen == total {
+				out[i] = time.Duration(uint64(1)<<(b+1) - 1)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// dispatch hands e, which matches the observer condition, to the observer, counting handler panics without
+// recovering them.
+func (o *Observer) dispatch(e *Event) {
+	o.stats.matched.Add(1)
+	e.resolve()
+
+	start := time.Now()
+	panicked := true
+	defer func() {
+		o.stats.latency.observe(time.Since(start))
+		if panicked {
+			o.stats.panics.Add(1)
+		} else {
+			o.stats.handled.Add(1)
+		}
+	}()
+	o.handler(e)
+	panicked = false
+}
+
+// dispatchEvict hands an evicted held event to the observer, counting handler panics without recovering them.
+func (o *Observer) dispatchEvict(e *Event) {
+	if o.evict == nil || !o.cond(e) {
+		return
+	}
+	panicked := true
+	defer func() {
+		if panicked {
+			o.stats.panics.Add(1)
+		}
+	}()
+	o.evict(e)
+	panicked = false
+}
+
+func (o *Observer) snapshot(i int) ObserverStats {
+	s := ObserverStats{
+		ID:      o.id,
+		Matched: o.stats.matched.Load(),
+		Handled: o.stats.handled.Load(),
+		Panics:  o.stats.panics.Load(),
+	}
+	if s.ID == "" {
+		s.ID = fmt.Sprintf("observer-%d", i)
+	}
+	p := o.stats.latency.percentiles(0.5, 0.9, 0.99)
+	s.LatencyP50, s.LatencyP90, s.LatencyP99 = p[0], p[1], p[2]
+	s.LatencySum = time.Duration(o.stats.latency.sum.Load())
+	s.LatencyCount = o.stats.latency.count.Load()
+	if o.extraStats != nil {
+		o.extraStats(&s)
+	}
+	return s
+}
+
+// Stats returns the statistics of the client and its observers.
+func (c *Client) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+	s := Stats{
+		Levels:      make(map[string]uint64),
+		Topics:      make(map[string]uint64),
+		Held:        c.stats.held.Load(),
+		OtherTopics: c.stats.other.Load(),
+	}
+	for i, o := range c.observers {
+		s.Observers = append(s.Observers, o.snapshot(i))
+	}
+	uniqueIDs(s.Observers)
+	for l := range c.stats.levels {
+		if n := c.stats.levels[l].Load(); n > 0 {
+			s.Levels[Level(l).String()] = n
+		}
+	}
+	c.stats.topics.Range(func(k, v any) bool {
+		s.Topics[k.(string)] = v.(*atomic.Uint64).Load()
+		return true
+	})
+	return s
+}
+
+// uniqueIDs suffixes the observer IDs taken by an earlier observer, so that each observer has its own metric series.
+func uniqueIDs(observers []ObserverStats) {
+	taken := make(map[string]bool, len(observers))
+	for _, o := range observers {
+		taken[o.ID] = true
+	}
+	seen := make(map[string]bool, len(observers))
+	for i := range observers {
+		id := observers[i].ID
+		if seen[id] {
+			n := 2
+			for taken[fmt.Sprintf("%s-%d", id, n)] {
+				n++
+			}
+			observers[i].ID = fmt.Sprintf("%s-%d", id, n)
+			taken[observers[i].ID] = true
+		}
+		seen[observers[i].ID] = true
+	}
+}
+
+// PublishExpvar publishes the client statistics as an expvar variable. Like expvar.Publish, it panics if name is already in use.
+func (c *Client) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return c.Stats() }))
+}
+
+// MetricsHandler returns an HTTP handler serving the client statistics in the Prometheus text exposition format.
+func (c *Client) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, c.Stats())
+	})
+}
+
+func writeMetrics(w http.ResponseWriter, s Stats) {
+	var b strings.Builder
+
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	metric("skylight_events_total", "counter", "Events emitted, by level.")
+	for _, level := range sortedKeys(s.Levels) {
+		fmt.Fprintf(&b, "skylight_events_total{level=%s} %d\n", label(level), s.Levels[level])
+	}
+
+	metric("skylight_topic_events_total", "counter", "Events emitted, by topic.")
+	for _, topic := range sortedKeys(s.Topics) {
+		fmt.Fprintf(&b, "skylight_topic_events_total{topic=%s} %d\n", label(topic), s.Topics[topic])
+	}
+
+	metric("skylight_other_topic_events_total", "counter", "Events emitted with a topic not counted separately.")
+	fmt.Fprintf(&b, "skylight_other_topic_events_total %d\n", s.OtherTopics)
+
+	metric("skylight_events_held", "gauge", "Events emitted with hold that haven't been evicted.")
+	fmt.Fprintf(&b, "skylight_events_held %d\n", s.Held)
+
+	counters := []struct {
+		name, help string
+		value      func(o ObserverStats) uint64
+	}{
+		{"skylight_observer_matched_total", "Events matching the observer condition.", func(o ObserverStats) uint64 { return o.Matched }},
+		{"skylight_observer_handled_total", "Events handled by the observer.", func(o ObserverStats) uint64 { return o.Handled }},
+		{"skylight_observer_dropped_total", "Events dropped by the observer.", func(o ObserverStats) uint64 { return o.Dropped }},
+		{"skylight_observer_panics_total", "Observer handler panics.", func(o ObserverStats) uint64 { return o.Panics }},
+		{"skylight_observer_errors_total", "Errors reported by the observer.", func(o ObserverStats) uint64 { return o.Errors }},
+	}
+	for _, c := range counters {
+		metric(c.name, "counter", c.help)
+		for _, o := range s.Observers {
+			fmt.Fprintf(&b, "%s{observer=%s} %d\n", c.name, label(o.ID), c.value(o))
+		}
+	}
+
+	metric("skylight_observer_queue_depth", "gauge", "Events waiting to be handled by the observer.")
+	for _, o := range s.Observers {
+		fmt.Fprintf(&b, "skylight_observer_queue_depth{observer=%s} %d\n", label(o.ID), o.QueueDepth)
+	}
+
+	metric("skylight_observer_latency_seconds", "summary", "Observer handler latency.")
+	for _, o := range s.Observers {
+		for _, q := range []struct {
+			quantile string
+			d        time.Duration
+		}{{"0.5", o.LatencyP50}, {"0.9", o.LatencyP90}, {"0.99", o.LatencyP99}} {
+			fmt.Fprintf(&b, "skylight_observer_latency_seconds{observer=%s,quantile=%s} %g\n", label(o.ID), label(q.quantile), q.d.Seconds())
+		}
+		fmt.Fprintf(&b, "skylight_observer_latency_seconds_sum{observer=%s} %g\n", label(o.ID), o.LatencySum.Seconds())
+		fmt.Fprintf(&b, "skylight_observer_latency_seconds_count{observer=%s} %d\n", label(o.ID), o.LatencyCount)
+	}
+
+	metric("skylight_observer_breaker_state", "gauge", "State of the circuit breaker of the observer sink: 1 for the current state, 0 for the others.")
+	for _, o := range s.Observers {
+		if o.Breaker == nil {
+			continue
+		}
+		for _, state := range []BreakerState{BreakerClosed, BreakerOpen, BreakerHalfOpen} {
+			v := 0
+			if o.Breaker.State == state {
+				v = 1
+			}
+			fmt.Fprintf(&b, "skylight_observer_breaker_state{observer=%s,state=%s} %d\n", label(o.ID), label(state.String()), v)
+		}
+	}
+
+	w.Write([]byte(b.String()))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// label quotes a Prometheus label value.
+func label(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,190 @@
+package skylight
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestObserverPanicPropagates(t *testing.T) {
+	c := New(WithObserver(WildcardObserver(func(e *Event) { panic("observer failed") })))
+
+	func() {
+		defer func() {
+			if r := recover(); r != "observer failed" {
+				t.Errorf("recovered %v, want the observer panic", r)
+			}
+		}()
+		c.Info("event").Emit()
+	}()
+
+	if s := c.Stats().Observers[0]; s.Panics != 1 || s.Handled != 0 {
+		t.Errorf("panics = %d, handled = %d, want 1 and 0", s.Panics, s.Handled)
+	}
+}
+
+func TestStatsOtherTopics(t *testing.T) {
+	c := New()
+	for i := 0; i < maxStatsTopics; i++ {
+		c.Info("event").Topic(strconv.Itoa(i)).Emit()
+	}
+	c.Info("event").Topic("other").Emit()
+	c.Info("event").Topic("0").Emit()
+
+	s := c.Stats()
+	if s.OtherTopics != 1 || s.Topics["other"] != 0 || s.Topics["0"] != 2 {
+		t.Errorf("other topics = %d, topics[other] = %d, topics[0] = %d, want 1, 0 and 2", s.OtherTopics, s.Topics["other"], s.Topics["0"])
+	}
+}
+
+func TestStatsTopicLimitConcurrent(t *testing.T) {
+	c := New()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < maxStatsTopics; i++ {
+				c.Info("event").Topic(strconv.Itoa(g*maxStatsTopics + i)).Emit()
+			}
+		}()
+	}
+	wg.Wait()
+
+	s := c.Stats()
+	var counted uint64
+	for _, n := range s.Topics {
+		counted += n
+	}
+	if len(s.Topics) != maxStatsTopics || counted+s.OtherTopics != 8*maxStatsTopics {
+		t.Errorf("%d topics counting %d events and %d others, want %d topics and %d events", len(s.Topics), counted, s.OtherTopics, maxStatsTopics, 8*maxStatsTopics)
+	}
+}
+
+func TestStatsHeld(t *testing.T) {
+	c := New()
+	a := c.Info("a").Emit(true)
+	b := c.Info("b").Emit(true)
+	c.Info("c").Emit()
+	if held := c.Stats().Held; held != 2 {
+		t.Errorf("held = %d, want 2", held)
+	}
+	a.Evict()
+	b.Evict()
+	if held := c.Stats().Held; held != 0 {
+		t.Errorf("held = %d after Evict, want 0", held)
+	}
+}
+
+func TestLatencyPercentiles(t *testing.T) {
+	var h latencyHistogram
+	if p := h.percentiles(0.5); p[0] != 0 {
+		t.Errorf("percentile of no latency = %v, want 0", p[0])
+	}
+	// 90 fast calls in the bucket [512ns, 1024ns), 9 in [1ms, 2ms) and 1 in [1s, 2s).
+	for i := 0; i < 90; i++ {
+		h.observe(600 * time.Nanosecond)
+	}
+	for i := 0; i < 9; i++ {
+		h.observe(1500 * time.Microsecond)
+	}
+	h.observe(1500 * time.Millisecond)
+
+	p := h.percentiles(0.5, 0.9, 0.99, 1)
+	want := []time.Duration{1<<10 - 1, 1<<21 - 1, 1<<31 - 1, 1<<31 - 1}
+	for i := range want {
+		if p[i] != want[i] {
+			t.Errorf("percentiles = %v, want %v", p, want)
+			break
+		}
+	}
+	if sum := 90*600*time.Nanosecond + 9*1500*time.Microsecond + 1500*time.Millisecond; time.Duration(h.sum.Load()) != sum || h.count.Load() != 100 {
+		t.Errorf("sum = %v over %d calls, want %v over 100", time.Duration(h.sum.Load()), h.count.Load(), sum)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	sink := &switchSink{}
+	b := NewBatcher(NewBreakerSink(sink))
+	c := New(WithObserver(WildcardObserver(func(e *Event) {}).WithID(`say "hi"`)), WithObserver(b.Observer().WithID("batcher")))
+	defer c.Close()
+	c.Info("event").Topic("http").Emit()
+	c.Warn("event").Emit()
+	held := c.Info("held").Emit(true)
+	defer held.Evict()
+
+	rec := httptest.NewRecorder()
+	c.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type %q", ct)
+	}
+	out := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE skylight_events_total counter\n",
+		`skylight_events_total{level="info"} 2` + "\n",
+		`skylight_events_total{level="warn"} 1` + "\n",
+		`skylight_topic_events_total{topic="http"} 1` + "\n",
+		`skylight_topic_events_total{topic=""} 2` + "\n",
+		"skylight_other_topic_events_total 0\n",
+		"# TYPE skylight_events_held gauge\nskylight_events_held 1\n",
+		`skylight_observer_matched_total{observer="say \"hi\""} 3` + "\n",
+		`skylight_observer_handled_total{observer="batcher"} 3` + "\n",
+		"# TYPE skylight_observer_latency_seconds summary\n",
+		`skylight_observer_latency_seconds{observer="batcher",quantile="0.99"} `,
+		`skylight_observer_latency_seconds_count{observer="batcher"} 3` + "\n",
+		`skylight_observer_latency_seconds_sum{observer="batcher"} `,
+		`skylight_observer_breaker_state{observer="batcher",state="closed"} 1` + "\n",
+		`skylight_observer_breaker_state{observer="batcher",state="open"} 0` + "\n",
+		`skylight_observer_breaker_state{observer="batcher",state="half-open"} 0` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics don't contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `skylight_observer_breaker_state{observer="say`) {
+		t.Errorf("breaker state of an observer without a breaker:\n%s", out)
+	}
+}
+
+func TestObserverStatsUniqueIDs(t *testing.T) {
+	noop := func(e *Event) {}
+	c := New(
+		WithObserver(WildcardObserver(noop).WithID("a")),
+		WithObserver(WildcardObserver(noop).WithID("a")),
+		WithObserver(WildcardObserver(noop).WithID("a-2")),
+		WithObserver(WildcardObserver(noop).WithID("observer-4")),
+		WithObserver(WildcardObserver(noop)),
+	)
+	var ids []string
+	for _, o := range c.Stats().Observers {
+		ids = append(ids, o.ID)
+	}
+	if got := fmt.Sprint(ids); got != "[a a-3 a-2 observer-4 observer-4-2]" {
+		t.Errorf("observer IDs = %s, want unique IDs", got)
+	}
+}
+
+// expvars numbers the expvar names of the tests, which can only be published once per process.
+var expvars atomic.Int32
+
+func TestPublishExpvar(t *testing.T) {
+	c := New()
+	name := fmt.Sprintf("skylight-test-%d", expvars.Add(1))
+	c.PublishExpvar(name)
+	c.Error("event").Topic("db").Emit()
+
+	var s Stats
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Levels["error"] != 1 || s.Topics["db"] != 1 {
+		t.Errorf("published %+v, want the error event", s)
+	}
+}
@@ -0,0 +1,286 @@
+package skylight
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Transport is an http.RoundTripper emitting an event for every outgoing request, with the "http.client" topic.
+// The event is a child of the event in the request context, see EventFromContext, and carries the method, host,
+// path template, status, retries and duration of the request. Its identity is injected in the request headers,
+// so that the events of the called service join the event tree.
+type Transport struct {
+	base        http.RoundTripper
+	c           *Client
+	propagator  Propagator
+	path        func(r *http.Request) string
+	headers     []string
+	redactedHdr map[string]bool
+	redactedQry map[string]bool
+	attempts    int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+}
+
+// NewTransport wraps base, or http.DefaultTransport if base is nil.
+// By default requests are tried once, propagated with DefaultPropagator, and only the events of requests whose
+// context carries an event are emitted.
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		base:       base,
+		propagator: DefaultPropagator(),
+		path:       func(r *http.Request) string { return PathTemplate(r.URL.Path) },
+		redactedHdr: map[string]bool{
+			"Authorization":       true,
+			"Proxy-Authorization": true,
+			"Cookie":              true,
+			"Set-Cookie":          true,
+		},
+		redactedQry: map[string]bool{
+			"access_token": true,
+			"api_key":      true,
+			"key":          true,
+			"password":     true,
+			"secret":       true,
+			"sig":          true,
+			"signature":    true,
+			"token":        true,
+		},
+		attempts:   1,
+		minBackoff: 100 * time.Millisecond,
+		maxBackoff: 2 * time.Second,
+	}
+}
+
+// WithClient emits the events of requests whose context doesn't carry an event as root events of c.
+func (t *Transport) WithClient(c *Client) *Transport {
+	if t == nil {
+		return nil
+	}
+	t.c = c
+	return t
+}
+
+// WithPropagator sets the propagator injecting the event identity in request headers. nil disables propagation.
+func (t *Transport) WithPropagator(p Propagator) *Transport {
+	if t == nil {
+		return nil
+	}
+	t.propagator = p
+	return t
+}
+
+// WithPathTemplate sets the function naming the path of a request. It defaults to PathTemplate of the URL path.
+func (t *Transport) WithPathTemplate(fn func(r *http.Request) string) *Transport {
+	if t == nil {
+		return nil
+	}
+	t.path = fn
+	return t
+}
+
+// WithHeaders records the given request headers under "header.<name>" keys. Redacted headers are recorded as "REDACTED".
+func (t *Transport) WithHeaders(names ...string) *Transport {
+	if t == nil {
+		return nil
+	}
+	for _, name := range names {
+		t.headers = append(t.headers, http.CanonicalHeaderKey(name))
+	}
+	return t
+}
+
+// WithRedactedHeaders adds headers whose values are never recorded. Authorization, Proxy-Authorization, Cookie and
+// Set-Cookie are redacted by default.
+func (t *Transport) WithRedactedHeaders(names ...string) *Transport {
+	if t == nil {
+		return nil
+	}
+	for _, name := range names {
+		t.redactedHdr[http.CanonicalHeaderKey(name)] = true
+	}
+	return t
+}
+
+// WithRedactedQuery adds query parameters whose values are replaced by "REDACTED" in the recorded URL.
+// Common credential parameters, such as token, key or signature, are redacted by default; "*" redacts every parameter.
+func (t *Transport) WithRedactedQuery(params ...string) *Transport {
+	if t == nil {
+		return nil
+	}
+	for _, p := range params {
+		t.redactedQry[strings.ToLower(p)] = true
+	}
+	return t
+}
+
+// WithRetries retries idempotent requests up to n times, with jittered exponential backoff, when they fail with a
+// network error or a 502, 503 or 504 status. Requests whose body can't be replayed are never retried.
+func (t *Transport) WithRetries(n int) *Transport {
+	if t == nil {
+		return nil
+	}
+	t.attempts = max(n, 0) + 1
+	return t
+}
+
+// WithBackoff sets the wait before the first retry and the maximum wait between retries.
+func (t *Transport) WithBackoff(initial, limit time.Duration) *Transport {
+	if t == nil {
+		return nil
+	}
+	t.minBackoff, t.maxBackoff = initial, limit
+	return t
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := begin(req.Context(), t.c)
+	if e == nil {
+		// Requests without an event are still retried. Retries replace the request body, so they need a copy of req.
+		if t.attempts > 1 {
+			req = req.Clone(req.Context())
+		}
+		resp, _, err := t.roundTrip(req)
+		return resp, err
+	}
+
+	path := t.path(req)
+	e.Topic("http.client").
+		Messagef("%s %s%s", req.Method, req.URL.Host, path).
+		Str("method", req.Method).
+		Str("host", req.URL.Host).
+		Str("path", path).
+		Str("url", t.redactURL(req.URL))
+	for _, name := range t.headers {
+		if v := req.Header.Get(name); v != "" {
+			if t.redactedHdr[name] {
+				v = "REDACTED"
+			}
+			e.Str("header."+strings.ToLower(name), v)
+		}
+	}
+
+	// A RoundTripper must not modify the request it was given.
+	req = req.Clone(req.Context())
+	if t.propagator != nil {
+		t.propagator.Inject(e, HeaderCarrier(req.Header))
+	}
+
+	start := time.Now()
+	resp, retries, err := t.roundTrip(req)
+	e.Int("retries", retries).Dur("duration", time.Since(start))
+
+	level := LevelError
+	if err == nil {
+		e.Int("status", resp.StatusCode)
+		level = statusLevel(resp.StatusCode)
+	} else {
+		e.Err("error", err)
+	}
+	e.end(level)
+	return resp, err
+}
+
+func (t *Transport) roundTrip(req *http.Request) (*http.Response, int, error) {
+	retryable := t.attempts > 1 && isIdempotent(req) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, attempt - 1, err
+			}
+			req.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		if !retryable || attempt+1 >= t.attempts || !shouldRetry(resp, err) {
+			return resp, attempt, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(jitteredBackoff(attempt+1, t.minBackoff, t.maxBackoff))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, attempt, errors.Join(err, req.Context().Err())
+		case <-timer.C:
+		}
+	}
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// redactURL renders u without user info, with the values of redacted query parameters replaced.
+func (t *Transport) redactURL(u *url.URL) string {
+	r := *u
+	r.User = nil
+	if r.RawQuery != "" {
+		q := r.Query()
+		for k, vs := range q {
+			if t.redactedQry["*"] || t.redactedQry[strings.ToLower(k)] {
+				for i := range vs {
+					vs[i] = "REDACTED"
+				}
+			}
+		}
+		r.RawQuery = q.Encode()
+	}
+	return r.String()
+}
+
+// PathTemplate replaces the path segments that look like identifiers, such as numbers, UUIDs or long hex strings,
+// with "{id}", so that paths can be grouped without blowing up cardinality.
+func PathTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if isIdentifier(s) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	digits := true
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+		case c >= 'a' && c <= 'f', c >= 'A' && c <= 'F', c == '-':
+			digits = false
+		default:
+			return false
+		}
+	}
+	return digits || len(s) >= 16
+}
@@ -0,0 +1,162 @@
+package skylight
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransportRetries(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	events := make(chan EventSnapshot, 1)
+	c := New(WithObserver(snapshotObserver(events)))
+	client := &http.Client{Transport: NewTransport(nil).WithClient(c).WithRetries(3).WithBackoff(time.Millisecond, time.Millisecond)}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || hits.Load() != 3 {
+		t.Errorf("status %d after %d attempts, want 200 after 3", resp.StatusCode, hits.Load())
+	}
+	e := receive(t, events)
+	if f, _ := e.Field("retries"); f.Value() != int64(2) {
+		t.Errorf("retries = %v, want 2", f.Value())
+	}
+	if e.Level != LevelInfo {
+		t.Errorf("level = %v, want info", e.Level)
+	}
+
+	// Requests that aren't idempotent are tried once.
+	hits.Store(0)
+	resp, err = client.Post(srv.URL, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || hits.Load() != 1 {
+		t.Errorf("POST: status %d after %d attempts, want 503 after 1", resp.StatusCode, hits.Load())
+	}
+	if e := receive(t, events); e.Level != LevelError {
+		t.Errorf("POST: level = %v, want error", e.Level)
+	}
+}
+
+func TestTransportRetriesWithoutEvent(t *testing.T) {
+	var (
+		hits   atomic.Int32
+		bodies []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if hits.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	// Neither a client nor an event in the request context: no event is emitted, but retries still apply.
+	client := &http.Client{Transport: NewTransport(nil).WithRetries(3).WithBackoff(time.Millisecond, time.Millisecond)}
+	req, err := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := req.Body
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || hits.Load() != 3 {
+		t.Errorf("status %d after %d attempts, want 200 after 3", resp.StatusCode, hits.Load())
+	}
+	if strings.Join(bodies, ",") != "body,body,body" {
+		t.Errorf("bodies = %q, want the body replayed", bodies)
+	}
+	if req.Body != body {
+		t.Error("request given to the transport modified")
+	}
+}
+
+func TestTransportRedacts(t *testing.T) {
+	var authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	events := make(chan EventSnapshot, 1)
+	c := New(WithObserver(snapshotObserver(events)))
+	client := &http.Client{Transport: NewTransport(nil).WithClient(c).WithHeaders("Authorization", "X-Tenant").WithRedactedQuery("session")}
+
+	req, _ := http.NewRequest(http.MethodGet, strings.Replace(srv.URL, "://", "://user:pass@", 1)+"/items/42?token=abc&session=def&page=2", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Tenant", "acme")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if authorization != "Bearer secret" {
+		t.Errorf("server received Authorization %q", authorization)
+	}
+
+	e := receive(t, events)
+	want := map[string]any{
+		"url":                  srv.URL + "/items/42?page=2&session=REDACTED&token=REDACTED",
+		"path":                 "/items/{id}",
+		"header.authorization": "REDACTED",
+		"header.x-tenant":      "acme",
+	}
+	for key, v := range want {
+		if f, _ := e.Field(key); f.Value() != v {
+			t.Errorf("%s = %v, want %v", key, f.Value(), v)
+		}
+	}
+}
+
+func TestTransportPropagates(t *testing.T) {
+	events := make(chan EventSnapshot, 2)
+	c := New(WithObserver(snapshotObserver(events)))
+	srv := httptest.NewServer(Middleware(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer srv.Close()
+
+	root := c.Info("root").Emit(true)
+	defer root.Evict()
+	receive(t, events)
+	req, _ := http.NewRequestWithContext(ContextWithEvent(context.Background(), root), http.MethodGet, srv.URL, nil)
+	resp, err := (&http.Client{Transport: NewTransport(nil)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	byTopic := map[string]EventSnapshot{}
+	for i := 0; i < 2; i++ {
+		e := receive(t, events)
+		byTopic[e.Topic] = e
+	}
+	client, server := byTopic["http.client"], byTopic["http.request"]
+	if client.ParentID != root.ID() || client.TraceID != root.TraceID() {
+		t.Errorf("client event has parent %q in trace %q, want the root %q in trace %q",
+			client.ParentID, client.TraceID, root.ID(), root.TraceID())
+	}
+	if server.ParentID != client.ID || server.TraceID != client.TraceID {
+		t.Errorf("server event has parent %q in trace %q, want the client event %q in trace %q",
+			server.ParentID, server.TraceID, client.ID, client.TraceID)
+	}
+}
@@ -0,0 +1,484 @@
+package skylight
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// SchemaVersion is the version of the JSON representation of events, used by EventSnapshot.MarshalJSON and the sinks.
+// Decoders reject data with a newer version, and treat data without one as version 1.
+//
+// An event is a JSON object with these members, in this order:
+//
+//	schema      version of the schema, only set on standalone events: batches carry it once
+//	id          event ID
+//	parent_id   ID of the parent event, omitted for root events
+//	trace_id    W3C trace ID of the event tree, 32 lowercase hex digits, omitted when unknown
+//	created_at  creation time, RFC 3339 with nanoseconds and the UTC offset of the producer
+//	emitted_at  emission time, in the same format
+//	level       level name, see Level.String
+//	topic       topic, omitted when empty
+//	message     message
+//	fields      array of fields, omitted when empty
+//	caller      frame the event was emitted from: an object with function, package, file and line members
+//	stack       array of frames the event was emitted from
+//	resource    array of fields describing the emitting process, omitted when it is the resource of the batch
+//
+// A field is an object with key, type and value members. The type keeps the field kind, so that values round-trip:
+//
+//	string    JSON string
+//	int64     JSON number
+//	float64   JSON number, or one of the strings "NaN", "+Inf" and "-Inf"
+//	bool      JSON boolean
+//	duration  JSON number of nanoseconds
+//	time      JSON string, RFC 3339 with nanoseconds
+//	error     object as rendered by RenderError: message, type, and the optional stack, cause and errors members
+//	fields    array of fields, for values of type Fields, decoded as Fields of typed values
+//	truncated JSON number of the fields of a Fields value nested too deep to be encoded, see below
+//	any       any JSON value, as encoded by encoding/json, or the %+v string of values it can't encode
+//
+// Only the kinds above round-trip. Values of type any are decoded as encoding/json decodes into an interface: maps,
+// slices and other containers become map[string]any and []any, numbers become float64, and values of other types,
+// including structs and maps nested in them, lose their type. Only values of type Fields keep it.
+//
+// Unknown types decode as any. Fields values are nested at most 32 levels deep: a deeper value, e.g. one that contains
+// itself, is encoded as a truncated field, which decodes as a marker printing how many fields were lost. Deeper data is
+// rejected. A batch is an object with schema, resource and events members, where resource is the array of fields
+// shared by its events.
+const SchemaVersion = 1
+
+// wireEvent is the JSON representation of an event snapshot.
+type wireEvent struct {
+	Schema    int         `json:"schema,omitempty"`
+	ID        string      `json:"id"`
+	ParentID  string      `json:"parent_id,omitempty"`
+	TraceID   string      `json:"trace_id,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	EmittedAt time.Time   `json:"emitted_at"`
+	Level     string      `json:"level"`
+	Topic     string      `json:"topic,omitempty"`
+	Message   string      `json:"message"`
+	Fields    []wireField `json:"fields,omitempty"`
+	Caller    *Frame      `json:"caller,omitempty"`
+	Stack     []Frame     `json:"stack,omitempty"`
+	// Resource is only set when it differs from the resource of the batch.
+	Resource []wireField `json:"resource,omitempty"`
+}
+
+// wireBatch is the JSON representation of a batch. The resource of the first event is sent once for the batch.
+type wireBatch struct {
+	Schema   int         `json:"schema"`
+	Resource []wireField `json:"resource,omitempty"`
+	Events   []wireEvent `json:"events"`
+}
+
+// wireField is the JSON representation of a field. Type keeps the field kind, so that values round-trip.
+type wireField struct {
+	Key   string          `json:"key"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+var kindNames = [...]string{
+	KindAny:      "any",
+	KindString:   "string",
+	KindInt64:    "int64",
+	KindFloat64:  "float64",
+	KindBool:     "bool",
+	KindDuration: "duration",
+	KindTime:     "time",
+	KindError:    "error",
+}
+
+// fieldsType is the wire type of nested fields, values of type Fields stored as KindAny.
+const fieldsType = "fields"
+
+// truncatedType is the wire type of nested fields too deep to be encoded.
+const truncatedType = "truncated"
+
+// truncatedFields is the value of a field decoded from a truncated field: the number of fields it had.
+type truncatedFields int
+
+func (n truncatedFields) String() string {
+	return fmt.Sprintf("<%d fields truncated>", int(n))
+}
+
+func (k FieldKind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "any"
+}
+
+func parseFieldKind(s string) FieldKind {
+	for k, name := range kindNames {
+		if name == s {
+			return FieldKind(k)
+		}
+	}
+	return KindAny
+}
+
+func toWire(s *EventSnapshot) wireEvent {
+	w := wireEvent{
+		ID:        s.ID,
+		ParentID:  s.ParentID,
+		TraceID:   s.TraceID,
+		CreatedAt: s.CreatedAt,
+		EmittedAt: s.EmittedAt,
+		Level:     s.Level.String(),
+		Topic:     s.Topic,
+		Message:   s.Message,
+		Caller:    s.Caller,
+		Stack:     s.Stack,
+	}
+	w.Fields = toWireFields(s.Fields, 0)
+	return w
+}
+
+func toWireFields(fields []Field, depth int) []wireField {
+	if len(fields) == 0 {
+		return nil
+	}
+	w := make([]wireField, len(fields))
+	for i, f := range fields {
+		w[i] = toWireField(f, depth)
+	}
+	return w
+}
+
+func toWireField(f Field, depth int) wireField {
+	if f.Kind != KindAny {
+		return wireField{Key: f.Key, Type: f.Kind.String(), Value: encodeFieldValue(f)}
+	}
+	switch v := f.obj.(type) {
+	case truncatedFields:
+		return truncatedField(f.Key, int(v))
+	case Fields:
+		if depth >= maxFieldsDepth && len(v) > 0 {
+			return truncatedField(f.Key, len(v))
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		fields := make([]Field, len(keys))
+		for i, k := range keys {
+			fields[i] = anyField(k, v[k])
+		}
+		b, err := json.Marshal(toWireFields(fields, depth+1))
+		if err != nil || len(fields) == 0 {
+			b = []byte("[]")
+		}
+		return wireField{Key: f.Key, Type: fieldsType, Value: b}
+	default:
+		return wireField{Key: f.Key, Type: f.Kind.String(), Value: encodeFieldValue(f)}
+	}
+}
+
+func truncatedField(key string, n int) wireField {
+	return wireField{Key: key, Type: truncatedType, Value: json.RawMessage(fmt.Sprint(n))}
+}
+
+func fromWireFields(w []wireField, depth int) ([]Field, error) {
+	if len(w) == 0 {
+		return nil, nil
+	}
+	fields := make([]Field, len(w))
+	for i, wf := range w {
+		f, err := decodeField(wf, depth)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = f
+	}
+	return fields, nil
+}
+
+func fromWire(w *wireEvent) (EventSnapshot, error) {
+	if err := checkSchema(w.Schema); err != nil {
+		return EventSnapshot{}, err
+	}
+	level, err := ParseLevel(w.Level)
+	if err != nil {
+		return EventSnapshot{}, err
+	}
+	s := EventSnapshot{
+		ID:        w.ID,
+		ParentID:  w.ParentID,
+		TraceID:   w.TraceID,
+		CreatedAt: w.CreatedAt,
+		EmittedAt: w.EmittedAt,
+		Level:     level,
+		Topic:     w.Topic,
+		Message:   w.Message,
+		Caller:    w.Caller,
+		Stack:     w.Stack,
+	}
+	if s.Fields, err = fromWireFields(w.Fields, 0); err != nil {
+		return EventSnapshot{}, err
+	}
+	if len(w.Resource) > 0 {
+		fields, err := fromWireFields(w.Resource, 0)
+		if err != nil {
+			return EventSnapshot{}, err
+		}
+		s.Resource = &Resource{fields: fields}
+	}
+	return s, nil
+}
+
+func encodeFieldValue(f Field) json.RawMessage {
+	var (
+		b   []byte
+		err error
+	)
+	switch f.Kind {
+	case KindFloat64:
+		// NaN and infinities are not valid JSON numbers.
+		if v := math.Float64frombits(uint64(f.num)); math.IsNaN(v) || math.IsInf(v, 0) {
+			b, err = json.Marshal(fmt.Sprint(v))
+		} else {
+			b, err = json.Marshal(v)
+		}
+	case KindDuration:
+		b, err = json.Marshal(f.num)
+	case KindTime:
+		b, err = json.Marshal(f.time().Format(time.RFC3339Nano))
+	case KindError:
+		e, _ := f.obj.(error)
+		b, err = json.Marshal(RenderError(e))
+	case KindAny:
+		b, err = json.Marshal(f.obj)
+		if err != nil {
+			b, err = json.Marshal(fmt.Sprintf("%+v", f.obj))
+		}
+	default:
+		b, err = json.Marshal(f.Value())
+	}
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	return b
+}
+
+func checkSchema(version int) error {
+	if version > SchemaVersion {
+		return fmt.Errorf("skylight: unsupported schema version %d", version)
+	}
+	return nil
+}
+
+func decodeField(wf wireField, depth int) (Field, error) {
+	if wf.Type == truncatedType {
+		var n int
+		if err := json.Unmarshal(wf.Value, &n); err != nil {
+			return Field{}, fmt.Errorf("skylight: decode field %q: %w", wf.Key, err)
+		}
+		return Field{Key: wf.Key, Kind: KindAny, obj: truncatedFields(n)}, nil
+	}
+	if wf.Type == fieldsType {
+		var w []wireField
+		if err := json.Unmarshal(wf.Value, &w); err != nil {
+			return Field{}, fmt.Errorf("skylight: decode field %q: %w", wf.Key, err)
+		}
+		if len(w) > 0 && depth >= maxFieldsDepth {
+			return Field{}, fmt.Errorf("skylight: decode field %q: fields too deep", wf.Key)
+		}
+		fields, err := fromWireFields(w, depth+1)
+		if err != nil {
+			return Field{}, err
+		}
+		nested := make(Fields, len(fields))
+		for _, f := range fields {
+			nested[f.Key] = f.Value()
+		}
+		return Field{Key: wf.Key, Kind: KindAny, obj: nested}, nil
+	}
+
+	var err error
+	f := Field{Key: wf.Key, Kind: parseFieldKind(wf.Type)}
+	switch f.Kind {
+	case KindString:
+		err = json.Unmarshal(wf.Value, &f.str)
+	case KindInt64, KindDuration:
+		err = json.Unmarshal(wf.Value, &f.num)
+	case KindFloat64:
+		var v float64
+		if err = json.Unmarshal(wf.Value, &v); err != nil {
+			var s string
+			if json.Unmarshal(wf.Value, &s) == nil {
+				v, err = parseSpecialFloat(s)
+			}
+		}
+		f = float64Field(f.Key, v)
+	case KindBool:
+		var v bool
+		err = json.Unmarshal(wf.Value, &v)
+		f = boolField(f.Key, v)
+	case KindTime:
+		var v time.Time
+		err = json.Unmarshal(wf.Value, &v)
+		f = timeField(f.Key, v)
+	case KindError:
+		var info *ErrorInfo
+		err = json.Unmarshal(wf.Value, &info)
+		if info != nil {
+			f.obj = &decodedError{info: *info}
+		}
+	default:
+		err = json.Unmarshal(wf.Value, &f.obj)
+	}
+	if err != nil {
+		return Field{}, fmt.Errorf("skylight: decode field %q: %w", wf.Key, err)
+	}
+	return f, nil
+}
+
+func parseSpecialFloat(s string) (float64, error) {
+	switch s {
+	case "NaN":
+		return math.NaN(), nil
+	case "+Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	default:
+		return 0, fmt.Errorf("invalid float %q", s)
+	}
+}
+
+// decodedError is an error restored from its structured rendering.
+type decodedError struct {
+	info ErrorInfo
+}
+
+func (e *decodedError) Error() string { return e.info.Message }
+
+func (e *decodedError) StackTrace() []Frame { return e.info.Stack }
+
+func (e *decodedError) Unwrap() []error {
+	var errs []error
+	if e.info.Cause != nil {
+		errs = append(errs, &decodedError{info: *e.info.Cause})
+	}
+	for _, info := range e.info.Errors {
+		errs = append(errs, &decodedError{info: info})
+	}
+	return errs
+}
+
+func encodeBatch(events []EventSnapshot) ([]byte, error) {
+	var resource *Resource
+	if len(events) > 0 {
+		resource = events[0].Resource
+	}
+	batch := wireBatch{
+		Schema:   SchemaVersion,
+		Resource: toWireFields(resource.Fields(), 0),
+		Events:   make([]wireEvent, len(events)),
+	}
+	for i := range events {
+		batch.Events[i] = toWire(&events[i])
+		if r := events[i].Resource; r != resource {
+			batch.Events[i].Resource = toWireFields(r.Fields(), 0)
+		}
+	}
+	return json.Marshal(batch)
+}
+
+func decodeBatch(data []byte) ([]EventSnapshot, error) {
+	var batch wireBatch
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, err
+	}
+	if err := checkSchema(batch.Schema); err != nil {
+		return nil, err
+	}
+
+	resourceFields, err := fromWireFields(batch.Resource, 0)
+	if err != nil {
+		return nil, err
+	}
+	var resource *Resource
+	if len(resourceFields) > 0 {
+		resource = &Resource{fields: resourceFields}
+	}
+
+	events := make([]EventSnapshot, len(batch.Events))
+	for i := range batch.Events {
+		s, err := fromWire(&batch.Events[i])
+		if err != nil {
+			return nil, err
+		}
+		if s.Resource == nil {
+			s.Resource = resource
+		}
+		events[i] = s
+	}
+	return events, nil
+}
+
+// MarshalJSON encodes the snapshot as a standalone event of the current SchemaVersion, including its resource.
+func (s EventSnapshot) MarshalJSON() ([]byte, error) {
+	w := toWire(&s)
+	w.Schema = SchemaVersion
+	w.Resource = toWireFields(s.Resource.Fields(), 0)
+	return json.Marshal(w)
+}
+
+// UnmarshalJSON decodes an event encoded by MarshalJSON, or by a sink. Decoded errors keep their message, type and
+// stack, and their wrapped errors, but are not of their original type.
+func (s *EventSnapshot) UnmarshalJSON(data []byte) error {
+	var w wireEvent
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	decoded, err := fromWire(&w)
+	if err != nil {
+		return err
+	}
+	*s = decoded
+	return nil
+}
+
+// MarshalJSON encodes the event like its snapshot, see EventSnapshot.MarshalJSON. Lazy values are evaluated.
+func (e *Event) MarshalJSON() ([]byte, error) {
+	if !e.live() {
+		return nil, errors.New("skylight: marshal of an emitted or evicted event")
+	}
+	return e.Snapshot().MarshalJSON()
+}
+
+// UnmarshalJSON replaces the identity, creation time, level, topic, message and fields of a live event with the decoded
+// ones, e.g. to emit events received from another process through the local observers. The ID and creation time are
+// kept when the data has none. The caller, stack and resource are not restored, and the event still belongs to the
+// client it was created with.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	if !e.live() {
+		return errors.New("skylight: unmarshal into an emitted or evicted event")
+	}
+	var s EventSnapshot
+	if err := s.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	if s.ID != "" {
+		e.id = s.ID
+	}
+	if !s.CreatedAt.IsZero() {
+		e.createdAt = s.CreatedAt
+	}
+	e.parentID = s.ParentID
+	e.traceID = s.TraceID
+	e.level = s.Level
+	e.topic = s.Topic
+	e.message = lazyMessage{text: s.Message}
+	e.lazyFields = false
+	e.fields = append(e.fields[:0], s.Fields...)
+	return nil
+}
@@ -0,0 +1,349 @@
+package skylight
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// everyKind returns fields of every kind, with the values they decode to.
+func everyKind() ([]Field, map[string]any) {
+	at := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.FixedZone("CEST", 2*3600))
+	err := fmt.Errorf("query: %w", errors.Join(errors.New("first"), errors.New("second")))
+	fields := []Field{
+		stringField("string", "value"),
+		int64Field("int64", -42),
+		float64Field("float64", 1.5),
+		float64Field("nan", math.NaN()),
+		float64Field("inf", math.Inf(1)),
+		float64Field("-inf", math.Inf(-1)),
+		boolField("bool", true),
+		durationField("duration", 1500*time.Millisecond),
+		timeField("time", at),
+		anyField("error", err),
+		anyField("any", []any{"a", 1.0}),
+		anyField("nil", nil),
+		anyField("fields", Fields{"user": "bob", "nested": Fields{"id": int64(7)}}),
+	}
+	values := map[string]any{
+		"string":   "value",
+		"int64":    int64(-42),
+		"float64":  1.5,
+		"inf":      math.Inf(1),
+		"-inf":     math.Inf(-1),
+		"bool":     true,
+		"duration": 1500 * time.Millisecond,
+		"time":     at,
+		"any":      []any{"a", 1.0},
+		"nil":      nil,
+		"fields":   Fields{"user": "bob", "nested": Fields{"id": int64(7)}},
+	}
+	return fields, values
+}
+
+// checkFields compares decoded fields with the values of everyKind.
+func checkFields(t *testing.T, decoded []Field) {
+	t.Helper()
+	fields, values := everyKind()
+	if len(decoded) != len(fields) {
+		t.Fatalf("decoded %d fields, want %d", len(decoded), len(fields))
+	}
+	for i, f := range decoded {
+		if f.Key != fields[i].Key || f.Kind != fields[i].Kind {
+			t.Errorf("field %d = %s of kind %v, want %s of kind %v", i, f.Key, f.Kind, fields[i].Key, fields[i].Kind)
+			continue
+		}
+		switch f.Key {
+		case "nan":
+			if v, _ := f.Value().(float64); !math.IsNaN(v) {
+				t.Errorf("nan = %v", f.Value())
+			}
+		case "time":
+			if v, _ := f.Value().(time.Time); !v.Equal(values["time"].(time.Time)) {
+				t.Errorf("time = %v, want %v", f.Value(), values["time"])
+			}
+		case "error":
+			info := RenderError(f.Value().(error))
+			if info.Message != "query: first\nsecond" || info.Type != "*fmt.wrapError" || len(info.Cause.Errors) != 2 {
+				t.Errorf("error = %+v, want the rendering of the original error", info)
+			}
+		default:
+			if !reflect.DeepEqual(f.Value(), values[f.Key]) {
+				t.Errorf("%s = %#v, want %#v", f.Key, f.Value(), values[f.Key])
+			}
+		}
+	}
+}
+
+func TestSnapshotJSONRoundTrip(t *testing.T) {
+	fields, _ := everyKind()
+	s := EventSnapshot{
+		ID:        "child",
+		ParentID:  "root",
+		TraceID:   "4bf92f3577b34da6a3ce929d0e0e4736",
+		CreatedAt: time.Date(2024, 5, 1, 10, 0, 0, 1, time.UTC),
+		EmittedAt: time.Date(2024, 5, 1, 10, 0, 1, 2, time.UTC),
+		Level:     LevelWarn,
+		Topic:     "db",
+		Message:   "slow query",
+		Fields:    fields,
+		Caller:    &Frame{Function: "main.run", Package: "main", File: "main.go", Line: 12},
+		Stack:     []Frame{{Function: "main.run", Package: "main", File: "main.go", Line: 12}},
+		Resource:  NewResource().WithService("api", "1.0.0"),
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded EventSnapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	checkFields(t, decoded.Fields)
+	if !decoded.CreatedAt.Equal(s.CreatedAt) || !decoded.EmittedAt.Equal(s.EmittedAt) {
+		t.Errorf("times %v and %v, want %v and %v", decoded.CreatedAt, decoded.EmittedAt, s.CreatedAt, s.EmittedAt)
+	}
+	decoded.Fields, s.Fields = nil, nil
+	decoded.CreatedAt, s.CreatedAt = time.Time{}, time.Time{}
+	decoded.EmittedAt, s.EmittedAt = time.Time{}, time.Time{}
+	if !reflect.DeepEqual(decoded, s) {
+		t.Errorf("decoded %+v, want %+v", decoded, s)
+	}
+}
+
+func TestEventJSONRoundTrip(t *testing.T) {
+	var events []EventSnapshot
+	c := New(WithObserver(WildcardObserver(func(e *Event) { events = append(events, e.Snapshot()) })))
+	fields, _ := everyKind()
+
+	e := c.Warn("slow query").Topic("db")
+	e.fields = append(e.fields, fields...)
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := e.ID()
+	e.Emit()
+
+	// The event is received in another process, and emitted through its observers.
+	remote := c.Info("placeholder")
+	if err := json.Unmarshal(data, remote); err != nil {
+		t.Fatal(err)
+	}
+	remote.Emit()
+
+	if len(events) != 2 {
+		t.Fatalf("emitted %d events", len(events))
+	}
+	got := events[1]
+	if got.ID != id || got.Level != LevelWarn || got.Topic != "db" || got.Message != "slow query" {
+		t.Errorf("decoded %s %v %q %q, want %s warn db \"slow query\"", got.ID, got.Level, got.Topic, got.Message, id)
+	}
+	checkFields(t, got.Fields)
+
+	// Debug builds panic on the use of an emitted event, see TestStaleEventPanicsInDebugMode.
+	if debugEvents {
+		return
+	}
+	if _, err := json.Marshal(e); err == nil {
+		t.Error("emitted event marshaled")
+	}
+	if err := json.Unmarshal(data, e); err == nil {
+		t.Error("emitted event unmarshaled")
+	}
+}
+
+func TestWireAnyValues(t *testing.T) {
+	type point struct{ X, Y int }
+	s := EventSnapshot{ID: "any", Fields: []Field{
+		anyField("struct", point{1, 2}),
+		anyField("map", map[string]int{"a": 1}),
+		anyField("ints", []int{1, 2}),
+		anyField("fields", Fields{"p": point{3, 4}}),
+	}}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded EventSnapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	// Values of type any come back as encoding/json decodes them, only Fields keep their type.
+	want := map[string]any{
+		"struct": map[string]any{"X": 1.0, "Y": 2.0},
+		"map":    map[string]any{"a": 1.0},
+		"ints":   []any{1.0, 2.0},
+		"fields": Fields{"p": map[string]any{"X": 3.0, "Y": 4.0}},
+	}
+	for _, f := range decoded.Fields {
+		if !reflect.DeepEqual(f.Value(), want[f.Key]) {
+			t.Errorf("%s decoded as %#v, want %#v", f.Key, f.Value(), want[f.Key])
+		}
+	}
+}
+
+func TestWireNestingDepth(t *testing.T) {
+	cyclic := Fields{"name": "loop"}
+	cyclic["self"] = cyclic
+	s := EventSnapshot{ID: "cyclic", Fields: []Field{anyField("loop", cyclic)}}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded EventSnapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	depth := 0
+	for v := decoded.Fields[0].Value(); ; depth++ {
+		f, ok := v.(Fields)
+		if !ok || f["self"] == nil {
+			break
+		}
+		v = f["self"]
+	}
+	if depth != maxFieldsDepth {
+		t.Errorf("cyclic fields decoded %d levels deep, want %d", depth, maxFieldsDepth)
+	}
+
+	// The fields beyond the limit are replaced by a marker, which round-trips.
+	innermost := decoded.Fields[0].Value()
+	for i := 0; i < maxFieldsDepth; i++ {
+		innermost = innermost.(Fields)["self"]
+	}
+	if innermost != truncatedFields(2) || fmt.Sprint(innermost) != "<2 fields truncated>" {
+		t.Errorf("innermost value %v, want 2 truncated fields", innermost)
+	}
+	again, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, data) {
+		t.Errorf("re-encoded truncated fields:\n got %s\nwant %s", again, data)
+	}
+	if !strings.Contains(string(data), `{"key":"self","type":"truncated","value":2}`) {
+		t.Errorf("no truncation marker in %s", data)
+	}
+
+	// Data nesting deeper than any encoder does is rejected.
+	deep := `{"key":"k","type":"bool","value":true}`
+	for i := 0; i <= maxFieldsDepth; i++ {
+		deep = `{"key":"k","type":"fields","value":[` + deep + `]}`
+	}
+	err = json.Unmarshal([]byte(`{"id":"deep","level":"info","fields":[`+deep+`]}`), &decoded)
+	if err == nil || !strings.Contains(err.Error(), "too deep") {
+		t.Errorf("decoding too deep fields: %v", err)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		want Level
+	}{
+		{"trace", LevelTrace},
+		{"debug", LevelDebug},
+		{"INFO", LevelInfo},
+		{"warn", LevelWarn},
+		{"Warning", LevelWarn},
+		{"error", LevelError},
+		{"fatal", LevelFatal},
+		{"panic", LevelPanic},
+		{"none", LevelNone},
+		{"", LevelNone},
+	}
+	for _, tt := range tests {
+		if got, err := ParseLevel(tt.name); err != nil || got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil || err.Error() != `skylight: unknown level "verbose"` {
+		t.Errorf("ParseLevel(verbose) error = %v", err)
+	}
+}
+
+func TestLevelText(t *testing.T) {
+	for l := LevelNone; l <= LevelPanic; l++ {
+		text, err := l.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Level
+		if err := decoded.UnmarshalText(text); err != nil || decoded != l {
+			t.Errorf("level %d decoded from %q as %v, %v", int(l), text, decoded, err)
+		}
+	}
+	if _, err := Level(42).MarshalText(); err == nil {
+		t.Error("invalid level marshaled")
+	}
+
+	var config struct{ Level Level }
+	if err := json.Unmarshal([]byte(`{"Level":"warning"}`), &config); err != nil || config.Level != LevelWarn {
+		t.Errorf("level = %v, %v, want warn", config.Level, err)
+	}
+	config.Level = LevelError
+	if err := json.Unmarshal([]byte(`{"Level":"loud"}`), &config); err == nil || config.Level != LevelError {
+		t.Errorf("unknown level decoded as %v, %v", config.Level, err)
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	data, err := json.Marshal(EventSnapshot{ID: "e", Level: LevelInfo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), fmt.Sprintf(`"schema":%d`, SchemaVersion)) {
+		t.Errorf("standalone event %s without its schema", data)
+	}
+
+	var s EventSnapshot
+	if err := json.Unmarshal([]byte(`{"id":"e","level":"info"}`), &s); err != nil || s.ID != "e" {
+		t.Errorf("event without a schema: %v", err)
+	}
+	newer := fmt.Sprintf(`{"schema":%d,"id":"e","level":"info"}`, SchemaVersion+1)
+	if err := json.Unmarshal([]byte(newer), &s); err == nil {
+		t.Error("event of a newer schema decoded")
+	}
+	if _, err := decodeBatch([]byte(fmt.Sprintf(`{"schema":%d,"events":[]}`, SchemaVersion+1))); err == nil {
+		t.Error("batch of a newer schema decoded")
+	}
+	if _, err := decodeBatch([]byte(`[{"id":"e","level":"info"}]`)); err == nil {
+		t.Error("plain array of events decoded as a batch")
+	}
+}
+
+func TestBatchResources(t *testing.T) {
+	shared, other := NewResource().WithService("api", ""), NewResource().WithService("worker", "")
+	events := []EventSnapshot{
+		{ID: "a", Level: LevelInfo, Resource: shared},
+		{ID: "b", Level: LevelInfo, Resource: other},
+		{ID: "c", Level: LevelInfo, Resource: shared},
+	}
+	data, err := encodeBatch(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), `"api"`); n != 1 {
+		t.Errorf("shared resource encoded %d times in %s", n, data)
+	}
+	decoded, err := decodeBatch(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"api", "worker", "api"} {
+		if f, _ := decoded[i].Resource.Field("service.name"); f.Value() != want {
+			t.Errorf("event %s from %v, want %s", decoded[i].ID, f.Value(), want)
+		}
+	}
+	if decoded[0].Resource != decoded[2].Resource {
+		t.Error("decoded events don't share the batch resource")
+	}
+}
@@ -0,0 +1,69 @@
+package skylight
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// WriterSink writes events to an io.Writer as JSON lines, one event per line, see EventSnapshot.MarshalJSON.
+// It is typically used as a local fallback, e.g. with os.Stderr or a file.
+type WriterSink struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+}
+
+// NewWriterSink creates a sink writing to w.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: bufio.NewWriter(w)}
+}
+
+// OpenFileSink creates a sink appending to the file at path, which is closed with the sink.
+func OpenFileSink(path string) (*WriterSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("skylight: open file sink: %w", err)
+	}
+	s := NewWriterSink(f)
+	s.closer = f
+	return s, nil
+}
+
+func (s *WriterSink) Write(ctx context.Context, events []EventSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enc := json.NewEncoder(s.w)
+	for i := range events {
+		// Lines are read on their own, so each of them is a standalone event, carrying the resource.
+		if err := enc.Encode(events[i]); err != nil {
+			return fmt.Errorf("skylight: writer sink: %w", err)
+		}
+	}
+	// Batches are flushed right away: a fallback sink is expected to hold nothing back.
+	return s.w.Flush()
+}
+
+func (s *WriterSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Flush()
+}
+
+func (s *WriterSink) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.w.Flush()
+	if s.closer != nil {
+		if cerr := s.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}